@@ -0,0 +1,53 @@
+// Package server はサーバーアプリの実装です。
+//
+// Protecting copy
+//
+// ProtectingCopier copies values protecting fields tagged for purposes.
+// Pointers, maps and slices referred from multiple places in the source
+// are copied once and shared in the destination in the same way,
+// which also reproduces cycles.
+//
+// Embedded structs
+//
+// Fields of embedded structs and pointers to structs are promoted
+// and tested as fields of the embedding struct:
+//
+//   - StructTag on the embedded field protects all promoted fields
+//     in addition to their own tags.
+//   - WritableTag on the embedded field applies to promoted fields
+//     without their own WritableTag.
+//   - The embedding struct is in the allow-list mode
+//     if any of fields including promoted ones has WritableTag.
+//   - Promoted fields shadowed by other fields with the same name are protected,
+//     as they cannot be specified by names (e.g. in JSON).
+//   - An embedded pointer is created in the destination only if the source has it,
+//     and nil in the source is treated as a struct with zero values.
+//
+// Paths of promoted fields include the embedded field (e.g. "Base.ID").
+// Embedded types registered in Types are copied as ordinary fields.
+//
+// Aliasing
+//
+// The destination never refers memory of the source which can be modified,
+// so modifying the source after the copy never affects the destination,
+// except for:
+//
+//   - values of opaque types registered in Types,
+//     including the mutable *multipart.FileHeader in the default Types,
+//     and ones copied with functions registered in Types,
+//   - keys of maps, which are copied as they are,
+//   - chans, funcs and unsafe.Pointer with ProtectingCopyUncopyableShare,
+//     which is the default of Uncopyable.
+//
+// Datastore properties
+//
+// datastore.PropertyList is copied by property names:
+// properties with protected names (specified with ProtectPaths or ProtectField)
+// are kept and others are replaced with ones in the source.
+// Structs implementing datastore.PropertyLoadSaver are copied
+// by merging properties saved with Save in the same way
+// and loading them with Load,
+// where properties are protected if fields with the same names are protected.
+// Fields not stored (`datastore:"-"`, e.g. keys of goon)
+// and unexported fields are kept.
+package server
@@ -39,11 +39,23 @@ func handlerEntityPost(c echo.Context) error {
 	}
 	entity.ID = 0
 	entity.CreatedAt = time.Now().UTC()
+	entity.ReminderFiredAt = time.Time{}
 	g := goon.FromContext(ctx)
 
-	key, err := g.Put(&entity)
-	if err != nil {
-		log.Errorf(ctx, "Failed to put Entity: %v", err)
+	var key *datastore.Key
+	if err := g.RunInTransaction(func(tg *goon.Goon) error {
+		var err error
+		if key, err = tg.Put(&entity); err != nil {
+			log.Errorf(ctx, "Failed to put Entity: %v", err)
+			return err
+		}
+		entity.ID = key.IntID()
+		if err := enqueueEntityReminder(tg.Context, &entity); err != nil {
+			log.Errorf(ctx, "Failed to enqueue reminder: %v", err)
+			return err
+		}
+		return nil
+	}, nil); err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
 	g.FlushLocalCache()
@@ -77,7 +89,7 @@ func handlerEntityPut(c echo.Context) error {
 	entity.ID = id
 
 	if err := g.RunInTransaction(func(tg *goon.Goon) error {
-		if err := g.Get(&entity); err == datastore.ErrNoSuchEntity {
+		if err := tg.Get(&entity); err == datastore.ErrNoSuchEntity {
 			log.Debugf(ctx, "Not found: entity %v", id)
 			return c.String(http.StatusNotFound, "Not Found")
 		} else if err != nil {
@@ -85,19 +97,41 @@ func handlerEntityPut(c echo.Context) error {
 			return c.String(http.StatusInternalServerError, err.Error())
 		}
 
-		log.Errorf(ctx, "entity (pre)=%+v", entity)
-
-		if err := ProtectingBind(c.Bind, &entity, "update"); err != nil {
+		copier := &ProtectingCopier{
+			ProtectFor: "update",
+			// Rejects the request trying to update protected fields.
+			Strict: c.QueryParam("strict") == "true",
+		}
+		report, err := copier.BindRequestWithReport(c.Request(), c.Bind, &entity)
+		if _, ok := err.(*ErrCopyProtected); ok {
+			log.Warningf(ctx, "Invalid request: %v", err)
+			return c.String(http.StatusUnprocessableEntity, err.Error())
+		} else if err != nil {
 			log.Warningf(ctx, "Invalid request: %v", err)
 			return c.String(http.StatusBadRequest, err.Error())
 		}
+		for _, change := range report.Changed {
+			log.Infof(ctx, "Entity %v: %v: %v -> %v", id, change.Path, change.Old, change.New)
+		}
+		for _, discarded := range report.Discarded {
+			log.Debugf(ctx, "Entity %v: %v is protected: ignored %v", id, discarded.Path, discarded.New)
+		}
+		rescheduled := report.IsChanged("ScheduledDate")
+		if rescheduled {
+			// The task for the old date is ignored when it runs.
+			entity.ReminderFiredAt = time.Time{}
+		}
 
-		log.Errorf(ctx, "entity (after)=%+v", entity)
-
-		if _, err := g.Put(&entity); err != nil {
+		if _, err := tg.Put(&entity); err != nil {
 			log.Errorf(ctx, "Failed to put Entity: %v", err)
 			return c.String(http.StatusInternalServerError, err.Error())
 		}
+		if rescheduled {
+			if err := enqueueEntityReminder(tg.Context, &entity); err != nil {
+				log.Errorf(ctx, "Failed to enqueue reminder: %v", err)
+				return err
+			}
+		}
 		return nil
 	}, nil); err != nil {
 		return err
@@ -55,13 +55,21 @@ func callHandlerEntityPostRaw(t *testing.T, inst aetest.Instance, data []byte) (
 }
 
 func callHandlerEntityPut(t *testing.T, inst aetest.Instance, id int64, reqdata interface{}) (*httptest.ResponseRecorder, error) {
+	return callHandlerEntityPutWithQuery(t, inst, id, "", reqdata)
+}
+
+func callHandlerEntityPutWithQuery(t *testing.T, inst aetest.Instance, id int64, query string, reqdata interface{}) (*httptest.ResponseRecorder, error) {
 	var data []byte
 	var err error
 	if data, err = json.Marshal(reqdata); err != nil {
 		t.Fatalf("Failt to request PUT /entity/%d: %v", id, err)
 	}
 
-	req, err := inst.NewRequest("PUT", fmt.Sprintf("/entity/%d", id), bytes.NewReader(data))
+	path := fmt.Sprintf("/entity/%d", id)
+	if query != "" {
+		path += "?" + query
+	}
+	req, err := inst.NewRequest("PUT", path, bytes.NewReader(data))
 	if err != nil {
 		panic(err)
 	}
@@ -644,3 +652,68 @@ func TestEntityPutBadParameters(t *testing.T) {
 		}
 	}
 }
+
+func TestEntityPutStrict(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	ctx := testutil.GetAppengineContextFor(inst)
+
+	if keyList, err := datastore.NewQuery("Entity").KeysOnly().GetAll(ctx, nil); err != nil {
+		panic(err)
+	} else {
+		if err := datastore.DeleteMulti(ctx, keyList); err != nil {
+			panic(err)
+		}
+	}
+	testutil.FlushGoonCache(ctx)
+
+	var created Entity
+	if res, err := callHandlerEntityPost(t, inst, &struct {
+		Name string `json:"name"`
+	}{
+		Name: "Testdata1",
+	}); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	} else {
+		resdata := res.Body.Bytes()
+		if err := json.Unmarshal(resdata, &created); err != nil {
+			t.Fatalf("Failed to parse: %v", resdata)
+		}
+	}
+
+	// 保護されたフィールドを変更しようとすると 422
+	if res, err := callHandlerEntityPutWithQuery(t, inst, created.ID, "strict=true", &struct {
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"createdAt"`
+	}{
+		Name:      "Testdata1.1",
+		CreatedAt: created.CreatedAt.AddDate(1, 0, 0),
+	}); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected 422, but %v", res.Code)
+	} else if !strings.Contains(res.Body.String(), "CreatedAt") {
+		t.Errorf("Expected CreatedAt is reported, but %v", res.Body.String())
+	}
+
+	// 保護されたフィールドが同じ値なら更新できる
+	if res, err := callHandlerEntityPutWithQuery(t, inst, created.ID, "strict=true", &struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}{
+		ID:   created.ID,
+		Name: "Testdata1.2",
+	}); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+
+	testutil.FlushGoonCache(ctx)
+	entity := Entity{ID: created.ID}
+	if err := datastore.Get(ctx, datastore.NewKey(ctx, "Entity", "", created.ID, nil), &entity); err != nil {
+		panic(err)
+	}
+	expectEquals(t, "Testdata1.2", entity.Name)
+}
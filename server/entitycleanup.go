@@ -0,0 +1,213 @@
+package server
+
+// 古いエンティティのアーカイブ
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mjibson/goon"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/taskqueue"
+)
+
+const (
+	// entityCleanupPath is the path of the handler
+	// both for the cron job and for chained tasks.
+	entityCleanupPath = "/internal/cron/entity-cleanup"
+	// entityCleanupQueue is the queue for chained tasks.
+	// "" stands for the default queue.
+	entityCleanupQueue = ""
+
+	entityCleanupStatusRunning = "running"
+	entityCleanupStatusDone    = "done"
+)
+
+var (
+	// entityCleanupRetention is how long entities are kept after ScheduledDate.
+	entityCleanupRetention = 30 * 24 * time.Hour
+
+	// entityCleanupBatchSize is the number of entities archived at once.
+	entityCleanupBatchSize = 100
+
+	// entityCleanupTimeBudget is how long a request processes batches
+	// before handing the rest over to the next task.
+	entityCleanupTimeBudget = 30 * time.Second
+)
+
+// handlerInternalEntityCleanupGet starts a new cleanup run.
+// Called by cron.
+func handlerInternalEntityCleanupGet(c echo.Context) error {
+	ctx := appengine.NewContext(c.Request())
+	g := goon.FromContext(ctx)
+
+	now := time.Now().UTC()
+	run := &EntityCleanupRun{
+		ID:        now.Format("20060102-150405"),
+		Status:    entityCleanupStatusRunning,
+		Cutoff:    now.Add(-entityCleanupRetention),
+		StartedAt: now,
+	}
+	if _, err := g.Put(run); err != nil {
+		log.Errorf(ctx, "Failed to put EntityCleanupRun: %v", err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return processEntityCleanup(ctx, c, g, run, nil, 0)
+}
+
+// handlerInternalEntityCleanupPost resumes the cleanup run.
+// Called by tasks chained from the previous request.
+func handlerInternalEntityCleanupPost(c echo.Context) error {
+	ctx := appengine.NewContext(c.Request())
+	g := goon.FromContext(ctx)
+
+	run := &EntityCleanupRun{ID: c.FormValue("run")}
+	if run.ID == "" {
+		log.Errorf(ctx, "Invalid cleanup task: run is not specified")
+		return c.NoContent(http.StatusOK)
+	}
+	seq, err := strconv.Atoi(c.FormValue("seq"))
+	if err != nil {
+		log.Errorf(ctx, "Invalid cleanup task: seq=%v: %v", c.FormValue("seq"), err)
+		return c.NoContent(http.StatusOK)
+	}
+	var cursor *datastore.Cursor
+	if v := c.FormValue("cursor"); v != "" {
+		if _cursor, err := datastore.DecodeCursor(v); err == nil {
+			cursor = &_cursor
+		} else {
+			log.Errorf(ctx, "Invalid cleanup task: cursor=%v: %v", v, err)
+			return c.NoContent(http.StatusOK)
+		}
+	}
+
+	if err := g.Get(run); err == datastore.ErrNoSuchEntity {
+		log.Errorf(ctx, "Invalid cleanup task: run %v does not exist", run.ID)
+		return c.NoContent(http.StatusOK)
+	} else if err != nil {
+		log.Errorf(ctx, "Failed to get EntityCleanupRun: %v", err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if run.Status == entityCleanupStatusDone {
+		log.Infof(ctx, "Cleanup run %v is already done", run.ID)
+		return c.NoContent(http.StatusOK)
+	}
+	return processEntityCleanup(ctx, c, g, run, cursor, seq)
+}
+
+// processEntityCleanup archives entities in batches
+// until no entities are left or the time budget runs out.
+// In the latter case, it chains a task to process the rest.
+func processEntityCleanup(ctx context.Context, c echo.Context, g *goon.Goon, run *EntityCleanupRun, cursor *datastore.Cursor, seq int) error {
+	start := time.Now()
+	run.Requests++
+	for {
+		next, archived, err := archiveEntityBatch(g, run.Cutoff, cursor)
+		if err != nil {
+			log.Errorf(ctx, "Failed to archive Entity: %v", err)
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		run.Archived += archived
+		cursor = next
+		if cursor == nil {
+			break
+		}
+		if time.Since(start) > entityCleanupTimeBudget {
+			if err := chainEntityCleanup(ctx, run, cursor, seq+1); err != nil {
+				log.Errorf(ctx, "Failed to chain cleanup task: %v", err)
+				return c.String(http.StatusInternalServerError, err.Error())
+			}
+			break
+		}
+	}
+	if cursor == nil {
+		run.Status = entityCleanupStatusDone
+		run.FinishedAt = time.Now().UTC()
+	}
+	if _, err := g.Put(run); err != nil {
+		log.Errorf(ctx, "Failed to put EntityCleanupRun: %v", err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	log.Infof(ctx, "Cleanup run %v: archived %v entities in total (%v)", run.ID, run.Archived, run.Status)
+	return c.NoContent(http.StatusOK)
+}
+
+// archiveEntityBatch moves a batch of entities
+// whose ScheduledDate is before cutoff to ArchivedEntity.
+// Returns the cursor to the next batch, or nil if this is the last batch.
+// Entities are archived before deleted, so retrying a failed batch is safe.
+func archiveEntityBatch(g *goon.Goon, cutoff time.Time, cursor *datastore.Cursor) (*datastore.Cursor, int, error) {
+	q := datastore.NewQuery("Entity").
+		Filter("ScheduledDate >", time.Time{}).
+		Filter("ScheduledDate <", cutoff).
+		Order("ScheduledDate").
+		Limit(entityCleanupBatchSize)
+	if cursor != nil {
+		q = q.Start(*cursor)
+	}
+
+	now := time.Now().UTC()
+	archives := []*ArchivedEntity{}
+	keys := []*datastore.Key{}
+	it := g.Run(q)
+	for {
+		var entity Entity
+		key, err := it.Next(&entity)
+		if err == datastore.Done {
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+		archives = append(archives, &ArchivedEntity{
+			ID:              entity.ID,
+			Name:            entity.Name,
+			ScheduledDate:   entity.ScheduledDate,
+			CreatedAt:       entity.CreatedAt,
+			ReminderFiredAt: entity.ReminderFiredAt,
+			ArchivedAt:      now,
+		})
+		keys = append(keys, key)
+	}
+	if len(archives) == 0 {
+		return nil, 0, nil
+	}
+	if _, err := g.PutMulti(archives); err != nil {
+		return nil, 0, err
+	}
+	if err := g.DeleteMulti(keys); err != nil {
+		return nil, 0, err
+	}
+	if len(archives) < entityCleanupBatchSize {
+		return nil, len(archives), nil
+	}
+	next, err := it.Cursor()
+	if err != nil {
+		return nil, 0, err
+	}
+	return &next, len(archives), nil
+}
+
+// chainEntityCleanup adds a task to resume the run from cursor.
+// Tasks are named after the run and seq,
+// so a retried request does not chain the same task twice.
+func chainEntityCleanup(ctx context.Context, run *EntityCleanupRun, cursor *datastore.Cursor, seq int) error {
+	task := taskqueue.NewPOSTTask(entityCleanupPath, url.Values{
+		"run":    []string{run.ID},
+		"seq":    []string{strconv.Itoa(seq)},
+		"cursor": []string{cursor.String()},
+	})
+	task.Name = fmt.Sprintf("entity-cleanup-%s-%d", run.ID, seq)
+	if _, err := taskqueue.Add(ctx, task, entityCleanupQueue); err != nil && err != taskqueue.ErrTaskAlreadyAdded {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ikedam/gaetest/testutil"
+	"github.com/labstack/echo"
+
+	"google.golang.org/appengine/aetest"
+	"google.golang.org/appengine/datastore"
+)
+
+func callHandlerInternalEntityCleanupGet(t *testing.T, inst aetest.Instance) (*httptest.ResponseRecorder, error) {
+	req, err := inst.NewRequest("GET", entityCleanupPath, nil)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Add("X-Appengine-Cron", "true")
+
+	e := echo.New()
+	res := httptest.NewRecorder()
+
+	return res, handlerInternalEntityCleanupGet(e.NewContext(req, res))
+}
+
+func callHandlerInternalEntityCleanupPost(t *testing.T, inst aetest.Instance, run string, seq int) (*httptest.ResponseRecorder, error) {
+	form := url.Values{
+		"run": []string{run},
+		"seq": []string{strconv.Itoa(seq)},
+	}
+	req, err := inst.NewRequest("POST", entityCleanupPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("X-AppEngine-QueueName", "default")
+
+	e := echo.New()
+	res := httptest.NewRecorder()
+
+	return res, handlerInternalEntityCleanupPost(e.NewContext(req, res))
+}
+
+// setupEntityCleanupData registers 5 expired entities (old0 ... old4)
+// and 2 entities not to archive.
+func setupEntityCleanupData(t *testing.T, inst aetest.Instance) {
+	ctx := testutil.GetAppengineContextFor(inst)
+
+	for _, kind := range []string{"Entity", "ArchivedEntity", "EntityCleanupRun"} {
+		if keyList, err := datastore.NewQuery(kind).KeysOnly().GetAll(ctx, nil); err != nil {
+			panic(err)
+		} else {
+			if err := datastore.DeleteMulti(ctx, keyList); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	keys := []*datastore.Key{}
+	entities := []Entity{}
+	for i := 0; i < 5; i++ {
+		keys = append(keys, datastore.NewIncompleteKey(ctx, "Entity", nil))
+		entities = append(entities, Entity{
+			Name:          fmt.Sprintf("old%d", i),
+			ScheduledDate: now.Add(-entityCleanupRetention).AddDate(0, 0, -1-i),
+			CreatedAt:     now,
+		})
+	}
+	keys = append(keys, datastore.NewIncompleteKey(ctx, "Entity", nil))
+	entities = append(entities, Entity{
+		Name:          "recent",
+		ScheduledDate: now.AddDate(0, 0, -1),
+		CreatedAt:     now,
+	})
+	keys = append(keys, datastore.NewIncompleteKey(ctx, "Entity", nil))
+	entities = append(entities, Entity{
+		Name:      "unscheduled",
+		CreatedAt: now,
+	})
+	if _, err := datastore.PutMulti(ctx, keys, entities); err != nil {
+		panic(err)
+	}
+
+	testutil.FlushGoonCache(ctx)
+}
+
+func verifyEntityCleanupResult(t *testing.T, inst aetest.Instance) {
+	ctx := testutil.GetAppengineContextFor(inst)
+
+	var entityList []Entity
+	if _, err := datastore.NewQuery("Entity").GetAll(ctx, &entityList); err != nil {
+		panic(err)
+	}
+	names := []string{}
+	for _, entity := range entityList {
+		names = append(names, entity.Name)
+	}
+	if len(names) != 2 || !strings.Contains(strings.Join(names, ","), "recent") || !strings.Contains(strings.Join(names, ","), "unscheduled") {
+		t.Errorf("Expect recent and unscheduled are left, but was %v", names)
+	}
+
+	var archivedList []ArchivedEntity
+	if _, err := datastore.NewQuery("ArchivedEntity").GetAll(ctx, &archivedList); err != nil {
+		panic(err)
+	}
+	if len(archivedList) != 5 {
+		t.Errorf("Expect 5 archived, but was %v", archivedList)
+	}
+	for _, archived := range archivedList {
+		if !strings.HasPrefix(archived.Name, "old") {
+			t.Errorf("Unexpected archived entity: %v", archived)
+		}
+		if archived.ArchivedAt.IsZero() {
+			t.Errorf("Expect ArchivedAt is set, but not: %v", archived)
+		}
+	}
+
+	var runList []EntityCleanupRun
+	if _, err := datastore.NewQuery("EntityCleanupRun").GetAll(ctx, &runList); err != nil {
+		panic(err)
+	}
+	if len(runList) != 1 {
+		t.Fatalf("Expect 1 run, but was %v", runList)
+	}
+	expectEquals(t, entityCleanupStatusDone, runList[0].Status)
+	expectEquals(t, 5, runList[0].Archived)
+	if runList[0].FinishedAt.IsZero() {
+		t.Errorf("Expect FinishedAt is set, but not: %v", runList[0])
+	}
+}
+
+func TestEntityCleanup(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	setupEntityCleanupData(t, inst)
+
+	origBatchSize := entityCleanupBatchSize
+	entityCleanupBatchSize = 2
+	defer func() {
+		entityCleanupBatchSize = origBatchSize
+	}()
+
+	if res, err := callHandlerInternalEntityCleanupGet(t, inst); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+	verifyEntityCleanupResult(t, inst)
+}
+
+func TestEntityCleanupChained(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	ctx := testutil.GetAppengineContextFor(inst)
+	setupEntityCleanupData(t, inst)
+
+	origBatchSize := entityCleanupBatchSize
+	origTimeBudget := entityCleanupTimeBudget
+	entityCleanupBatchSize = 2
+	entityCleanupTimeBudget = 0
+	defer func() {
+		entityCleanupBatchSize = origBatchSize
+		entityCleanupTimeBudget = origTimeBudget
+	}()
+
+	if res, err := callHandlerInternalEntityCleanupGet(t, inst); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+
+	var runList []EntityCleanupRun
+	keys, err := datastore.NewQuery("EntityCleanupRun").GetAll(ctx, &runList)
+	if err != nil {
+		panic(err)
+	}
+	if len(runList) != 1 {
+		t.Fatalf("Expect 1 run, but was %v", runList)
+	}
+	expectEquals(t, entityCleanupStatusRunning, runList[0].Status)
+	expectEquals(t, 2, runList[0].Archived)
+
+	// チェーンされたタスクの代わりに呼び出す。
+	// アーカイブ済みのエンティティは削除されるため、カーソルなしでも続きから処理される。
+	runID := keys[0].StringID()
+	for seq := 1; seq < 10; seq++ {
+		if res, err := callHandlerInternalEntityCleanupPost(t, inst, runID, seq); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		} else if res.Code != http.StatusOK {
+			t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+		}
+		var run EntityCleanupRun
+		if err := datastore.Get(ctx, keys[0], &run); err != nil {
+			panic(err)
+		}
+		if run.Status == entityCleanupStatusDone {
+			break
+		}
+	}
+	verifyEntityCleanupResult(t, inst)
+}
+
+func TestEntityCleanupInvalidTask(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+
+	// リトライしても成功しないので 200 を返す
+	for _, run := range []string{"", "no-such-run"} {
+		if res, err := callHandlerInternalEntityCleanupPost(t, inst, run, 1); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		} else if res.Code != http.StatusOK {
+			t.Errorf("Expected 200 for %v, but %v", run, res.Code)
+		}
+	}
+}
+
+func TestRequireInternalRequestCron(t *testing.T) {
+	e := echo.New()
+	handler := requireInternalRequest(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", entityCleanupPath, nil)
+	req.Header.Add("X-Appengine-Cron", "true")
+	res := httptest.NewRecorder()
+	if err := handler(e.NewContext(req, res)); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusOK {
+		t.Errorf("Expected 200, but %v", res.Code)
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+// エンティティのエクスポート
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mjibson/goon"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+)
+
+const (
+	entityFormatCSV    = "csv"
+	entityFormatNDJSON = "ndjson"
+
+	// entityTimeFormat is used for all timestamps in exported / imported files.
+	entityTimeFormat = time.RFC3339Nano
+)
+
+var (
+	// entityExportChunkSize is the number of entities fetched with a cursor at once.
+	entityExportChunkSize = 100
+
+	// entityCSVHeader is the header line of CSV files.
+	entityCSVHeader = []string{"id", "name", "scheduledDate", "createdAt"}
+)
+
+// entityRecord is the representation of Entity in exported files.
+type entityRecord struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	ScheduledDate string `json:"scheduledDate"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+func newEntityRecord(entity *Entity) *entityRecord {
+	return &entityRecord{
+		ID:            entity.ID,
+		Name:          entity.Name,
+		ScheduledDate: formatEntityTime(entity.ScheduledDate),
+		CreatedAt:     formatEntityTime(entity.CreatedAt),
+	}
+}
+
+func (r *entityRecord) csvRow() []string {
+	return []string{
+		strconv.FormatInt(r.ID, 10),
+		r.Name,
+		r.ScheduledDate,
+		r.CreatedAt,
+	}
+}
+
+// formatEntityTime formats t in RFC 3339 in UTC.
+// The zero time is formatted as an empty string.
+func formatEntityTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(entityTimeFormat)
+}
+
+// entityWriter writes entities in a specific format.
+type entityWriter interface {
+	Write(entity *Entity) error
+	Flush() error
+}
+
+type entityCSVWriter struct {
+	w *csv.Writer
+}
+
+func newEntityCSVWriter(w io.Writer) (*entityCSVWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(entityCSVHeader); err != nil {
+		return nil, err
+	}
+	return &entityCSVWriter{w: cw}, nil
+}
+
+func (w *entityCSVWriter) Write(entity *Entity) error {
+	return w.w.Write(newEntityRecord(entity).csvRow())
+}
+
+func (w *entityCSVWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type entityNDJSONWriter struct {
+	enc *json.Encoder
+}
+
+func newEntityNDJSONWriter(w io.Writer) *entityNDJSONWriter {
+	return &entityNDJSONWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *entityNDJSONWriter) Write(entity *Entity) error {
+	// json.Encoder terminates each value with a newline.
+	return w.enc.Encode(newEntityRecord(entity))
+}
+
+func (w *entityNDJSONWriter) Flush() error {
+	return nil
+}
+
+// parseEntityExportQuery builds the query for the export
+// from query parameters `createdFrom` and `createdTo`.
+func parseEntityExportQuery(c echo.Context) (*datastore.Query, error) {
+	q := datastore.NewQuery("Entity").Order("-CreatedAt")
+	if v := c.QueryParam("createdFrom"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid createdFrom: %v", err)
+		}
+		q = q.Filter("CreatedAt >=", from)
+	}
+	if v := c.QueryParam("createdTo"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid createdTo: %v", err)
+		}
+		q = q.Filter("CreatedAt <", to)
+	}
+	return q, nil
+}
+
+func handlerEntityExportGet(c echo.Context) error {
+	ctx := appengine.NewContext(c.Request())
+	g := goon.FromContext(ctx)
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = entityFormatCSV
+	}
+
+	var contentType string
+	switch format {
+	case entityFormatCSV:
+		contentType = "text/csv; charset=utf-8"
+	case entityFormatNDJSON:
+		contentType = "application/x-ndjson"
+	default:
+		log.Warningf(ctx, "Invalid request: unsupported format %v", format)
+		return c.String(http.StatusBadRequest, fmt.Sprintf("unsupported format: %v", format))
+	}
+
+	q, err := parseEntityExportQuery(c)
+	if err != nil {
+		log.Warningf(ctx, "Invalid request: %v", err)
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, contentType)
+	res.Header().Set(
+		echo.HeaderContentDisposition,
+		fmt.Sprintf(
+			`attachment; filename="entities-%s.%s"`,
+			time.Now().UTC().Format("20060102-150405"),
+			format,
+		),
+	)
+	res.WriteHeader(http.StatusOK)
+
+	var w entityWriter
+	if format == entityFormatCSV {
+		if cw, err := newEntityCSVWriter(res); err == nil {
+			w = cw
+		} else {
+			log.Errorf(ctx, "Failed to write CSV header: %v", err)
+			return nil
+		}
+	} else {
+		w = newEntityNDJSONWriter(res)
+	}
+
+	// The status is already sent. Errors after here can only be logged.
+	flush := func() {
+		// Not all writers (e.g. wrapped by middlewares) support flushing.
+		if f, ok := res.Writer.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	if err := exportEntities(g, q, w, flush); err != nil {
+		log.Errorf(ctx, "Failed to export Entity: %v", err)
+	}
+	return nil
+}
+
+// exportEntities writes all entities matching q to w,
+// fetching entityExportChunkSize entities at once with cursors.
+// flush is called after each chunk.
+func exportEntities(g *goon.Goon, q *datastore.Query, w entityWriter, flush func()) error {
+	var cursor *datastore.Cursor
+	for {
+		chunkQuery := q.Limit(entityExportChunkSize)
+		if cursor != nil {
+			chunkQuery = chunkQuery.Start(*cursor)
+		}
+		it := g.Run(chunkQuery)
+		count := 0
+		for {
+			var entity Entity
+			if _, err := it.Next(&entity); err == datastore.Done {
+				break
+			} else if err != nil {
+				return err
+			}
+			if err := w.Write(&entity); err != nil {
+				return err
+			}
+			count++
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		flush()
+		if count < entityExportChunkSize {
+			return nil
+		}
+		next, err := it.Cursor()
+		if err != nil {
+			return err
+		}
+		cursor = &next
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ikedam/gaetest/testutil"
+	"github.com/labstack/echo"
+
+	"google.golang.org/appengine/aetest"
+	"google.golang.org/appengine/datastore"
+)
+
+func callHandlerEntityExportGet(t *testing.T, inst aetest.Instance, query string) (*httptest.ResponseRecorder, error) {
+	req, err := inst.NewRequest("GET", "/entity/export?"+query, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	e := echo.New()
+	res := httptest.NewRecorder()
+
+	return res, handlerEntityExportGet(e.NewContext(req, res))
+}
+
+// setupEntityExportData registers entities test0 ... test4
+// created at 2017-01-01T00:00:00Z + i hours.
+func setupEntityExportData(t *testing.T, inst aetest.Instance) {
+	ctx := testutil.GetAppengineContextFor(inst)
+
+	// Entity を空にする
+	if keyList, err := datastore.NewQuery("Entity").KeysOnly().GetAll(ctx, nil); err != nil {
+		panic(err)
+	} else {
+		if err := datastore.DeleteMulti(ctx, keyList); err != nil {
+			panic(err)
+		}
+	}
+
+	keys := []*datastore.Key{}
+	entities := []Entity{}
+	for i := 0; i < 5; i++ {
+		key := datastore.NewIncompleteKey(ctx, "Entity", nil)
+		entity := Entity{
+			Name:          fmt.Sprintf("test%d", i),
+			ScheduledDate: time.Date(2018, 1, 1+i, 0, 0, 0, 0, time.UTC),
+			CreatedAt:     time.Date(2017, 1, 1, i, 0, 0, 0, time.UTC),
+		}
+		keys = append(keys, key)
+		entities = append(entities, entity)
+	}
+	if _, err := datastore.PutMulti(ctx, keys, entities); err != nil {
+		panic(err)
+	}
+
+	testutil.FlushGoonCache(ctx)
+}
+
+func TestEntityExportCSV(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	setupEntityExportData(t, inst)
+
+	// カーソルによる分割取得を確認するため、チャンクを小さくする
+	origChunkSize := entityExportChunkSize
+	entityExportChunkSize = 2
+	defer func() {
+		entityExportChunkSize = origChunkSize
+	}()
+
+	res, err := callHandlerEntityExportGet(t, inst, "format=csv")
+	if err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	if ct := res.Header().Get(echo.HeaderContentType); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Expected text/csv, but %v", ct)
+	}
+	if cd := res.Header().Get(echo.HeaderContentDisposition); !strings.HasPrefix(cd, "attachment;") || !strings.Contains(cd, ".csv") {
+		t.Errorf("Unexpected Content-Disposition: %v", cd)
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(res.Body.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(rows) != 6 {
+		t.Fatalf("Expect header and 5 records, but was %v", rows)
+	}
+	expectEquals(t, entityCSVHeader, rows[0])
+	// 作成日時の降順に返る
+	for idx, row := range rows[1:] {
+		i := 4 - idx
+		if row[0] == "" || row[0] == "0" {
+			t.Errorf("Expect non-0 id, but was %v", row[0])
+		}
+		expectEquals(t, fmt.Sprintf("test%d", i), row[1])
+		expectEquals(t, fmt.Sprintf("2018-01-0%dT00:00:00Z", 1+i), row[2])
+		expectEquals(t, fmt.Sprintf("2017-01-01T0%d:00:00Z", i), row[3])
+	}
+}
+
+func TestEntityExportNDJSON(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	setupEntityExportData(t, inst)
+
+	res, err := callHandlerEntityExportGet(t, inst, "format=ndjson")
+	if err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	if ct := res.Header().Get(echo.HeaderContentType); ct != "application/x-ndjson" {
+		t.Errorf("Expected application/x-ndjson, but %v", ct)
+	}
+	if cd := res.Header().Get(echo.HeaderContentDisposition); !strings.Contains(cd, ".ndjson") {
+		t.Errorf("Unexpected Content-Disposition: %v", cd)
+	}
+
+	records := []entityRecord{}
+	scanner := bufio.NewScanner(bytes.NewReader(res.Body.Bytes()))
+	for scanner.Scan() {
+		var record entityRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Failed to parse: %v", scanner.Text())
+		}
+		records = append(records, record)
+	}
+	if len(records) != 5 {
+		t.Fatalf("Expect 5 records, but was %v", records)
+	}
+	for idx, record := range records {
+		i := 4 - idx
+		expectEquals(t, fmt.Sprintf("test%d", i), record.Name)
+		expectEquals(t, fmt.Sprintf("2018-01-0%dT00:00:00Z", 1+i), record.ScheduledDate)
+		expectEquals(t, fmt.Sprintf("2017-01-01T0%d:00:00Z", i), record.CreatedAt)
+	}
+}
+
+func TestEntityExportFiltered(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	setupEntityExportData(t, inst)
+
+	res, err := callHandlerEntityExportGet(
+		t,
+		inst,
+		"createdFrom=2017-01-01T01:00:00Z&createdTo=2017-01-01T03:00:00Z",
+	)
+	if err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(res.Body.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expect header and 2 records, but was %v", rows)
+	}
+	expectEquals(t, "test2", rows[1][1])
+	expectEquals(t, "test1", rows[2][1])
+}
+
+func TestEntityExportBadParameters(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+
+	for _, query := range []string{
+		"format=xml",
+		"createdFrom=yesterday",
+		"createdTo=2017-01-01",
+	} {
+		if res, err := callHandlerEntityExportGet(t, inst, query); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		} else if res.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %v, but %v", query, res.Code)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package server
+
+// エンティティのインポート
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mjibson/goon"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+)
+
+const (
+	entityImportStatusRunning = "running"
+	entityImportStatusDone    = "done"
+)
+
+var (
+	// entityImportChunkSize is the number of entities put with a PutMulti at once.
+	// Must be at most 100 as reminders are enqueued for each chunk.
+	entityImportChunkSize = 100
+
+	// errEntityImportConflict is returned when the idempotency key
+	// is already used for another file.
+	errEntityImportConflict = errors.New("the import key is already used for another file")
+)
+
+// entityImportRowError is a validation error of a row.
+// Row is 1-origin and does not count the CSV header and blank lines.
+type entityImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+// entityImportResult is the response of the import.
+type entityImportResult struct {
+	Key      string                  `json:"key"`
+	DryRun   bool                    `json:"dryRun"`
+	Replayed bool                    `json:"replayed"`
+	Total    int                     `json:"total"`
+	Imported int                     `json:"imported"`
+	Errors   []*entityImportRowError `json:"errors"`
+}
+
+// parseEntityTime parses the time formatted with formatEntityTime.
+func parseEntityTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// toEntity validates the record and converts it to Entity.
+// Returns nil and the list of problems if the record is invalid.
+func (r *entityRecord) toEntity(now time.Time) (*Entity, []string) {
+	var problems []string
+	entity := &Entity{
+		ID:   r.ID,
+		Name: r.Name,
+	}
+	if r.ID < 0 {
+		problems = append(problems, fmt.Sprintf("id must not be negative: %v", r.ID))
+	}
+	if strings.TrimSpace(r.Name) == "" {
+		problems = append(problems, "name is required")
+	}
+	if t, err := parseEntityTime(r.ScheduledDate); err == nil {
+		entity.ScheduledDate = t
+	} else {
+		problems = append(problems, fmt.Sprintf("invalid scheduledDate: %v", r.ScheduledDate))
+	}
+	if t, err := parseEntityTime(r.CreatedAt); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid createdAt: %v", r.CreatedAt))
+	} else if t.IsZero() {
+		entity.CreatedAt = now
+	} else {
+		entity.CreatedAt = t
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return entity, nil
+}
+
+// readEntityCSV reads records from CSV with the header line.
+// Columns are matched with the header and may be in any order.
+func readEntityCSV(r io.Reader) ([]*entityRecord, []*entityImportRowError, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("empty file")
+	} else if err != nil {
+		return nil, nil, err
+	}
+	columns := map[string]int{}
+	for idx, name := range header {
+		columns[strings.TrimSpace(name)] = idx
+	}
+	for name := range columns {
+		known := false
+		for _, expected := range entityCSVHeader {
+			if name == expected {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, nil, fmt.Errorf("unknown column: %v", name)
+		}
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, nil, errors.New("column name is required")
+	}
+	get := func(row []string, name string) string {
+		if idx, ok := columns[name]; ok {
+			return row[idx]
+		}
+		return ""
+	}
+
+	records := []*entityRecord{}
+	rowErrors := []*entityImportRowError{}
+	for rowNum := 1; ; rowNum++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if _, ok := err.(*csv.ParseError); ok {
+			rowErrors = append(rowErrors, &entityImportRowError{Row: rowNum, Message: err.Error()})
+			records = append(records, nil)
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		record := &entityRecord{
+			Name:          get(row, "name"),
+			ScheduledDate: get(row, "scheduledDate"),
+			CreatedAt:     get(row, "createdAt"),
+		}
+		if v := get(row, "id"); v != "" {
+			if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+				record.ID = id
+			} else {
+				rowErrors = append(rowErrors, &entityImportRowError{Row: rowNum, Message: fmt.Sprintf("invalid id: %v", v)})
+				records = append(records, nil)
+				continue
+			}
+		}
+		records = append(records, record)
+	}
+	return records, rowErrors, nil
+}
+
+// readEntityNDJSON reads records from JSON Lines. Blank lines are ignored.
+func readEntityNDJSON(r io.Reader) ([]*entityRecord, []*entityImportRowError, error) {
+	records := []*entityRecord{}
+	rowErrors := []*entityImportRowError{}
+	scanner := bufio.NewScanner(r)
+	rowNum := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		rowNum++
+		var record entityRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			rowErrors = append(rowErrors, &entityImportRowError{Row: rowNum, Message: err.Error()})
+			records = append(records, nil)
+			continue
+		}
+		records = append(records, &record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return records, rowErrors, nil
+}
+
+// handlerEntityImportPost imports entities from the request body.
+// Rows with id overwrite the existing entities, and others are created.
+// Nothing is written if any row is invalid.
+// Uploading the same file (or with the same Idempotency-Key header) again
+// returns the result of the first upload without creating entities.
+// Reminders are enqueued for entities with ScheduledDate in the future.
+func handlerEntityImportPost(c echo.Context) error {
+	ctx := appengine.NewContext(c.Request())
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = entityFormatCSV
+	}
+	dryRun := false
+	if v := c.QueryParam("dryRun"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			dryRun = b
+		} else {
+			log.Warningf(ctx, "Invalid request: invalid dryRun %v", v)
+			return c.String(http.StatusBadRequest, fmt.Sprintf("invalid dryRun: %v", v))
+		}
+	}
+
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Warningf(ctx, "Failed to read request: %v", err)
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	var records []*entityRecord
+	var rowErrors []*entityImportRowError
+	switch format {
+	case entityFormatCSV:
+		records, rowErrors, err = readEntityCSV(bytes.NewReader(body))
+	case entityFormatNDJSON:
+		records, rowErrors, err = readEntityNDJSON(bytes.NewReader(body))
+	default:
+		log.Warningf(ctx, "Invalid request: unsupported format %v", format)
+		return c.String(http.StatusBadRequest, fmt.Sprintf("unsupported format: %v", format))
+	}
+	if err != nil {
+		log.Warningf(ctx, "Invalid request: %v", err)
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	now := time.Now().UTC()
+	entities := []*Entity{}
+	for idx, record := range records {
+		if record == nil {
+			// already reported
+			continue
+		}
+		entity, problems := record.toEntity(now)
+		for _, problem := range problems {
+			rowErrors = append(rowErrors, &entityImportRowError{Row: idx + 1, Message: problem})
+		}
+		if entity != nil {
+			entities = append(entities, entity)
+		}
+	}
+	sort.SliceStable(rowErrors, func(i, j int) bool {
+		return rowErrors[i].Row < rowErrors[j].Row
+	})
+
+	hash := sha256.Sum256(body)
+	contentHash := hex.EncodeToString(hash[:])
+	key := c.Request().Header.Get(headerIdempotencyKey)
+	if key == "" {
+		key = contentHash
+	}
+
+	result := &entityImportResult{
+		Key:    key,
+		DryRun: dryRun,
+		Total:  len(records),
+		Errors: rowErrors,
+	}
+	if len(rowErrors) > 0 {
+		log.Debugf(ctx, "Invalid rows in import %v: %v errors", key, len(rowErrors))
+		return c.JSON(http.StatusBadRequest, result)
+	}
+	if dryRun {
+		return c.JSON(http.StatusOK, result)
+	}
+
+	g := goon.FromContext(ctx)
+	imp, err := beginEntityImport(ctx, g, key, contentHash, entities)
+	if err == errEntityImportConflict {
+		log.Warningf(ctx, "Conflicting import %v: %v", key, err)
+		return c.String(http.StatusConflict, err.Error())
+	} else if err != nil {
+		log.Errorf(ctx, "Failed to begin EntityImport: %v", err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if imp.Status == entityImportStatusDone {
+		result.Replayed = true
+		result.Imported = imp.Imported
+		return c.JSON(http.StatusOK, result)
+	}
+
+	// IDs are assigned from the range allocated at the first attempt,
+	// so retrying a failed import overwrites the same entities.
+	nextID := imp.IDLow
+	for _, entity := range entities {
+		if entity.ID == 0 {
+			entity.ID = nextID
+			nextID++
+		}
+	}
+	for start := 0; start < len(entities); start += entityImportChunkSize {
+		end := start + entityImportChunkSize
+		if end > len(entities) {
+			end = len(entities)
+		}
+		if _, err := g.PutMulti(entities[start:end]); err != nil {
+			log.Errorf(ctx, "Failed to put Entity: %v", err)
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		// Tasks enqueued again on retries are ignored
+		// once the reminder is fired.
+		if err := enqueueEntityReminders(ctx, entities[start:end]); err != nil {
+			log.Errorf(ctx, "Failed to enqueue reminders: %v", err)
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	imp.Status = entityImportStatusDone
+	imp.Imported = len(entities)
+	imp.FinishedAt = time.Now().UTC()
+	if _, err := g.Put(imp); err != nil {
+		log.Errorf(ctx, "Failed to put EntityImport: %v", err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	result.Imported = imp.Imported
+	return c.JSON(http.StatusOK, result)
+}
+
+// beginEntityImport returns the EntityImport for key,
+// creating it and allocating IDs for new entities if not exists.
+func beginEntityImport(ctx context.Context, g *goon.Goon, key, contentHash string, entities []*Entity) (*EntityImport, error) {
+	newCount := 0
+	for _, entity := range entities {
+		if entity.ID == 0 {
+			newCount++
+		}
+	}
+
+	imp := &EntityImport{ID: key}
+	err := g.RunInTransaction(func(tg *goon.Goon) error {
+		if err := tg.Get(imp); err == nil {
+			if imp.ContentHash != contentHash {
+				return errEntityImportConflict
+			}
+			return nil
+		} else if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		imp.ContentHash = contentHash
+		imp.Status = entityImportStatusRunning
+		imp.Total = len(entities)
+		imp.CreatedAt = time.Now().UTC()
+		if newCount > 0 {
+			low, _, err := datastore.AllocateIDs(ctx, "Entity", nil, newCount)
+			if err != nil {
+				return err
+			}
+			imp.IDLow = low
+		}
+		_, err := tg.Put(imp)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
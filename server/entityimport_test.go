@@ -0,0 +1,261 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ikedam/gaetest/testutil"
+	"github.com/labstack/echo"
+
+	"google.golang.org/appengine/aetest"
+	"google.golang.org/appengine/datastore"
+)
+
+func callHandlerEntityImportPost(t *testing.T, inst aetest.Instance, query string, data string, key string) (*httptest.ResponseRecorder, error) {
+	req, err := inst.NewRequest("POST", "/entity/import?"+query, bytes.NewReader([]byte(data)))
+	if err != nil {
+		panic(err)
+	}
+	if key != "" {
+		req.Header.Add("Idempotency-Key", key)
+	}
+
+	e := echo.New()
+	res := httptest.NewRecorder()
+
+	return res, handlerEntityImportPost(e.NewContext(req, res))
+}
+
+func clearEntityForImport(t *testing.T, inst aetest.Instance) {
+	ctx := testutil.GetAppengineContextFor(inst)
+	for _, kind := range []string{"Entity", "EntityImport"} {
+		if keyList, err := datastore.NewQuery(kind).KeysOnly().GetAll(ctx, nil); err != nil {
+			panic(err)
+		} else {
+			if err := datastore.DeleteMulti(ctx, keyList); err != nil {
+				panic(err)
+			}
+		}
+	}
+	testutil.FlushGoonCache(ctx)
+}
+
+func getAllEntityForImport(t *testing.T, inst aetest.Instance) []Entity {
+	ctx := testutil.GetAppengineContextFor(inst)
+	var entityList []Entity
+	if _, err := datastore.NewQuery("Entity").Order("CreatedAt").GetAll(ctx, &entityList); err != nil {
+		panic(err)
+	}
+	return entityList
+}
+
+func parseEntityImportResult(t *testing.T, res *httptest.ResponseRecorder) *entityImportResult {
+	var result entityImportResult
+	if err := json.Unmarshal(res.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse: %v", res.Body.String())
+	}
+	return &result
+}
+
+const entityImportTestCSV = "name,scheduledDate,createdAt\n" +
+	"test1,2018-01-01T00:00:00Z,2017-01-01T00:00:00Z\n" +
+	"test2,,2017-01-02T00:00:00Z\n" +
+	"test3,2018-01-03T00:00:00Z,2017-01-03T00:00:00Z\n"
+
+func TestEntityImportCSV(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForImport(t, inst)
+
+	origChunkSize := entityImportChunkSize
+	entityImportChunkSize = 2
+	defer func() {
+		entityImportChunkSize = origChunkSize
+	}()
+
+	res, err := callHandlerEntityImportPost(t, inst, "format=csv", entityImportTestCSV, "")
+	if err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+	result := parseEntityImportResult(t, res)
+	expectEquals(t, 3, result.Total)
+	expectEquals(t, 3, result.Imported)
+	expectEquals(t, false, result.Replayed)
+
+	entityList := getAllEntityForImport(t, inst)
+	if len(entityList) != 3 {
+		t.Fatalf("Expect 3 records, but was %v", entityList)
+	}
+	expectEquals(t, "test1", entityList[0].Name)
+	if !entityList[0].ScheduledDate.Equal(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expect 2018-01-01, but was %v", entityList[0].ScheduledDate)
+	}
+	expectEquals(t, "test2", entityList[1].Name)
+	if !entityList[1].ScheduledDate.IsZero() {
+		t.Errorf("Expect zero, but was %v", entityList[1].ScheduledDate)
+	}
+	expectEquals(t, "test3", entityList[2].Name)
+}
+
+func TestEntityImportReminder(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForImport(t, inst)
+
+	// 未来の ScheduledDate (ETA の上限より先も含む) のリマインダーが登録される
+	scheduledDate := time.Now().AddDate(1, 0, 0).UTC()
+	data := "name,scheduledDate\n" +
+		"test1," + time.Now().AddDate(0, 0, 1).UTC().Format(time.RFC3339) + "\n" +
+		"test2," + scheduledDate.Format(time.RFC3339) + "\n"
+	res, err := callHandlerEntityImportPost(t, inst, "format=csv", data, "")
+	if err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+	expectEquals(t, 2, parseEntityImportResult(t, res).Imported)
+}
+
+func TestEntityImportNDJSON(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForImport(t, inst)
+
+	data := `{"name": "test1", "scheduledDate": "2018-01-01T00:00:00Z", "createdAt": "2017-01-01T00:00:00Z"}` + "\n" +
+		"\n" +
+		`{"name": "test2", "createdAt": "2017-01-02T00:00:00Z"}` + "\n"
+	res, err := callHandlerEntityImportPost(t, inst, "format=ndjson", data, "")
+	if err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+	result := parseEntityImportResult(t, res)
+	expectEquals(t, 2, result.Imported)
+
+	entityList := getAllEntityForImport(t, inst)
+	if len(entityList) != 2 {
+		t.Fatalf("Expect 2 records, but was %v", entityList)
+	}
+	expectEquals(t, "test1", entityList[0].Name)
+	expectEquals(t, "test2", entityList[1].Name)
+}
+
+func TestEntityImportDryRun(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForImport(t, inst)
+
+	res, err := callHandlerEntityImportPost(t, inst, "dryRun=true", entityImportTestCSV, "")
+	if err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+	result := parseEntityImportResult(t, res)
+	expectEquals(t, true, result.DryRun)
+	expectEquals(t, 3, result.Total)
+	expectEquals(t, 0, result.Imported)
+
+	if entityList := getAllEntityForImport(t, inst); len(entityList) != 0 {
+		t.Errorf("Expect nothing imported, but was %v", entityList)
+	}
+}
+
+func TestEntityImportRowErrors(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForImport(t, inst)
+
+	data := "id,name,scheduledDate\n" +
+		"abc,test1,\n" +
+		"0,,2018-01-01\n" +
+		"0,test3,2018-01-03T00:00:00Z\n"
+	res, err := callHandlerEntityImportPost(t, inst, "", data, "")
+	if err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, but %v: %v", res.Code, res.Body.String())
+	}
+	result := parseEntityImportResult(t, res)
+	if len(result.Errors) != 3 {
+		t.Fatalf("Expect 3 errors, but was %v", res.Body.String())
+	}
+	expectEquals(t, 1, result.Errors[0].Row)
+	expectEquals(t, "invalid id: abc", result.Errors[0].Message)
+	expectEquals(t, 2, result.Errors[1].Row)
+	expectEquals(t, "name is required", result.Errors[1].Message)
+	expectEquals(t, 2, result.Errors[2].Row)
+	expectEquals(t, "invalid scheduledDate: 2018-01-01", result.Errors[2].Message)
+
+	if entityList := getAllEntityForImport(t, inst); len(entityList) != 0 {
+		t.Errorf("Expect nothing imported, but was %v", entityList)
+	}
+}
+
+func TestEntityImportIdempotent(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForImport(t, inst)
+
+	for i := 0; i < 2; i++ {
+		res, err := callHandlerEntityImportPost(t, inst, "", entityImportTestCSV, "")
+		if err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		}
+		if res.Code != http.StatusOK {
+			t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+		}
+		result := parseEntityImportResult(t, res)
+		expectEquals(t, 3, result.Imported)
+		expectEquals(t, i != 0, result.Replayed)
+	}
+
+	if entityList := getAllEntityForImport(t, inst); len(entityList) != 3 {
+		t.Errorf("Expect 3 records, but was %v", entityList)
+	}
+
+	// 同じキーで異なるファイルはエラー
+	if res, err := callHandlerEntityImportPost(t, inst, "", entityImportTestCSV, "key1"); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+	if res, err := callHandlerEntityImportPost(t, inst, "", "name\ntest4\n", "key1"); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusConflict {
+		t.Errorf("Expected 409, but %v: %v", res.Code, res.Body.String())
+	}
+}
+
+func TestEntityImportBadParameters(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+
+	for _, query := range []string{
+		"format=xml",
+		"dryRun=maybe",
+	} {
+		if res, err := callHandlerEntityImportPost(t, inst, query, entityImportTestCSV, ""); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		} else if res.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %v, but %v", query, res.Code)
+		}
+	}
+
+	for _, data := range []string{
+		"",
+		"name,unknown\ntest1,x\n",
+		"id,createdAt\n1,2017-01-01T00:00:00Z\n",
+	} {
+		if res, err := callHandlerEntityImportPost(t, inst, "", data, ""); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		} else if res.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %v, but %v", data, res.Code)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package server
+
+// Entity のインデックスの再作成
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mjibson/goon"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/taskqueue"
+)
+
+const (
+	// entityReindexAdminPath is the path for administrators to start the run.
+	entityReindexAdminPath = "/admin/entity-reindex"
+	// entityReindexTaskPath is the path of the handler for chained tasks.
+	entityReindexTaskPath = "/internal/task/entity-reindex"
+	// entityReindexQueue is the queue for chained tasks.
+	// "" stands for the default queue.
+	entityReindexQueue = ""
+	// entityReindexRunID is the ID of the run.
+	// Change it to run the reindex again for another migration.
+	entityReindexRunID = "scheduled-date-index"
+
+	entityReindexStatusRunning = "running"
+	entityReindexStatusDone    = "done"
+)
+
+var (
+	// entityReindexBatchSize is the number of entities put in a transaction,
+	// which is limited to 25 entity groups.
+	entityReindexBatchSize = 25
+
+	// entityReindexTimeBudget is how long a request processes batches
+	// before handing the rest over to the next task.
+	entityReindexTimeBudget = 30 * time.Second
+)
+
+// handlerAdminEntityReindexGet returns the status of the reindex run.
+func handlerAdminEntityReindexGet(c echo.Context) error {
+	ctx := appengine.NewContext(c.Request())
+	g := goon.FromContext(ctx)
+
+	run := &EntityReindexRun{ID: entityReindexRunID}
+	if err := g.Get(run); err == datastore.ErrNoSuchEntity {
+		return c.String(http.StatusNotFound, "Not started")
+	} else if err != nil {
+		log.Errorf(ctx, "Failed to get EntityReindexRun: %v", err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, run)
+}
+
+// handlerAdminEntityReindexPost starts re-putting all entities
+// so that entities stored before ScheduledDate was indexed
+// are found by the cleanup.
+// This is a one-time migration started by an administrator
+// after deploying, and does nothing once the run is started.
+func handlerAdminEntityReindexPost(c echo.Context) error {
+	ctx := appengine.NewContext(c.Request())
+	g := goon.FromContext(ctx)
+
+	run := &EntityReindexRun{ID: entityReindexRunID}
+	started := false
+	err := g.RunInTransaction(func(tg *goon.Goon) error {
+		started = false
+		if err := tg.Get(run); err == nil {
+			return nil
+		} else if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		started = true
+		run.Status = entityReindexStatusRunning
+		run.StartedAt = time.Now().UTC()
+		if _, err := tg.Put(run); err != nil {
+			return err
+		}
+		// Added only when the run is stored.
+		task := taskqueue.NewPOSTTask(entityReindexTaskPath, url.Values{
+			"run": []string{run.ID},
+			"seq": []string{"0"},
+		})
+		_, err := taskqueue.Add(tg.Context, task, entityReindexQueue)
+		return err
+	}, nil)
+	if err != nil {
+		log.Errorf(ctx, "Failed to start EntityReindexRun: %v", err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if !started {
+		log.Infof(ctx, "Reindex run %v is already started: %v", run.ID, run.Status)
+		return c.JSON(http.StatusOK, run)
+	}
+	log.Infof(ctx, "Started reindex run %v", run.ID)
+	return c.JSON(http.StatusAccepted, run)
+}
+
+// handlerInternalEntityReindexPost processes the reindex run.
+// Called by the task added on start and ones chained from the previous request.
+func handlerInternalEntityReindexPost(c echo.Context) error {
+	ctx := appengine.NewContext(c.Request())
+	g := goon.FromContext(ctx)
+
+	run := &EntityReindexRun{ID: c.FormValue("run")}
+	if run.ID == "" {
+		log.Errorf(ctx, "Invalid reindex task: run is not specified")
+		return c.NoContent(http.StatusOK)
+	}
+	seq, err := strconv.Atoi(c.FormValue("seq"))
+	if err != nil {
+		log.Errorf(ctx, "Invalid reindex task: seq=%v: %v", c.FormValue("seq"), err)
+		return c.NoContent(http.StatusOK)
+	}
+	var cursor *datastore.Cursor
+	if v := c.FormValue("cursor"); v != "" {
+		if _cursor, err := datastore.DecodeCursor(v); err == nil {
+			cursor = &_cursor
+		} else {
+			log.Errorf(ctx, "Invalid reindex task: cursor=%v: %v", v, err)
+			return c.NoContent(http.StatusOK)
+		}
+	}
+
+	if err := g.Get(run); err == datastore.ErrNoSuchEntity {
+		log.Errorf(ctx, "Invalid reindex task: run %v does not exist", run.ID)
+		return c.NoContent(http.StatusOK)
+	} else if err != nil {
+		log.Errorf(ctx, "Failed to get EntityReindexRun: %v", err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if run.Status == entityReindexStatusDone {
+		log.Infof(ctx, "Reindex run %v is already done", run.ID)
+		return c.NoContent(http.StatusOK)
+	}
+	return processEntityReindex(ctx, c, g, run, cursor, seq)
+}
+
+// processEntityReindex re-puts entities in batches
+// until no entities are left or the time budget runs out.
+// In the latter case, it chains a task to process the rest.
+func processEntityReindex(ctx context.Context, c echo.Context, g *goon.Goon, run *EntityReindexRun, cursor *datastore.Cursor, seq int) error {
+	start := time.Now()
+	run.Requests++
+	for {
+		next, reindexed, err := reindexEntityBatch(ctx, g, cursor)
+		if err != nil {
+			log.Errorf(ctx, "Failed to reindex Entity: %v", err)
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		run.Reindexed += reindexed
+		cursor = next
+		if cursor == nil {
+			break
+		}
+		if time.Since(start) > entityReindexTimeBudget {
+			if err := chainEntityReindex(ctx, run, cursor, seq+1); err != nil {
+				log.Errorf(ctx, "Failed to chain reindex task: %v", err)
+				return c.String(http.StatusInternalServerError, err.Error())
+			}
+			break
+		}
+	}
+	if cursor == nil {
+		run.Status = entityReindexStatusDone
+		run.FinishedAt = time.Now().UTC()
+	}
+	if _, err := g.Put(run); err != nil {
+		log.Errorf(ctx, "Failed to put EntityReindexRun: %v", err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	log.Infof(ctx, "Reindex run %v: reindexed %v entities in total (%v)", run.ID, run.Reindexed, run.Status)
+	return c.NoContent(http.StatusOK)
+}
+
+// reindexEntityBatch re-puts a batch of entities with current indexes.
+// Entities are got and put in a transaction
+// not to overwrite entities updated meanwhile.
+// Returns the cursor to the next batch, or nil if this is the last batch.
+func reindexEntityBatch(ctx context.Context, g *goon.Goon, cursor *datastore.Cursor) (*datastore.Cursor, int, error) {
+	q := datastore.NewQuery("Entity").KeysOnly().Limit(entityReindexBatchSize)
+	if cursor != nil {
+		q = q.Start(*cursor)
+	}
+	it := q.Run(ctx)
+	entities := []*Entity{}
+	for {
+		key, err := it.Next(nil)
+		if err == datastore.Done {
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+		entities = append(entities, &Entity{ID: key.IntID()})
+	}
+	if len(entities) == 0 {
+		return nil, 0, nil
+	}
+
+	reindexed := 0
+	err := g.RunInTransaction(func(tg *goon.Goon) error {
+		found := make([]*Entity, 0, len(entities))
+		if err := tg.GetMulti(entities); err != nil {
+			merr, ok := err.(appengine.MultiError)
+			if !ok {
+				return err
+			}
+			for idx, err := range merr {
+				if err == nil {
+					found = append(found, entities[idx])
+				} else if err != datastore.ErrNoSuchEntity {
+					return err
+				}
+			}
+		} else {
+			found = entities
+		}
+		reindexed = len(found)
+		if len(found) == 0 {
+			return nil
+		}
+		_, err := tg.PutMulti(found)
+		return err
+	}, &datastore.TransactionOptions{XG: true})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(entities) < entityReindexBatchSize {
+		return nil, reindexed, nil
+	}
+	next, err := it.Cursor()
+	if err != nil {
+		return nil, 0, err
+	}
+	return &next, reindexed, nil
+}
+
+// chainEntityReindex adds a task to resume the run from cursor.
+// Tasks are named after the run and seq,
+// so a retried request does not chain the same task twice.
+func chainEntityReindex(ctx context.Context, run *EntityReindexRun, cursor *datastore.Cursor, seq int) error {
+	task := taskqueue.NewPOSTTask(entityReindexTaskPath, url.Values{
+		"run":    []string{run.ID},
+		"seq":    []string{strconv.Itoa(seq)},
+		"cursor": []string{cursor.String()},
+	})
+	task.Name = fmt.Sprintf("entity-reindex-%s-%d", run.ID, seq)
+	if _, err := taskqueue.Add(ctx, task, entityReindexQueue); err != nil && err != taskqueue.ErrTaskAlreadyAdded {
+		return err
+	}
+	return nil
+}
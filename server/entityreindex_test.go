@@ -0,0 +1,189 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ikedam/gaetest/testutil"
+	"github.com/labstack/echo"
+
+	"google.golang.org/appengine/aetest"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/user"
+)
+
+// legacyEntity は ScheduledDate にインデックスがなかった頃の Entity です。
+type legacyEntity struct {
+	Name          string    `datastore:",noindex"`
+	ScheduledDate time.Time `datastore:",noindex"`
+	CreatedAt     time.Time `datastore:",noindex"`
+}
+
+func callHandlerAdminEntityReindexPost(t *testing.T, inst aetest.Instance) (*httptest.ResponseRecorder, error) {
+	req, err := inst.NewRequest("POST", entityReindexAdminPath, nil)
+	if err != nil {
+		panic(err)
+	}
+	aetest.Login(&user.User{Email: "admin@example.com", Admin: true}, req)
+
+	e := echo.New()
+	res := httptest.NewRecorder()
+
+	return res, requireAdmin(handlerAdminEntityReindexPost)(e.NewContext(req, res))
+}
+
+func callHandlerInternalEntityReindexPost(t *testing.T, inst aetest.Instance, run string, seq int) (*httptest.ResponseRecorder, error) {
+	form := url.Values{
+		"run": []string{run},
+		"seq": []string{strconv.Itoa(seq)},
+	}
+	req, err := inst.NewRequest("POST", entityReindexTaskPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("X-AppEngine-QueueName", "default")
+
+	e := echo.New()
+	res := httptest.NewRecorder()
+
+	return res, handlerInternalEntityReindexPost(e.NewContext(req, res))
+}
+
+// setupEntityReindexData registers 5 entities without the index of ScheduledDate.
+func setupEntityReindexData(t *testing.T, inst aetest.Instance) {
+	ctx := testutil.GetAppengineContextFor(inst)
+
+	for _, kind := range []string{"Entity", "EntityReindexRun"} {
+		if keyList, err := datastore.NewQuery(kind).KeysOnly().GetAll(ctx, nil); err != nil {
+			panic(err)
+		} else {
+			if err := datastore.DeleteMulti(ctx, keyList); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	keys := []*datastore.Key{}
+	entities := []legacyEntity{}
+	for i := 0; i < 5; i++ {
+		keys = append(keys, datastore.NewIncompleteKey(ctx, "Entity", nil))
+		entities = append(entities, legacyEntity{
+			Name:          fmt.Sprintf("legacy%d", i),
+			ScheduledDate: now.AddDate(0, 0, -1-i),
+			CreatedAt:     now,
+		})
+	}
+	if _, err := datastore.PutMulti(ctx, keys, entities); err != nil {
+		panic(err)
+	}
+
+	testutil.FlushGoonCache(ctx)
+}
+
+func countIndexedEntities(t *testing.T, inst aetest.Instance) int {
+	ctx := testutil.GetAppengineContextFor(inst)
+	count, err := datastore.NewQuery("Entity").Filter("ScheduledDate <", time.Now()).Count(ctx)
+	if err != nil {
+		panic(err)
+	}
+	return count
+}
+
+func TestEntityReindex(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	ctx := testutil.GetAppengineContextFor(inst)
+	setupEntityReindexData(t, inst)
+
+	origBatchSize := entityReindexBatchSize
+	entityReindexBatchSize = 2
+	defer func() {
+		entityReindexBatchSize = origBatchSize
+	}()
+
+	expectEquals(t, 0, countIndexedEntities(t, inst))
+
+	if res, err := callHandlerAdminEntityReindexPost(t, inst); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, but %v: %v", res.Code, res.Body.String())
+	}
+	// 開始時に登録されたタスクの代わりに呼び出す
+	if res, err := callHandlerInternalEntityReindexPost(t, inst, entityReindexRunID, 0); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+
+	expectEquals(t, 5, countIndexedEntities(t, inst))
+
+	var entityList []Entity
+	if _, err := datastore.NewQuery("Entity").GetAll(ctx, &entityList); err != nil {
+		panic(err)
+	}
+	for _, entity := range entityList {
+		if !strings.HasPrefix(entity.Name, "legacy") || entity.ScheduledDate.IsZero() {
+			t.Errorf("Expect the entity is kept as is, but was %v", entity)
+		}
+	}
+
+	run := EntityReindexRun{}
+	key := datastore.NewKey(ctx, "EntityReindexRun", entityReindexRunID, 0, nil)
+	if err := datastore.Get(ctx, key, &run); err != nil {
+		panic(err)
+	}
+	expectEquals(t, entityReindexStatusDone, run.Status)
+	expectEquals(t, 5, run.Reindexed)
+	expectEquals(t, 1, run.Requests)
+
+	// 一度だけ実行される
+	if res, err := callHandlerAdminEntityReindexPost(t, inst); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+	if res, err := callHandlerInternalEntityReindexPost(t, inst, entityReindexRunID, 0); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+	if err := datastore.Get(ctx, key, &run); err != nil {
+		panic(err)
+	}
+	expectEquals(t, 1, run.Requests)
+}
+
+func TestEntityReindexInvalidTask(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+
+	// リトライしても成功しないので 200 を返す
+	for _, run := range []string{"", "no-such-run"} {
+		if res, err := callHandlerInternalEntityReindexPost(t, inst, run, 1); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		} else if res.Code != http.StatusOK {
+			t.Errorf("Expected 200 for %v, but %v", run, res.Code)
+		}
+	}
+}
+
+func TestEntityReindexRequireAdmin(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+
+	req, err := inst.NewRequest("POST", entityReindexAdminPath, nil)
+	if err != nil {
+		panic(err)
+	}
+	aetest.Login(&user.User{Email: "user@example.com"}, req)
+	res := httptest.NewRecorder()
+	if err := requireAdmin(handlerAdminEntityReindexPost)(echo.New().NewContext(req, res)); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	expectEquals(t, http.StatusForbidden, res.Code)
+}
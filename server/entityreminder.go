@@ -0,0 +1,162 @@
+package server
+
+// ScheduledDate のリマインダー
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mjibson/goon"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/taskqueue"
+)
+
+const (
+	// entityReminderPath is the path of the handler for reminder tasks.
+	entityReminderPath = "/internal/entity/reminder"
+	// entityReminderQueue is the queue for reminder tasks.
+	// "" stands for the default queue.
+	entityReminderQueue = ""
+	// entityReminderMaxDelay is the max delay of reminder tasks
+	// as push queues reject ETAs more than 30 days ahead.
+	// Reminders scheduled later are re-enqueued when tasks run.
+	entityReminderMaxDelay = 30*24*time.Hour - time.Hour
+	// entityReminderPrecision is the precision of ScheduledDate in tasks,
+	// as datastore stores times in microseconds.
+	entityReminderPrecision = time.Microsecond
+)
+
+// errEntityReminderSkipped is returned when the reminder task
+// no longer applies to the entity.
+type errEntityReminderSkipped struct {
+	msg string
+}
+
+func (e *errEntityReminderSkipped) Error() string {
+	return e.msg
+}
+
+// newEntityReminderTask creates a task running at entity.ScheduledDate,
+// or at entityReminderMaxDelay after now if ScheduledDate is later.
+// Returns nil if ScheduledDate is not in the future.
+func newEntityReminderTask(entity *Entity, now time.Time) *taskqueue.Task {
+	if entity.ScheduledDate.IsZero() || !entity.ScheduledDate.After(now) {
+		return nil
+	}
+	task := taskqueue.NewPOSTTask(entityReminderPath, url.Values{
+		"id":            []string{strconv.FormatInt(entity.ID, 10)},
+		"scheduledDate": []string{entity.ScheduledDate.Truncate(entityReminderPrecision).UTC().Format(time.RFC3339Nano)},
+	})
+	task.ETA = entity.ScheduledDate
+	if limit := now.Add(entityReminderMaxDelay); task.ETA.After(limit) {
+		task.ETA = limit
+	}
+	return task
+}
+
+// enqueueEntityReminder adds a task running at entity.ScheduledDate.
+// Pass the context of the transaction putting entity
+// so that the task is added only when the entity is stored.
+// Nothing is enqueued if ScheduledDate is not in the future.
+//
+// Tasks are not removed when ScheduledDate is changed.
+// Instead, the task carries ScheduledDate it is for,
+// and is ignored if it does not match the entity any longer.
+func enqueueEntityReminder(ctx context.Context, entity *Entity) error {
+	task := newEntityReminderTask(entity, time.Now())
+	if task == nil {
+		return nil
+	}
+	_, err := taskqueue.Add(ctx, task, entityReminderQueue)
+	return err
+}
+
+// enqueueEntityReminders adds tasks for entities like enqueueEntityReminder
+// at once, not in transactions.
+// entities must be at most 100, the limit of taskqueue.AddMulti.
+func enqueueEntityReminders(ctx context.Context, entities []*Entity) error {
+	now := time.Now()
+	tasks := []*taskqueue.Task{}
+	for _, entity := range entities {
+		if task := newEntityReminderTask(entity, now); task != nil {
+			tasks = append(tasks, task)
+		}
+	}
+	if len(tasks) == 0 {
+		return nil
+	}
+	_, err := taskqueue.AddMulti(ctx, tasks, entityReminderQueue)
+	return err
+}
+
+func handlerInternalEntityReminderPost(c echo.Context) error {
+	ctx := appengine.NewContext(c.Request())
+	g := goon.FromContext(ctx)
+
+	idStr := c.FormValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		// Retrying never succeeds.
+		log.Errorf(ctx, "Invalid reminder task: id=%v: %v", idStr, err)
+		return c.NoContent(http.StatusOK)
+	}
+	dateStr := c.FormValue("scheduledDate")
+	scheduledDate, err := time.Parse(time.RFC3339Nano, dateStr)
+	if err != nil {
+		log.Errorf(ctx, "Invalid reminder task: scheduledDate=%v: %v", dateStr, err)
+		return c.NoContent(http.StatusOK)
+	}
+
+	entity := Entity{ID: id}
+	deferred := false
+	err = g.RunInTransaction(func(tg *goon.Goon) error {
+		deferred = false
+		if err := tg.Get(&entity); err == datastore.ErrNoSuchEntity {
+			return &errEntityReminderSkipped{msg: fmt.Sprintf("entity %v is deleted", id)}
+		} else if err != nil {
+			return err
+		}
+		if !entity.ScheduledDate.Truncate(entityReminderPrecision).Equal(scheduledDate.Truncate(entityReminderPrecision)) {
+			return &errEntityReminderSkipped{
+				msg: fmt.Sprintf("entity %v is rescheduled to %v", id, entity.ScheduledDate),
+			}
+		}
+		if !entity.ReminderFiredAt.IsZero() {
+			return &errEntityReminderSkipped{
+				msg: fmt.Sprintf("entity %v is already fired at %v", id, entity.ReminderFiredAt),
+			}
+		}
+		if time.Now().Before(scheduledDate) {
+			// The task runs early as its ETA is limited.
+			deferred = true
+			return enqueueEntityReminder(tg.Context, &entity)
+		}
+		entity.ReminderFiredAt = time.Now().UTC()
+		_, err := tg.Put(&entity)
+		return err
+	}, nil)
+	if err != nil {
+		if _, ok := err.(*errEntityReminderSkipped); ok {
+			log.Infof(ctx, "Skipped reminder: %v", err)
+			return c.NoContent(http.StatusOK)
+		}
+		// Let the task queue retry.
+		log.Errorf(ctx, "Failed to fire reminder of Entity %v: %v", id, err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if deferred {
+		log.Infof(ctx, "Deferred reminder of Entity %v scheduled at %v", id, scheduledDate)
+		return c.NoContent(http.StatusOK)
+	}
+	log.Infof(ctx, "Fired reminder of Entity %v scheduled at %v", id, scheduledDate)
+	return c.NoContent(http.StatusOK)
+}
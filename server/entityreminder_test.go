@@ -0,0 +1,258 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ikedam/gaetest/testutil"
+	"github.com/labstack/echo"
+
+	"google.golang.org/appengine/aetest"
+	"google.golang.org/appengine/datastore"
+)
+
+func callHandlerInternalEntityReminderPost(t *testing.T, inst aetest.Instance, id int64, scheduledDate time.Time) (*httptest.ResponseRecorder, error) {
+	form := url.Values{
+		"id":            []string{strconv.FormatInt(id, 10)},
+		"scheduledDate": []string{scheduledDate.UTC().Format(time.RFC3339Nano)},
+	}
+	req, err := inst.NewRequest("POST", entityReminderPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("X-AppEngine-QueueName", "default")
+
+	e := echo.New()
+	res := httptest.NewRecorder()
+
+	return res, handlerInternalEntityReminderPost(e.NewContext(req, res))
+}
+
+func putEntityForReminder(t *testing.T, inst aetest.Instance, entity *Entity) int64 {
+	ctx := testutil.GetAppengineContextFor(inst)
+	key, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, "Entity", nil), entity)
+	if err != nil {
+		panic(err)
+	}
+	testutil.FlushGoonCache(ctx)
+	return key.IntID()
+}
+
+func getEntityForReminder(t *testing.T, inst aetest.Instance, id int64) *Entity {
+	ctx := testutil.GetAppengineContextFor(inst)
+	var entity Entity
+	if err := datastore.Get(ctx, datastore.NewKey(ctx, "Entity", "", id, nil), &entity); err != nil {
+		panic(err)
+	}
+	return &entity
+}
+
+func TestEntityReminderFire(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	scheduledDate := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	id := putEntityForReminder(t, inst, &Entity{
+		Name:          "test1",
+		ScheduledDate: scheduledDate,
+		CreatedAt:     time.Now().UTC(),
+	})
+
+	if res, err := callHandlerInternalEntityReminderPost(t, inst, id, scheduledDate); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	firedAt := getEntityForReminder(t, inst, id).ReminderFiredAt
+	if firedAt.IsZero() {
+		t.Fatalf("Expect fired, but not")
+	}
+
+	// 二重に実行されない
+	if res, err := callHandlerInternalEntityReminderPost(t, inst, id, scheduledDate); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	if actual := getEntityForReminder(t, inst, id).ReminderFiredAt; !actual.Equal(firedAt) {
+		t.Errorf("Expect %v, but was %v", firedAt, actual)
+	}
+}
+
+func TestEntityReminderDeferred(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	scheduledDate := time.Now().AddDate(0, 0, 60).UTC()
+	id := putEntityForReminder(t, inst, &Entity{
+		Name:          "test1",
+		ScheduledDate: scheduledDate,
+		CreatedAt:     time.Now().UTC(),
+	})
+
+	// ETA の上限で早く実行されたタスクは再登録され、発火しない
+	if res, err := callHandlerInternalEntityReminderPost(t, inst, id, scheduledDate); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	if firedAt := getEntityForReminder(t, inst, id).ReminderFiredAt; !firedAt.IsZero() {
+		t.Errorf("Expect not fired, but fired at %v", firedAt)
+	}
+}
+
+func TestNewEntityReminderTask(t *testing.T) {
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if task := newEntityReminderTask(&Entity{ID: 1}, now); task != nil {
+		t.Errorf("Expect no task for zero, but %v", task)
+	}
+	if task := newEntityReminderTask(&Entity{ID: 1, ScheduledDate: now}, now); task != nil {
+		t.Errorf("Expect no task for now, but %v", task)
+	}
+
+	scheduledDate := now.AddDate(0, 0, 1)
+	task := newEntityReminderTask(&Entity{ID: 1, ScheduledDate: scheduledDate}, now)
+	expectEquals(t, entityReminderPath, task.Path)
+	expectEquals(t, scheduledDate, task.ETA)
+
+	// 30 日より先の ETA は制限される
+	task = newEntityReminderTask(&Entity{ID: 1, ScheduledDate: now.AddDate(1, 0, 0)}, now)
+	expectEquals(t, now.Add(entityReminderMaxDelay), task.ETA)
+
+	// データストアと同じくマイクロ秒に切り捨てる
+	task = newEntityReminderTask(&Entity{ID: 1, ScheduledDate: scheduledDate.Add(1234 * time.Nanosecond)}, now)
+	form, err := url.ParseQuery(string(task.Payload))
+	if err != nil {
+		t.Fatalf("Failed to parse the payload: %v", err)
+	}
+	expectEquals(t, "2018-01-02T00:00:00.000001Z", form.Get("scheduledDate"))
+}
+
+func TestEntityReminderNanosecond(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	// データストアにはマイクロ秒までしか保存されない
+	scheduledDate := time.Date(2018, 1, 1, 0, 0, 0, 1234, time.UTC)
+	id := putEntityForReminder(t, inst, &Entity{
+		Name:          "test1",
+		ScheduledDate: scheduledDate,
+		CreatedAt:     time.Now().UTC(),
+	})
+
+	if res, err := callHandlerInternalEntityReminderPost(t, inst, id, scheduledDate); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	if firedAt := getEntityForReminder(t, inst, id).ReminderFiredAt; firedAt.IsZero() {
+		t.Errorf("Expect fired, but not")
+	}
+}
+
+func TestEntityReminderRescheduled(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	id := putEntityForReminder(t, inst, &Entity{
+		Name:          "test1",
+		ScheduledDate: time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC),
+		CreatedAt:     time.Now().UTC(),
+	})
+
+	if res, err := callHandlerInternalEntityReminderPost(t, inst, id, time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	if firedAt := getEntityForReminder(t, inst, id).ReminderFiredAt; !firedAt.IsZero() {
+		t.Errorf("Expect not fired, but fired at %v", firedAt)
+	}
+}
+
+func TestEntityReminderDeleted(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	ctx := testutil.GetAppengineContextFor(inst)
+	scheduledDate := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	id := putEntityForReminder(t, inst, &Entity{
+		Name:          "test1",
+		ScheduledDate: scheduledDate,
+		CreatedAt:     time.Now().UTC(),
+	})
+	if err := datastore.Delete(ctx, datastore.NewKey(ctx, "Entity", "", id, nil)); err != nil {
+		panic(err)
+	}
+	testutil.FlushGoonCache(ctx)
+
+	if res, err := callHandlerInternalEntityReminderPost(t, inst, id, scheduledDate); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Errorf("Expected 200, but %v", res.Code)
+	}
+}
+
+func TestEntityReminderResetOnPut(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	id := putEntityForReminder(t, inst, &Entity{
+		Name:            "test1",
+		ScheduledDate:   time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		CreatedAt:       time.Now().UTC(),
+		ReminderFiredAt: time.Date(2018, 1, 1, 0, 0, 1, 0, time.UTC),
+	})
+
+	// 日付を変更しなければリセットされない
+	if res, err := callHandlerEntityPut(t, inst, id, &struct {
+		Name          string    `json:"name"`
+		ScheduledDate time.Time `json:"scheduledDate"`
+	}{
+		Name:          "test1.1",
+		ScheduledDate: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+	}); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	if firedAt := getEntityForReminder(t, inst, id).ReminderFiredAt; firedAt.IsZero() {
+		t.Errorf("Expect not reset, but reset")
+	}
+
+	if res, err := callHandlerEntityPut(t, inst, id, &struct {
+		Name          string    `json:"name"`
+		ScheduledDate time.Time `json:"scheduledDate"`
+	}{
+		Name:          "test1.2",
+		ScheduledDate: time.Now().AddDate(0, 0, 1).UTC(),
+	}); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	if firedAt := getEntityForReminder(t, inst, id).ReminderFiredAt; !firedAt.IsZero() {
+		t.Errorf("Expect reset, but was %v", firedAt)
+	}
+}
+
+func TestRequireInternalRequest(t *testing.T) {
+	e := echo.New()
+	handler := requireInternalRequest(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("POST", entityReminderPath, nil)
+	res := httptest.NewRecorder()
+	if err := handler(e.NewContext(req, res)); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected 403, but %v", res.Code)
+	}
+
+	req = httptest.NewRequest("POST", entityReminderPath, nil)
+	req.Header.Add("X-AppEngine-QueueName", "default")
+	res = httptest.NewRecorder()
+	if err := handler(e.NewContext(req, res)); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	}
+	if res.Code != http.StatusOK {
+		t.Errorf("Expected 200, but %v", res.Code)
+	}
+}
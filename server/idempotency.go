@@ -0,0 +1,298 @@
+package server
+
+// Idempotency-Key によるリクエストの重複実行の防止
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mjibson/goon"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/memcache"
+	"google.golang.org/appengine/user"
+)
+
+const (
+	// headerIdempotencyKey is the request header to specify the idempotency key.
+	headerIdempotencyKey = "Idempotency-Key"
+	// headerIdempotentReplayed is the response header
+	// set when the response is the stored one.
+	headerIdempotentReplayed = "Idempotent-Replayed"
+
+	idempotencyStatusProcessing = "processing"
+	idempotencyStatusDone       = "done"
+
+	idempotencyKeyMaxLength = 255
+)
+
+var (
+	// idempotencyTTL is how long the stored responses are replayed.
+	idempotencyTTL = 24 * time.Hour
+
+	// idempotencyLockTimeout is how long a request being processed
+	// blocks other requests with the same key.
+	// This is for the case the instance dies while processing.
+	idempotencyLockTimeout = time.Minute
+
+	// idempotencyCleanupBatchSize is the number of expired records deleted at once.
+	idempotencyCleanupBatchSize = 500
+
+	// idempotencyCleanupTimeBudget is how long a cron request deletes expired records.
+	idempotencyCleanupTimeBudget = 30 * time.Second
+)
+
+// errIdempotency is an error for the idempotency key
+// which should be responded to the client as it is.
+type errIdempotency struct {
+	code int
+	msg  string
+}
+
+func (e *errIdempotency) Error() string {
+	return e.msg
+}
+
+// idempotencyScope returns the scope of idempotency keys,
+// which is the principal of the request:
+// u signed in with Google Accounts (user.Current), or the credentials in Authorization header.
+// Requests without principals are scoped in the endpoint,
+// where clients must use keys unique among all clients like UUIDs.
+func idempotencyScope(u *user.User, req *http.Request) string {
+	if u != nil {
+		if u.ID != "" {
+			return "user:" + u.ID
+		}
+		return "email:" + u.Email
+	}
+	if auth := req.Header.Get(echo.HeaderAuthorization); auth != "" {
+		hash := sha256.Sum256([]byte(auth))
+		return "auth:" + hex.EncodeToString(hash[:])
+	}
+	return "endpoint:" + req.Method + " " + req.URL.Path
+}
+
+func idempotencyRecordID(scope, key string) string {
+	hash := sha256.Sum256([]byte(scope + "\x00" + key))
+	return hex.EncodeToString(hash[:])
+}
+
+func idempotencyMemcacheKey(id string) string {
+	return "idempotency:" + id
+}
+
+// idempotencyRequestHash returns the hash to detect
+// the same key reused for another request.
+func idempotencyRequestHash(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\x00", req.Method, req.URL.Path)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotencyResponseRecorder captures the response body
+// passed to the original writer.
+type idempotencyResponseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *idempotencyResponseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent is a middleware to store the first response for the request
+// with Idempotency-Key header, and to replay it for retries with the same key
+// by the same client in idempotencyTTL.
+// Expired records are deleted by handlerInternalIdempotencyCleanupGet.
+// Requests without the header are processed as usual.
+// Responses with 5xx are not stored so that the client can retry.
+func idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get(headerIdempotencyKey)
+		if key == "" {
+			return next(c)
+		}
+
+		ctx := appengine.NewContext(c.Request())
+		if len(key) > idempotencyKeyMaxLength {
+			log.Warningf(ctx, "Invalid request: too long %v", headerIdempotencyKey)
+			return c.String(
+				http.StatusBadRequest,
+				fmt.Sprintf("%v must be at most %v characters", headerIdempotencyKey, idempotencyKeyMaxLength),
+			)
+		}
+
+		body, err := ioutil.ReadAll(c.Request().Body)
+		if err != nil {
+			log.Warningf(ctx, "Failed to read request: %v", err)
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		c.Request().Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		g := goon.FromContext(ctx)
+		record := &IdempotencyRecord{
+			ID: idempotencyRecordID(idempotencyScope(user.Current(ctx), c.Request()), key),
+		}
+		requestHash := idempotencyRequestHash(c.Request(), body)
+
+		stored, err := acquireIdempotencyRecord(ctx, g, record, requestHash)
+		if e, ok := err.(*errIdempotency); ok {
+			log.Warningf(ctx, "Rejected %v %v: %v", headerIdempotencyKey, key, err)
+			return c.String(e.code, e.msg)
+		} else if err != nil {
+			log.Errorf(ctx, "Failed to acquire IdempotencyRecord: %v", err)
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		if stored {
+			log.Debugf(ctx, "Replaying the response for %v %v", headerIdempotencyKey, key)
+			c.Response().Header().Set(headerIdempotentReplayed, "true")
+			return c.Blob(record.StatusCode, record.ContentType, record.Body)
+		}
+
+		res := c.Response()
+		recorder := &idempotencyResponseRecorder{ResponseWriter: res.Writer}
+		res.Writer = recorder
+		err = next(c)
+		res.Writer = recorder.ResponseWriter
+
+		if err != nil || res.Status >= http.StatusInternalServerError {
+			// Release the key so that the client can retry.
+			if err := g.Delete(g.Key(record)); err != nil {
+				log.Errorf(ctx, "Failed to delete IdempotencyRecord: %v", err)
+			}
+			return err
+		}
+
+		now := time.Now().UTC()
+		record.Status = idempotencyStatusDone
+		record.StatusCode = res.Status
+		record.ContentType = res.Header().Get(echo.HeaderContentType)
+		record.Body = recorder.body.Bytes()
+		record.ExpiresAt = now.Add(idempotencyTTL)
+		if _, err := g.Put(record); err != nil {
+			// The response is already sent.
+			log.Errorf(ctx, "Failed to put IdempotencyRecord: %v", err)
+			return nil
+		}
+		if err := memcache.JSON.Set(ctx, &memcache.Item{
+			Key:        idempotencyMemcacheKey(record.ID),
+			Object:     record,
+			Expiration: idempotencyTTL,
+		}); err != nil {
+			log.Warningf(ctx, "Failed to cache IdempotencyRecord: %v", err)
+		}
+		return nil
+	}
+}
+
+// acquireIdempotencyRecord loads the stored response to record
+// and returns true if available.
+// Otherwise, it marks record as processing and returns false.
+func acquireIdempotencyRecord(ctx context.Context, g *goon.Goon, record *IdempotencyRecord, requestHash string) (bool, error) {
+	now := time.Now().UTC()
+
+	var cached IdempotencyRecord
+	if _, err := memcache.JSON.Get(ctx, idempotencyMemcacheKey(record.ID), &cached); err == nil {
+		if cached.RequestHash != requestHash {
+			return false, &errIdempotency{
+				code: http.StatusUnprocessableEntity,
+				msg:  fmt.Sprintf("%v is already used for another request", headerIdempotencyKey),
+			}
+		}
+		if cached.Status == idempotencyStatusDone && now.Before(cached.ExpiresAt) {
+			*record = cached
+			return true, nil
+		}
+	} else if err != memcache.ErrCacheMiss {
+		log.Warningf(ctx, "Failed to get IdempotencyRecord from memcache: %v", err)
+	}
+
+	stored := false
+	err := g.RunInTransaction(func(tg *goon.Goon) error {
+		current := &IdempotencyRecord{ID: record.ID}
+		if err := tg.Get(current); err == nil && now.Before(current.ExpiresAt) {
+			if current.RequestHash != requestHash {
+				return &errIdempotency{
+					code: http.StatusUnprocessableEntity,
+					msg:  fmt.Sprintf("%v is already used for another request", headerIdempotencyKey),
+				}
+			}
+			if current.Status != idempotencyStatusDone {
+				return &errIdempotency{
+					code: http.StatusConflict,
+					msg:  fmt.Sprintf("the request with the same %v is being processed", headerIdempotencyKey),
+				}
+			}
+			*record = *current
+			stored = true
+			return nil
+		} else if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		// Not exists or expired.
+		*record = IdempotencyRecord{
+			ID:          record.ID,
+			Status:      idempotencyStatusProcessing,
+			RequestHash: requestHash,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(idempotencyLockTimeout),
+		}
+		_, err := tg.Put(record)
+		return err
+	}, nil)
+	return stored, err
+}
+
+// handlerInternalIdempotencyCleanupGet deletes expired IdempotencyRecord.
+// Called by cron.
+// Records left after idempotencyCleanupTimeBudget are deleted in the next run.
+func handlerInternalIdempotencyCleanupGet(c echo.Context) error {
+	ctx := appengine.NewContext(c.Request())
+	g := goon.FromContext(ctx)
+
+	start := time.Now()
+	now := start.UTC()
+	deleted := 0
+	for {
+		keys, err := g.GetAll(
+			datastore.NewQuery("IdempotencyRecord").
+				Filter("ExpiresAt <", now).
+				KeysOnly().
+				Limit(idempotencyCleanupBatchSize),
+			nil,
+		)
+		if err != nil {
+			log.Errorf(ctx, "Failed to query IdempotencyRecord: %v", err)
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		if len(keys) == 0 {
+			break
+		}
+		if err := g.DeleteMulti(keys); err != nil {
+			log.Errorf(ctx, "Failed to delete IdempotencyRecord: %v", err)
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		deleted += len(keys)
+		if len(keys) < idempotencyCleanupBatchSize {
+			break
+		}
+		if time.Since(start) > idempotencyCleanupTimeBudget {
+			log.Infof(ctx, "Expired IdempotencyRecord are left for the next run")
+			break
+		}
+	}
+	log.Infof(ctx, "Deleted %v expired IdempotencyRecord", deleted)
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ikedam/gaetest/testutil"
+	"github.com/labstack/echo"
+
+	"google.golang.org/appengine/aetest"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/user"
+)
+
+func callHandlerEntityPostIdempotent(t *testing.T, inst aetest.Instance, key string, data string) (*httptest.ResponseRecorder, error) {
+	req, err := inst.NewRequest("POST", "/entity/", bytes.NewReader([]byte(data)))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Add(headerIdempotencyKey, key)
+	}
+
+	e := echo.New()
+	res := httptest.NewRecorder()
+
+	return res, idempotent(handlerEntityPost)(e.NewContext(req, res))
+}
+
+func clearEntityForIdempotency(t *testing.T, inst aetest.Instance) {
+	ctx := testutil.GetAppengineContextFor(inst)
+	for _, kind := range []string{"Entity", "IdempotencyRecord"} {
+		if keyList, err := datastore.NewQuery(kind).KeysOnly().GetAll(ctx, nil); err != nil {
+			panic(err)
+		} else {
+			if err := datastore.DeleteMulti(ctx, keyList); err != nil {
+				panic(err)
+			}
+		}
+	}
+	testutil.FlushGoonCache(ctx)
+}
+
+func countEntityForIdempotency(t *testing.T, inst aetest.Instance) int {
+	ctx := testutil.GetAppengineContextFor(inst)
+	count, err := datastore.NewQuery("Entity").Count(ctx)
+	if err != nil {
+		panic(err)
+	}
+	return count
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	ctx := testutil.GetAppengineContextFor(inst)
+	clearEntityForIdempotency(t, inst)
+
+	var first Entity
+	if res, err := callHandlerEntityPostIdempotent(t, inst, "key1", `{"name": "Testdata1"}`); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	} else {
+		if err := json.Unmarshal(res.Body.Bytes(), &first); err != nil {
+			t.Fatalf("Failed to parse: %v", res.Body.String())
+		}
+		expectEquals(t, "", res.Header().Get(headerIdempotentReplayed))
+	}
+
+	// 2回目はデータストアから、3回目は memcache から返る
+	for i := 0; i < 2; i++ {
+		if i == 0 {
+			testutil.FlushGoonCache(ctx)
+		}
+		if res, err := callHandlerEntityPostIdempotent(t, inst, "key1", `{"name": "Testdata1"}`); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		} else if res.Code != http.StatusOK {
+			t.Fatalf("Expected 200, but %v", res.Code)
+		} else {
+			var result Entity
+			if err := json.Unmarshal(res.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to parse: %v", res.Body.String())
+			}
+			expectEquals(t, first.ID, result.ID)
+			expectEquals(t, "true", res.Header().Get(headerIdempotentReplayed))
+		}
+	}
+	expectEquals(t, 1, countEntityForIdempotency(t, inst))
+
+	// 異なるキーでは新たに作成される
+	if res, err := callHandlerEntityPostIdempotent(t, inst, "key2", `{"name": "Testdata1"}`); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	expectEquals(t, 2, countEntityForIdempotency(t, inst))
+}
+
+func TestIdempotentWithoutKey(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForIdempotency(t, inst)
+
+	for i := 0; i < 2; i++ {
+		if res, err := callHandlerEntityPostIdempotent(t, inst, "", `{"name": "Testdata1"}`); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		} else if res.Code != http.StatusOK {
+			t.Fatalf("Expected 200, but %v", res.Code)
+		}
+	}
+	expectEquals(t, 2, countEntityForIdempotency(t, inst))
+}
+
+func TestIdempotentAnotherRequest(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForIdempotency(t, inst)
+
+	if res, err := callHandlerEntityPostIdempotent(t, inst, "key1", `{"name": "Testdata1"}`); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v", res.Code)
+	}
+	if res, err := callHandlerEntityPostIdempotent(t, inst, "key1", `{"name": "Testdata2"}`); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422, but %v", res.Code)
+	}
+	expectEquals(t, 1, countEntityForIdempotency(t, inst))
+}
+
+func TestIdempotentBadRequestIsStored(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForIdempotency(t, inst)
+
+	for i := 0; i < 2; i++ {
+		if res, err := callHandlerEntityPostIdempotent(t, inst, "key1", "xxxx"); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		} else if res.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, but %v", res.Code)
+		} else {
+			expectEquals(t, i != 0, res.Header().Get(headerIdempotentReplayed) == "true")
+		}
+	}
+}
+
+func TestIdempotentServerErrorIsNotStored(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForIdempotency(t, inst)
+
+	e := echo.New()
+	calls := 0
+	handler := idempotent(func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusInternalServerError, "error")
+	})
+	for i := 0; i < 2; i++ {
+		req, err := inst.NewRequest("POST", "/entity/", bytes.NewReader([]byte("{}")))
+		if err != nil {
+			panic(err)
+		}
+		req.Header.Add(headerIdempotencyKey, "key1")
+		res := httptest.NewRecorder()
+		if err := handler(e.NewContext(req, res)); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		}
+		if res.Code != http.StatusInternalServerError {
+			t.Errorf("Expected 500, but %v", res.Code)
+		}
+	}
+	expectEquals(t, 2, calls)
+}
+
+func TestIdempotentTooLongKey(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+
+	key := string(bytes.Repeat([]byte("k"), idempotencyKeyMaxLength+1))
+	if res, err := callHandlerEntityPostIdempotent(t, inst, key, `{"name": "Testdata1"}`); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, but %v", res.Code)
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	newRequest := func(method, path, auth string) *http.Request {
+		req := httptest.NewRequest(method, path, nil)
+		if auth != "" {
+			req.Header.Set(echo.HeaderAuthorization, auth)
+		}
+		return req
+	}
+	recordID := func(u *user.User, req *http.Request) string {
+		return idempotencyRecordID(idempotencyScope(u, req), "key1")
+	}
+
+	// 利用者ごとに区別される
+	user1 := &user.User{ID: "1", Email: "user1@example.com"}
+	user2 := &user.User{ID: "2", Email: "user2@example.com"}
+	expectEquals(t, recordID(user1, newRequest("POST", "/entity/", "")), recordID(user1, newRequest("POST", "/entity/", "")))
+	if recordID(user1, newRequest("POST", "/entity/", "")) == recordID(user2, newRequest("POST", "/entity/", "")) {
+		t.Errorf("Expect users are scoped separately")
+	}
+	if recordID(nil, newRequest("POST", "/entity/", "Bearer token1")) == recordID(nil, newRequest("POST", "/entity/", "Bearer token2")) {
+		t.Errorf("Expect credentials are scoped separately")
+	}
+	if recordID(user1, newRequest("POST", "/entity/", "")) == recordID(nil, newRequest("POST", "/entity/", "")) {
+		t.Errorf("Expect users are scoped separately from anonymous")
+	}
+
+	// 利用者がない場合はエンドポイントごとに区別される
+	expectEquals(t, recordID(nil, newRequest("POST", "/entity/", "")), recordID(nil, newRequest("POST", "/entity/", "")))
+	for _, req := range []*http.Request{newRequest("PUT", "/entity/", ""), newRequest("POST", "/other/", "")} {
+		if recordID(nil, newRequest("POST", "/entity/", "")) == recordID(nil, req) {
+			t.Errorf("Expect %v %v is scoped separately", req.Method, req.URL.Path)
+		}
+	}
+}
+
+func TestIdempotentAnotherUser(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	clearEntityForIdempotency(t, inst)
+
+	// 別の利用者が同じキーを使っても応答は共有されない
+	ids := []int64{}
+	for _, email := range []string{"user1@example.com", "user2@example.com"} {
+		req, err := inst.NewRequest("POST", "/entity/", bytes.NewReader([]byte(`{"name": "Testdata1"}`)))
+		if err != nil {
+			panic(err)
+		}
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add(headerIdempotencyKey, "key1")
+		aetest.Login(&user.User{Email: email}, req)
+		res := httptest.NewRecorder()
+		if err := idempotent(handlerEntityPost)(echo.New().NewContext(req, res)); err != nil {
+			t.Fatalf("Expected no error but %v", err)
+		} else if res.Code != http.StatusOK {
+			t.Fatalf("Expected 200, but %v", res.Code)
+		}
+		expectEquals(t, "", res.Header().Get(headerIdempotentReplayed))
+		var result Entity
+		if err := json.Unmarshal(res.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse: %v", res.Body.String())
+		}
+		ids = append(ids, result.ID)
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("Expect entities are created for each user, but %v", ids)
+	}
+	expectEquals(t, 2, countEntityForIdempotency(t, inst))
+}
+
+func TestIdempotencyCleanup(t *testing.T) {
+	inst := testutil.GetAppengineInstance()
+	ctx := testutil.GetAppengineContextFor(inst)
+	clearEntityForIdempotency(t, inst)
+
+	now := time.Now().UTC()
+	records := []IdempotencyRecord{
+		{ID: "expired", Status: idempotencyStatusDone, CreatedAt: now.Add(-2 * idempotencyTTL), ExpiresAt: now.Add(-idempotencyTTL)},
+		{ID: "abandoned", Status: idempotencyStatusProcessing, CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Hour).Add(idempotencyLockTimeout)},
+		{ID: "alive", Status: idempotencyStatusDone, CreatedAt: now, ExpiresAt: now.Add(idempotencyTTL)},
+	}
+	keys := []*datastore.Key{}
+	for _, record := range records {
+		keys = append(keys, datastore.NewKey(ctx, "IdempotencyRecord", record.ID, 0, nil))
+	}
+	if _, err := datastore.PutMulti(ctx, keys, records); err != nil {
+		panic(err)
+	}
+
+	req, err := inst.NewRequest("GET", "/internal/cron/idempotency-cleanup", nil)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Add("X-Appengine-Cron", "true")
+	res := httptest.NewRecorder()
+	if err := handlerInternalIdempotencyCleanupGet(echo.New().NewContext(req, res)); err != nil {
+		t.Fatalf("Expected no error but %v", err)
+	} else if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, but %v: %v", res.Code, res.Body.String())
+	}
+
+	left, err := datastore.NewQuery("IdempotencyRecord").KeysOnly().GetAll(ctx, nil)
+	if err != nil {
+		panic(err)
+	}
+	if len(left) != 1 || left[0].StringID() != "alive" {
+		t.Errorf("Expect only alive is left, but was %v", left)
+	}
+}
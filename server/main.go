@@ -1,4 +1,3 @@
-// Package server はサーバーアプリの実装です。
 package server
 
 import (
@@ -7,6 +6,9 @@ import (
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
 	"github.com/mjibson/goon"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/user"
 )
 
 var (
@@ -26,12 +28,52 @@ func init() {
 	}))
 
 	setupEntityHandlers(e.Group("/entity"))
+	setupInternalHandlers(e.Group("/internal", requireInternalRequest))
+	setupAdminHandlers(e.Group("/admin", requireAdmin))
 
 	http.Handle("/", e)
 }
 
 func setupEntityHandlers(g *echo.Group) {
 	g.GET("/", handlerEntityListGet)
-	g.POST("/", handlerEntityPost)
+	g.GET("/export", handlerEntityExportGet)
+	g.POST("/", handlerEntityPost, idempotent)
+	g.POST("/import", handlerEntityImportPost)
 	g.PUT("/:id", handlerEntityPut)
 }
+
+func setupInternalHandlers(g *echo.Group) {
+	g.POST("/entity/reminder", handlerInternalEntityReminderPost)
+	g.GET("/cron/entity-cleanup", handlerInternalEntityCleanupGet)
+	g.POST("/cron/entity-cleanup", handlerInternalEntityCleanupPost)
+	g.POST("/task/entity-reindex", handlerInternalEntityReindexPost)
+	g.GET("/cron/idempotency-cleanup", handlerInternalIdempotencyCleanupGet)
+}
+
+func setupAdminHandlers(g *echo.Group) {
+	g.GET("/entity-reindex", handlerAdminEntityReindexGet)
+	g.POST("/entity-reindex", handlerAdminEntityReindexPost)
+}
+
+// requireAdmin rejects requests not from administrators of the application.
+// app.yaml also requires the login.
+func requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !user.IsAdmin(appengine.NewContext(c.Request())) {
+			return c.String(http.StatusForbidden, "Forbidden")
+		}
+		return next(c)
+	}
+}
+
+// requireInternalRequest rejects requests not from App Engine itself.
+// App Engine removes these headers from external requests.
+func requireInternalRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h := c.Request().Header
+		if h.Get("X-AppEngine-QueueName") == "" && h.Get("X-Appengine-Cron") != "true" {
+			return c.String(http.StatusForbidden, "Forbidden")
+		}
+		return next(c)
+	}
+}
@@ -8,6 +8,68 @@ import (
 type Entity struct {
 	ID            int64     `json:"id" datastore:"-" goon:"id" protectfor:"update"`
 	Name          string    `json:"name" datastore:",noindex"`
-	ScheduledDate time.Time `json:"scheduledDate" datastore:",noindex"`
+	ScheduledDate time.Time `json:"scheduledDate"`
 	CreatedAt     time.Time `json:"createdAt" protectfor:"update"`
+	// ReminderFiredAt は ScheduledDate のリマインダーが実行された日時です。
+	// ScheduledDate が変更されるとリセットされます。
+	ReminderFiredAt time.Time `json:"reminderFiredAt" datastore:",noindex" protectfor:"update"`
+}
+
+// EntityImport は Entity のインポートの実行記録です。
+// 同じファイルの再アップロードで Entity が重複しないように使用します。
+type EntityImport struct {
+	ID          string    `json:"id" datastore:"-" goon:"id"`
+	ContentHash string    `json:"contentHash" datastore:",noindex"`
+	Status      string    `json:"status" datastore:",noindex"`
+	IDLow       int64     `json:"-" datastore:",noindex"`
+	Total       int       `json:"total" datastore:",noindex"`
+	Imported    int       `json:"imported" datastore:",noindex"`
+	CreatedAt   time.Time `json:"createdAt"`
+	FinishedAt  time.Time `json:"finishedAt" datastore:",noindex"`
+}
+
+// ArchivedEntity は ScheduledDate を過ぎてから一定期間経った Entity です。
+// ID は元の Entity の ID です。
+type ArchivedEntity struct {
+	ID              int64     `json:"id" datastore:"-" goon:"id"`
+	Name            string    `json:"name" datastore:",noindex"`
+	ScheduledDate   time.Time `json:"scheduledDate" datastore:",noindex"`
+	CreatedAt       time.Time `json:"createdAt" datastore:",noindex"`
+	ReminderFiredAt time.Time `json:"reminderFiredAt" datastore:",noindex"`
+	ArchivedAt      time.Time `json:"archivedAt"`
+}
+
+// EntityCleanupRun は Entity のアーカイブ処理の実行記録です。
+type EntityCleanupRun struct {
+	ID         string    `json:"id" datastore:"-" goon:"id"`
+	Status     string    `json:"status" datastore:",noindex"`
+	Cutoff     time.Time `json:"cutoff" datastore:",noindex"`
+	Archived   int       `json:"archived" datastore:",noindex"`
+	Requests   int       `json:"requests" datastore:",noindex"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt" datastore:",noindex"`
+}
+
+// EntityReindexRun は Entity のインデックス再作成の実行記録です。
+type EntityReindexRun struct {
+	ID         string    `json:"id" datastore:"-" goon:"id"`
+	Status     string    `json:"status" datastore:",noindex"`
+	Reindexed  int       `json:"reindexed" datastore:",noindex"`
+	Requests   int       `json:"requests" datastore:",noindex"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt" datastore:",noindex"`
+}
+
+// IdempotencyRecord は Idempotency-Key を指定したリクエストへの最初のレスポンスです。
+// ID は利用者 (不明な場合はエンドポイント) と Idempotency-Key から算出します。
+// ExpiresAt を過ぎたものは cron で削除します。
+type IdempotencyRecord struct {
+	ID          string    `json:"id" datastore:"-" goon:"id"`
+	Status      string    `json:"status" datastore:",noindex"`
+	RequestHash string    `json:"requestHash" datastore:",noindex"`
+	StatusCode  int       `json:"statusCode" datastore:",noindex"`
+	ContentType string    `json:"contentType" datastore:",noindex"`
+	Body        []byte    `json:"body" datastore:",noindex"`
+	CreatedAt   time.Time `json:"createdAt" datastore:",noindex"`
+	ExpiresAt   time.Time `json:"expiresAt"`
 }
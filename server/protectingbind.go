@@ -0,0 +1,511 @@
+package server
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// protectingBindMaxMemory is the max memory to parse multipart forms
+// same as echo.
+const protectingBindMaxMemory = 32 << 20
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	bindUnmarshalerType = reflect.TypeOf((*echo.BindUnmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// bindToNew binds to a new value of the same type as dst,
+// and sets keys present in req to s if req is not nil.
+func bindToNew(s *protectingCopyState, req *http.Request, binder func(dst interface{}) error, dst interface{}) (interface{}, error) {
+	dType := reflect.TypeOf(dst)
+	if dType == nil || dType.Kind() != reflect.Ptr {
+		return nil, NewErrCopyValueInvalid("dst must be a pointer")
+	}
+	var body []byte
+	if req != nil && isJSONRequest(req) {
+		// buffer the body to decode it again for presence.
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	value := reflect.New(dType.Elem()).Interface()
+	if err := binder(value); err != nil {
+		return nil, err
+	}
+	if req != nil {
+		presence, err := requestPresence(req, body, dType.Elem())
+		if err != nil {
+			return nil, err
+		}
+		s.rootPresence = presence
+	}
+	return value, nil
+}
+
+// isJSONRequest tests whether the body of req is JSON.
+func isJSONRequest(req *http.Request) bool {
+	if req.Body == nil {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// requestPresence returns keys present in req for a value of typ
+// as echo.DefaultBinder binds,
+// or nil if req is not supported and all fields are copied.
+// body is the JSON body buffered.
+func requestPresence(req *http.Request, body []byte, typ reflect.Type) (*protectingCopyPresence, error) {
+	if body != nil {
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			return nil, err
+		}
+		return newProtectingCopyPresence(decoded), nil
+	}
+	if typ.Kind() != reflect.Struct {
+		// forms can be bound only to structs.
+		return nil, nil
+	}
+	var d *protectingFormDecoder
+	if req.ContentLength == 0 && (req.Method == http.MethodGet || req.Method == http.MethodDelete) {
+		d = newProtectingQueryDecoder(req)
+	} else {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data" {
+			return nil, nil
+		}
+		var err error
+		if d, err = newProtectingFormDecoder(req); err != nil {
+			return nil, err
+		}
+	}
+	// decode again to a scratch value only to collect keys.
+	return d.bind(reflect.New(typ).Interface())
+}
+
+// protectingCopyPresence is the tree of keys and elements
+// present in the source (e.g. a JSON request body).
+// nil means presence is not tracked and the value is copied as a whole.
+type protectingCopyPresence struct {
+	// keys are keys of an object, or nil if not an object.
+	keys map[string]*protectingCopyPresence
+	// elems are elements of an array, or nil if not an array.
+	elems []*protectingCopyPresence
+	// null is true for an explicit null.
+	null bool
+	// byName is true if keys are Go field names instead of JSON keys.
+	byName bool
+}
+
+// newProtectingCopyPresence creates the tree for a value decoded into interface{}.
+func newProtectingCopyPresence(v interface{}) *protectingCopyPresence {
+	p := &protectingCopyPresence{}
+	switch v := v.(type) {
+	case nil:
+		p.null = true
+	case map[string]interface{}:
+		p.keys = make(map[string]*protectingCopyPresence, len(v))
+		for key, value := range v {
+			p.keys[key] = newProtectingCopyPresence(value)
+		}
+	case []interface{}:
+		p.elems = make([]*protectingCopyPresence, len(v))
+		for idx, value := range v {
+			p.elems[idx] = newProtectingCopyPresence(value)
+		}
+	}
+	return p
+}
+
+// tracked returns p if it has keys or elements to track, or nil.
+func (p *protectingCopyPresence) tracked() *protectingCopyPresence {
+	if p == nil || (p.keys == nil && p.elems == nil) {
+		return nil
+	}
+	return p
+}
+
+// field returns the presence of field,
+// matched case-insensitively if not exactly as encoding/json does.
+// Returns false if the field is absent.
+func (p *protectingCopyPresence) field(field protectingCopyField) (*protectingCopyPresence, bool) {
+	name := field.jsonKey
+	if p.byName {
+		name = field.name
+	}
+	if name == "" || p.keys == nil {
+		return nil, false
+	}
+	if child, ok := p.keys[name]; ok {
+		return child, true
+	}
+	for key, child := range p.keys {
+		if strings.EqualFold(key, name) {
+			return child, true
+		}
+	}
+	return nil, false
+}
+
+// hasField tests whether field is explicitly present in the bound body.
+// Returns false if not tracked, or for embedded structs sharing the presence.
+func (p *protectingCopyPresence) hasField(field protectingCopyField) bool {
+	if p == nil || p.byName && field.embedded != nil && !field.ptr || !p.byName && field.jsonPromoted {
+		return false
+	}
+	_, ok := p.field(field)
+	return ok
+}
+
+// mapKey returns the presence of the map value for key.
+// Returns false if the key is absent or not tracked.
+func (p *protectingCopyPresence) mapKey(key reflect.Value) (*protectingCopyPresence, bool) {
+	if p == nil || p.keys == nil {
+		return nil, false
+	}
+	var name string
+	switch key.Kind() {
+	case reflect.String:
+		name = key.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		name = strconv.FormatInt(key.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		name = strconv.FormatUint(key.Uint(), 10)
+	default:
+		return nil, false
+	}
+	child, ok := p.keys[name]
+	return child, ok
+}
+
+// key returns the presence of the map value for key, or nil.
+func (p *protectingCopyPresence) key(key reflect.Value) *protectingCopyPresence {
+	child, _ := p.mapKey(key)
+	return child.tracked()
+}
+
+// hasKey tests whether the map value for key is explicitly present in the bound body.
+func (p *protectingCopyPresence) hasKey(key reflect.Value) bool {
+	_, ok := p.mapKey(key)
+	return ok
+}
+
+// elem returns the presence of the element at index, or nil.
+func (p *protectingCopyPresence) elem(index int) *protectingCopyPresence {
+	if p == nil || index >= len(p.elems) {
+		return nil
+	}
+	return p.elems[index].tracked()
+}
+
+// hasElem tests whether the element at index is explicitly present in the bound body.
+func (p *protectingCopyPresence) hasElem(index int) bool {
+	return p != nil && index < len(p.elems)
+}
+
+// jsonFieldKey returns the key of field in JSON, or "" if field is ignored.
+// promoted is true if fields of the embedded struct are promoted in JSON.
+func jsonFieldKey(field reflect.StructField) (key string, promoted bool) {
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+	switch {
+	case tag == "-":
+		return "", false
+	case tag != "":
+		return tag, false
+	}
+	return field.Name, field.Anonymous
+}
+
+// ProtectingFormBinder returns a binder for ProtectingBind
+// binding the form in the body of req
+// (application/x-www-form-urlencoded or multipart/form-data)
+// like echo.Context.Bind() with "form" tags.
+// Files in multipart forms are bound to fields of *multipart.FileHeader
+// or []*multipart.FileHeader.
+// The query string is not bound: use ProtectingQueryBinder.
+func ProtectingFormBinder(req *http.Request) func(dst interface{}) error {
+	return func(dst interface{}) error {
+		d, err := newProtectingFormDecoder(req)
+		if err != nil {
+			return err
+		}
+		_, err = d.bind(dst)
+		return err
+	}
+}
+
+// ProtectingQueryBinder returns a binder for ProtectingBind
+// binding the query string of req with "query" tags.
+func ProtectingQueryBinder(req *http.Request) func(dst interface{}) error {
+	return func(dst interface{}) error {
+		_, err := newProtectingQueryDecoder(req).bind(dst)
+		return err
+	}
+}
+
+// protectingFormDecoder decodes forms to structs like echo.
+type protectingFormDecoder struct {
+	tag    string
+	values url.Values
+	files  map[string][]*multipart.FileHeader
+}
+
+// newProtectingFormDecoder creates protectingFormDecoder for the form in the body of req.
+func newProtectingFormDecoder(req *http.Request) (*protectingFormDecoder, error) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	d := &protectingFormDecoder{
+		tag: "form",
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := req.ParseForm(); err != nil {
+			return nil, err
+		}
+		d.values = req.PostForm
+	case "multipart/form-data":
+		if err := req.ParseMultipartForm(protectingBindMaxMemory); err != nil {
+			return nil, err
+		}
+		d.values = req.MultipartForm.Value
+		d.files = req.MultipartForm.File
+	default:
+		return nil, NewErrCopyValueInvalid(fmt.Sprintf("unsupported content type for forms: %q", mediaType))
+	}
+	return d, nil
+}
+
+// newProtectingQueryDecoder creates protectingFormDecoder for the query string of req.
+func newProtectingQueryDecoder(req *http.Request) *protectingFormDecoder {
+	return &protectingFormDecoder{
+		tag:    "query",
+		values: req.URL.Query(),
+	}
+}
+
+// bind decodes to dst, which is a pointer to a struct,
+// and returns keys present in the form.
+func (d *protectingFormDecoder) bind(dst interface{}) (*protectingCopyPresence, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, NewErrCopyValueInvalid("binding element must be a pointer to a struct")
+	}
+	presence := &protectingCopyPresence{
+		keys:   map[string]*protectingCopyPresence{},
+		byName: true,
+	}
+	if err := d.decodeStruct(v.Elem(), presence); err != nil {
+		return nil, err
+	}
+	return presence, nil
+}
+
+// decodeStruct decodes fields of the struct v
+// and records present fields to p.
+// Untagged struct fields are decoded from the same keys as echo does.
+func (d *protectingFormDecoder) decodeStruct(v reflect.Value, p *protectingCopyPresence) error {
+	for idx := 0; idx < v.NumField(); idx++ {
+		field := v.Type().Field(idx)
+		fieldValue := v.Field(idx)
+		name, tagged := field.Tag.Lookup(d.tag)
+		if name == "-" {
+			continue
+		}
+		if !tagged && field.Type.Kind() == reflect.Struct && !isFormUnmarshaler(field.Type) {
+			if field.PkgPath != "" && !field.Anonymous {
+				continue
+			}
+			// fields of embedded structs are promoted
+			child := p
+			if !field.Anonymous {
+				child = &protectingCopyPresence{
+					keys:   map[string]*protectingCopyPresence{},
+					byName: true,
+				}
+			}
+			if err := d.decodeStruct(fieldValue, child); err != nil {
+				return err
+			}
+			if child != p && len(child.keys) > 0 {
+				p.keys[field.Name] = child
+			}
+			continue
+		}
+		if field.PkgPath != "" || !fieldValue.CanSet() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		present, err := d.decodeField(fieldValue, name)
+		if err != nil {
+			return err
+		}
+		if present {
+			p.keys[field.Name] = &protectingCopyPresence{}
+		}
+	}
+	return nil
+}
+
+// decodeField decodes the value for the key name to v.
+// Returns false if the key is not supplied.
+func (d *protectingFormDecoder) decodeField(v reflect.Value, name string) (bool, error) {
+	switch v.Type() {
+	case fileHeaderType:
+		files := d.lookupFiles(name)
+		if len(files) == 0 {
+			return false, nil
+		}
+		v.Set(reflect.ValueOf(files[0]))
+		return true, nil
+	case fileHeaderSliceType:
+		files := d.lookupFiles(name)
+		if len(files) == 0 {
+			return false, nil
+		}
+		v.Set(reflect.ValueOf(files))
+		return true, nil
+	}
+	values, ok := d.lookupValues(name)
+	if !ok {
+		return false, nil
+	}
+	if v.Kind() == reflect.Slice && !isFormUnmarshaler(v.Type()) {
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for idx, value := range values {
+			if err := setFormValue(slice.Index(idx), value); err != nil {
+				return false, fmt.Errorf("invalid value for %v: %v", name, err)
+			}
+		}
+		v.Set(slice)
+		return true, nil
+	}
+	value := ""
+	if len(values) > 0 {
+		value = values[0]
+	}
+	if err := setFormValue(v, value); err != nil {
+		return false, fmt.Errorf("invalid value for %v: %v", name, err)
+	}
+	return true, nil
+}
+
+// lookupValues returns the values for name,
+// matched case-insensitively if not exactly as echo does.
+func (d *protectingFormDecoder) lookupValues(name string) ([]string, bool) {
+	if values, ok := d.values[name]; ok {
+		return values, true
+	}
+	for key, values := range d.values {
+		if strings.EqualFold(key, name) {
+			return values, true
+		}
+	}
+	return nil, false
+}
+
+// lookupFiles returns the files for name like lookupValues.
+func (d *protectingFormDecoder) lookupFiles(name string) []*multipart.FileHeader {
+	if files, ok := d.files[name]; ok {
+		return files
+	}
+	for key, files := range d.files {
+		if strings.EqualFold(key, name) {
+			return files
+		}
+	}
+	return nil
+}
+
+// isFormUnmarshaler tests whether values of typ decode themselves
+// with echo.BindUnmarshaler or encoding.TextUnmarshaler.
+func isFormUnmarshaler(typ reflect.Type) bool {
+	ptrType := reflect.PtrTo(typ)
+	return ptrType.Implements(bindUnmarshalerType) || ptrType.Implements(textUnmarshalerType)
+}
+
+// setFormValue decodes value to v.
+func setFormValue(v reflect.Value, value string) error {
+	if v.Kind() == reflect.Ptr {
+		created := reflect.New(v.Type().Elem())
+		if err := setFormValue(created.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(created)
+		return nil
+	}
+	switch u := v.Addr().Interface().(type) {
+	case echo.BindUnmarshaler:
+		return u.UnmarshalParam(value)
+	case encoding.TextUnmarshaler:
+		return u.UnmarshalText([]byte(value))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+		return nil
+	case reflect.Bool:
+		if value == "" {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value == "" {
+			v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value == "" {
+			v.SetUint(0)
+			return nil
+		}
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if value == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+	return fmt.Errorf("unsupported type: %v", v.Type())
+}
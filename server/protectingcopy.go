@@ -1,8 +1,11 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
+	"net/http"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 )
@@ -10,29 +13,125 @@ import (
 const (
 	// ProtectingCopyDefaultStructTag is the default tag name to test fields not to copy
 	ProtectingCopyDefaultStructTag = "protectfor"
+	// ProtectingCopyDefaultWritableTag is the default tag name to test fields to copy
+	// in the allow-list mode.
+	ProtectingCopyDefaultWritableTag = "writablefor"
+	// ProtectingCopyDefaultKeyTag is the default tag name of key fields
+	// to match elements of slices with ProtectingCopySliceMergeByKey.
+	ProtectingCopyDefaultKeyTag = "protectkey"
+	// ProtectingCopyDefaultMapTag is the default tag name of policies of map fields.
+	ProtectingCopyDefaultMapTag = "protectmap"
+	// ProtectingCopyDefaultTransformTag is the default tag name of transforms of fields.
+	ProtectingCopyDefaultTransformTag = "protecttransform"
 )
 
-var (
-	// IsNonStruct decides to treat the value is non-struct,
-	// like time.Time and so on.
-	IsNonStruct = func(v interface{}) bool {
-		switch v.(type) {
-		case time.Time:
-			return true
-		}
-		return false
-	}
+// ProtectingCopyMode is how ProtectingCopier treats fields without tags.
+type ProtectingCopyMode int
+
+const (
+	// ProtectingCopyDenyList copies fields except ones protected with StructTag.
+	ProtectingCopyDenyList ProtectingCopyMode = iota
+	// ProtectingCopyAllowList copies only fields allowed with WritableTag.
+	ProtectingCopyAllowList
+)
+
+// ProtectingCopyMatch is how tag values match purposes
+// (ProtectFor and Purposes) of ProtectingCopier.
+type ProtectingCopyMatch int
+
+const (
+	// ProtectingCopyMatchAny matches if tag values contain any of purposes.
+	ProtectingCopyMatchAny ProtectingCopyMatch = iota
+	// ProtectingCopyMatchAll matches if tag values contain all of purposes.
+	ProtectingCopyMatchAll
+)
+
+// ProtectingCopySliceStrategy is how ProtectingCopier copies slices.
+type ProtectingCopySliceStrategy int
+
+const (
+	// ProtectingCopySliceReplace copies elements at the same indexes
+	// if the lengths are the same, and otherwise replaces the slice with a new one.
+	ProtectingCopySliceReplace ProtectingCopySliceStrategy = iota
+	// ProtectingCopySliceMergeByKey matches elements by the key field tagged with KeyTag
+	// for slices of structs or pointers to structs with the key field:
+	// matched elements are copied protecting fields,
+	// ones only in the source are added and ones only in the destination are removed.
+	// Elements are ordered as the source.
+	// Elements with the zero key are always added.
+	// Slices of other types are copied as ProtectingCopySliceReplace.
+	ProtectingCopySliceMergeByKey
+)
+
+// ProtectingCopyUnexported is how ProtectingCopier treats unexported fields.
+type ProtectingCopyUnexported int
+
+const (
+	// ProtectingCopyUnexportedSkip keeps unexported fields in the destination.
+	ProtectingCopyUnexportedSkip ProtectingCopyUnexported = iota
+	// ProtectingCopyUnexportedCopy copies unexported fields with unsafe
+	// as exported ones.
+	// This fails on App Engine, where unsafe is not allowed.
+	ProtectingCopyUnexportedCopy
+	// ProtectingCopyUnexportedError fails copying structs
+	// with unexported fields not protected with tags.
+	ProtectingCopyUnexportedError
+)
+
+// ProtectingCopyUncopyable is how ProtectingCopier treats values
+// which cannot be deep-copied: chans, funcs and unsafe.Pointer.
+type ProtectingCopyUncopyable int
+
+const (
+	// ProtectingCopyUncopyableShare assigns values in the source,
+	// sharing them with the source.
+	ProtectingCopyUncopyableShare ProtectingCopyUncopyable = iota
+	// ProtectingCopyUncopyableSkip keeps values in the destination.
+	ProtectingCopyUncopyableSkip
+	// ProtectingCopyUncopyableError fails copying non-nil values.
+	ProtectingCopyUncopyableError
 )
 
 // ErrCopyValueInvalid represents a failure of copy
 // caused for the source or the destination is invalid
 // (e.g. is nil)
 type ErrCopyValueInvalid struct {
-	msg string
+	msg    string
+	detail ProtectingCopyError
 }
 
 func (e *ErrCopyValueInvalid) Error() string {
-	return e.msg
+	return e.detail.describe(e.msg)
+}
+
+// As provides ProtectingCopyError for errors.As.
+func (e *ErrCopyValueInvalid) As(target interface{}) bool {
+	return asProtectingCopyError(e, target)
+}
+
+func (e *ErrCopyValueInvalid) copyErrorDetail() *ProtectingCopyError {
+	return e.detail.init(e, ProtectingCopyReasonInvalidValue)
+}
+
+// NewErrCopyValueInvalid creates a new ErrCopyValueInvalid.
+func NewErrCopyValueInvalid(msg string) *ErrCopyValueInvalid {
+	return newErrCopyValueInvalid(ProtectingCopyReasonInvalidValue, msg)
+}
+
+// clone returns a copy of e not located yet
+// for errors cached in plans.
+func (e *ErrCopyValueInvalid) clone() *ErrCopyValueInvalid {
+	return newErrCopyValueInvalid(e.detail.Reason, e.msg)
+}
+
+// newErrCopyValueInvalid creates a new ErrCopyValueInvalid with the reason.
+func newErrCopyValueInvalid(reason ProtectingCopyErrorReason, msg string) *ErrCopyValueInvalid {
+	return &ErrCopyValueInvalid{
+		msg: msg,
+		detail: ProtectingCopyError{
+			Reason: reason,
+		},
+	}
 }
 
 // ProtectingCopy performs deepcopy excluding fields with the tag
@@ -50,28 +149,61 @@ func ProtectingCopy(dst, src interface{}, protectFor string) error {
 
 // ProtectingBind wraps binging functions such as echo.Context.Bind(),
 // providing field protection.
+// Use ProtectingBindRequest to copy only fields present in the request.
+// See ProtectingCopier.Bind for details.
 func ProtectingBind(binder func(dst interface{}) error, dst interface{}, protectFor string) error {
-	dType := reflect.TypeOf(dst)
-	if dType.Kind() != reflect.Ptr {
-		return &ErrCopyValueInvalid{
-			msg: "dst must be a pointer",
-		}
+	c := &ProtectingCopier{
+		ProtectFor: protectFor,
 	}
-	sValue := reflect.New(dType.Elem())
-	if err := binder(sValue.Interface()); err != nil {
-		return err
+	return c.Bind(binder, dst)
+}
+
+// ProtectingBindWithReport is ProtectingBind
+// also reporting changes like ProtectingCopier.CopyWithReport.
+func ProtectingBindWithReport(binder func(dst interface{}) error, dst interface{}, protectFor string) (*ProtectingCopyReport, error) {
+	c := &ProtectingCopier{
+		ProtectFor: protectFor,
+	}
+	return c.BindWithReport(binder, dst)
+}
+
+// ProtectingBindRequest is ProtectingBind
+// copying only fields present in req.
+// See ProtectingCopier.BindRequest for details.
+func ProtectingBindRequest(req *http.Request, binder func(dst interface{}) error, dst interface{}, protectFor string) error {
+	c := &ProtectingCopier{
+		ProtectFor: protectFor,
+	}
+	return c.BindRequest(req, binder, dst)
+}
+
+// ProtectingBindRequestWithReport is ProtectingBindRequest
+// also reporting changes like ProtectingCopier.CopyWithReport.
+func ProtectingBindRequestWithReport(req *http.Request, binder func(dst interface{}) error, dst interface{}, protectFor string) (*ProtectingCopyReport, error) {
+	c := &ProtectingCopier{
+		ProtectFor: protectFor,
 	}
-	return ProtectingCopy(dst, sValue.Interface(), protectFor)
+	return c.BindRequestWithReport(req, binder, dst)
 }
 
 // ErrCopyTypeMismatch represents an error caused for
 // type mismatching between source and destination.
 type ErrCopyTypeMismatch struct {
-	msg string
+	msg    string
+	detail ProtectingCopyError
 }
 
 func (e *ErrCopyTypeMismatch) Error() string {
-	return e.msg
+	return e.detail.describe(e.msg)
+}
+
+// As provides ProtectingCopyError for errors.As.
+func (e *ErrCopyTypeMismatch) As(target interface{}) bool {
+	return asProtectingCopyError(e, target)
+}
+
+func (e *ErrCopyTypeMismatch) copyErrorDetail() *ProtectingCopyError {
+	return e.detail.init(e, ProtectingCopyReasonTypeMismatch)
 }
 
 // NewErrCopyTypeMismatch creates a new ErrCopyTypeMismatch.
@@ -81,13 +213,559 @@ func NewErrCopyTypeMismatch(dType, sType reflect.Type) *ErrCopyTypeMismatch {
 	}
 }
 
-// ProtectingCopier is the configuration to perform protecting copy
+// ErrCopyProtected represents an error in the strict mode
+// caused for the source has values for protected fields.
+type ErrCopyProtected struct {
+	// Paths are paths to the protected fields like `Items[2].Name`.
+	Paths  []string
+	detail ProtectingCopyError
+}
+
+func (e *ErrCopyProtected) Error() string {
+	return fmt.Sprintf("protected fields cannot be written: %v", strings.Join(e.Paths, ", "))
+}
+
+// As provides ProtectingCopyError for errors.As.
+func (e *ErrCopyProtected) As(target interface{}) bool {
+	return asProtectingCopyError(e, target)
+}
+
+func (e *ErrCopyProtected) copyErrorDetail() *ProtectingCopyError {
+	return e.detail.init(e, ProtectingCopyReasonProtected)
+}
+
+// NewErrCopyProtected creates a new ErrCopyProtected.
+func NewErrCopyProtected(discarded []ProtectingCopyChange) *ErrCopyProtected {
+	paths := make([]string, 0, len(discarded))
+	for _, change := range discarded {
+		paths = append(paths, change.Path)
+	}
+	return &ErrCopyProtected{
+		Paths: paths,
+	}
+}
+
+// ErrCopyTransform represents an error in a transform of a field.
+type ErrCopyTransform struct {
+	// Path is the path to the field like `Items[2].Name`.
+	Path string
+	// Transform is the name of the transform.
+	Transform string
+	// Err is the error returned from the transform.
+	Err    error
+	detail ProtectingCopyError
+}
+
+func (e *ErrCopyTransform) Error() string {
+	return fmt.Sprintf("failed to transform %v with %v: %v", e.Path, e.Transform, e.Err)
+}
+
+// As provides ProtectingCopyError for errors.As.
+func (e *ErrCopyTransform) As(target interface{}) bool {
+	return asProtectingCopyError(e, target)
+}
+
+func (e *ErrCopyTransform) copyErrorDetail() *ProtectingCopyError {
+	return e.detail.init(e, ProtectingCopyReasonTransform)
+}
+
+// protectingCopyField is a field of a struct to copy.
+type protectingCopyField struct {
+	// index is the index of the field in the struct.
+	index int
+	name  string
+	// simple is true if the field can be copied just with Set.
+	simple bool
+	// embedded is the plan for promoted fields
+	// if the field is an embedded struct or pointer to struct.
+	embedded *protectingCopyPlan
+	// ptr is true if the embedded field is a pointer.
+	ptr bool
+	// mapPolicy is the policy of the map field specified with MapTag, or nil.
+	mapPolicy *protectingCopyMapPolicy
+	// transforms are transforms specified with TransformTag.
+	transforms []protectingCopyTransform
+	// unexported is true for unexported fields
+	// copied with ProtectingCopyUnexportedCopy or ProtectingCopyUnexportedError.
+	unexported bool
+	// jsonKey is the key of the field in JSON, or "" if ignored in JSON.
+	jsonKey string
+	// jsonPromoted is true if fields of the embedded field are promoted in JSON.
+	jsonPromoted bool
+}
+
+// protectingCopyPlan is the list of fields to copy for a struct type.
+type protectingCopyPlan struct {
+	fields []protectingCopyField
+	// protected is the list of fields not to copy.
+	protected []protectingCopyField
+	// protector is true if the struct implements ProtectingCopyFieldProtector.
+	protector bool
+	// keyIndex is the index of the field tagged with KeyTag, or -1.
+	keyIndex int
+	// unmarshaler is true if the struct implements json.Unmarshaler,
+	// where presence of fields is not tracked.
+	unmarshaler bool
+	// loadSaver is true if the struct implements datastore.PropertyLoadSaver.
+	loadSaver bool
+	// unexported is true if fields include unexported ones.
+	unexported bool
+	// properties maps names of properties to fields.
+	properties map[string]protectingCopyProperty
+}
+
+// protectingCopyPlanKey identifies a protectingCopyPlan.
+type protectingCopyPlanKey struct {
+	sType        reflect.Type
+	types        *ProtectingCopyTypes
+	structTag    string
+	writableTag  string
+	keyTag       string
+	mapTag       string
+	transformTag string
+	unexported   ProtectingCopyUnexported
+	mode         ProtectingCopyMode
+	// purposes is sorted purposes joined with ",".
+	purposes string
+	match    ProtectingCopyMatch
+}
+
+// ProtectingCopyChange is a change of a value.
+type ProtectingCopyChange struct {
+	// Path is the path to the value from the root
+	// e.g. `Items[2].Name`, `Meta["k"]`.
+	Path string
+	// Old is the value before the change.
+	// nil for an added map entry.
+	Old interface{}
+	// New is the value after the change.
+	// nil for a removed map entry.
+	New interface{}
+}
+
+// ProtectingCopyReport reports what ProtectingCopier.CopyWithReport did.
+type ProtectingCopyReport struct {
+	// Changed is the list of values changed in the destination.
+	// A value newly created in the destination (e.g. a pointer set from nil,
+	// a slice with another length copied with Copy) is reported as a whole.
+	Changed []ProtectingCopyChange
+	// Discarded is the list of protected fields
+	// whose values in the source are not zero and differ from the destination.
+	// Zero values are also listed if present in the body bound with BindRequest.
+	// Old is the value in the destination and New is the one in the source.
+	Discarded []ProtectingCopyChange
+}
+
+// IsChanged tests whether the value at path or its descendants changed.
+func (r *ProtectingCopyReport) IsChanged(path string) bool {
+	for _, change := range r.Changed {
+		if change.Path == path ||
+			strings.HasPrefix(change.Path, path+".") ||
+			strings.HasPrefix(change.Path, path+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// protectingCopyPathElem is an element of the path to a value.
+// One of field, key or index is used in this order.
+type protectingCopyPathElem struct {
+	field string
+	key   reflect.Value
+	index int
+	// node is the node of ProtectingCopyPaths for this path, or nil.
+	node *protectingCopyPathNode
+	// presence is the presence of the value in the bound body, or nil.
+	presence *protectingCopyPresence
+}
+
+// protectingCopyState is the state of a copy operation.
+type protectingCopyState struct {
+	// report is nil if changes are not reported.
+	report *ProtectingCopyReport
+	// path is the path to the value being copied.
+	path []protectingCopyPathElem
+	// planKey is the key of plans without sType.
+	planKey protectingCopyPlanKey
+	// transforms is the registry of transforms.
+	// Transforms are looked up on copy, not in plans,
+	// so that plans are cached only in ProtectingCopyTypes.
+	transforms *ProtectingCopyTransforms
+	// rootNode is the root of ProtectingCopyPaths, or nil.
+	rootNode *protectingCopyPathNode
+	// rootPresence is the presence of keys in the bound body,
+	// or nil if not tracked.
+	rootPresence *protectingCopyPresence
+	// clearNull is true to copy fields explicitly null in the bound body.
+	clearNull bool
+	// creating is positive while copying to a newly created value,
+	// which is reported as a whole.
+	creating int
+	// strict is true to collect discarded even without report.
+	strict bool
+	// discarded is the list of values discarded for protection.
+	discarded []ProtectingCopyChange
+	// visited maps references in the source to ones in the destination
+	// to reproduce cycles and shared references.
+	visited map[protectingCopyRef]reflect.Value
+	// claimed is the set of references in the destination
+	// which are already copied to from another source.
+	claimed map[protectingCopyRef]bool
+}
+
+// protectingCopyRef identifies a referenced value (a pointer, a map or a slice).
+type protectingCopyRef struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+// refOf returns the reference of v.
+// Returns false if v is not a reference or nil or an empty slice.
+func refOf(v reflect.Value) (protectingCopyRef, bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map:
+		if v.IsNil() {
+			return protectingCopyRef{}, false
+		}
+		return protectingCopyRef{typ: v.Type(), ptr: v.Pointer()}, true
+	case reflect.Slice:
+		if v.IsNil() || v.Len() == 0 {
+			// empty slices may share the address
+			return protectingCopyRef{}, false
+		}
+		return protectingCopyRef{typ: v.Type(), ptr: v.Pointer(), len: v.Len()}, true
+	}
+	return protectingCopyRef{}, false
+}
+
+// visit records dst is the copy of src.
+func (s *protectingCopyState) visit(dst, src reflect.Value) {
+	srcRef, ok := refOf(src)
+	if !ok {
+		return
+	}
+	dstRef, ok := refOf(dst)
+	if !ok {
+		return
+	}
+	if s.visited == nil {
+		s.visited = map[protectingCopyRef]reflect.Value{}
+		s.claimed = map[protectingCopyRef]bool{}
+	}
+	// detach from dst as dst may be overwritten later.
+	var copied reflect.Value
+	if dst.Kind() == reflect.Slice {
+		copied = reflect.New(dst.Type()).Elem()
+		copied.Set(dst)
+	} else {
+		copied = reflect.ValueOf(dst.Interface())
+	}
+	s.visited[srcRef] = copied
+	s.claimed[dstRef] = true
+}
+
+// lookupVisited returns the copy of src if already copied.
+func (s *protectingCopyState) lookupVisited(src reflect.Value) (reflect.Value, bool) {
+	ref, ok := refOf(src)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	dst, ok := s.visited[ref]
+	return dst, ok
+}
+
+// canCopyInto tests whether src can be copied into dst in place,
+// that is, src is not copied yet and dst is not a copy of another value.
+func (s *protectingCopyState) canCopyInto(dst, src reflect.Value) bool {
+	if _, ok := s.lookupVisited(src); ok {
+		return false
+	}
+	ref, ok := refOf(dst)
+	return !ok || !s.claimed[ref]
+}
+
+// setVisited sets visited to dst if dst does not refer it yet.
+func (s *protectingCopyState) setVisited(dst, visited reflect.Value) {
+	if ref, ok := refOf(dst); ok {
+		if visitedRef, _ := refOf(visited); ref == visitedRef {
+			return
+		}
+	}
+	s.reportSet(dst, visited)
+	dst.Set(visited)
+}
+
+func (s *protectingCopyState) pushField(name string) {
+	s.path = append(s.path, protectingCopyPathElem{field: name, node: s.pathNode().field(name)})
+}
+
+func (s *protectingCopyState) pushKey(key reflect.Value) {
+	s.path = append(s.path, protectingCopyPathElem{
+		key:      key,
+		node:     s.pathNode().element(),
+		presence: s.presence().key(key),
+	})
+}
+
+func (s *protectingCopyState) pushIndex(index int) {
+	s.path = append(s.path, protectingCopyPathElem{
+		index:    index,
+		node:     s.pathNode().element(),
+		presence: s.presence().elem(index),
+	})
+}
+
+// presence returns the presence in the bound body for the current path,
+// or nil if not tracked.
+func (s *protectingCopyState) presence() *protectingCopyPresence {
+	if len(s.path) == 0 {
+		return s.rootPresence
+	}
+	return s.path[len(s.path)-1].presence
+}
+
+// setPresence sets the presence for the current path.
+func (s *protectingCopyState) setPresence(p *protectingCopyPresence) {
+	s.path[len(s.path)-1].presence = p
+}
+
+// fieldPresence returns the presence of field of the struct with the presence p.
+// Returns false if the field is absent (or null without clearNull) in the bound body
+// and must not be copied.
+func (s *protectingCopyState) fieldPresence(p *protectingCopyPresence, field protectingCopyField) (*protectingCopyPresence, bool) {
+	if p == nil {
+		return nil, true
+	}
+	if p.byName && field.embedded != nil && !field.ptr || !p.byName && field.jsonPromoted {
+		return p, true
+	}
+	child, ok := p.field(field)
+	if !ok || (child.null && !s.clearNull) {
+		return nil, false
+	}
+	return child.tracked(), true
+}
+
+// pathNode returns the node of ProtectingCopyPaths for the current path, or nil.
+func (s *protectingCopyState) pathNode() *protectingCopyPathNode {
+	if len(s.path) == 0 {
+		return s.rootNode
+	}
+	return s.path[len(s.path)-1].node
+}
+
+func (s *protectingCopyState) pop() {
+	s.path = s.path[:len(s.path)-1]
+}
+
+// pathString formats the current path like `Items[2].Name`, `Meta["k"]`.
+func (s *protectingCopyState) pathString() string {
+	var buf bytes.Buffer
+	for _, elem := range s.path {
+		switch {
+		case elem.field != "":
+			if buf.Len() > 0 {
+				buf.WriteString(".")
+			}
+			buf.WriteString(elem.field)
+		case elem.key.IsValid():
+			if elem.key.Kind() == reflect.String {
+				fmt.Fprintf(&buf, "[%q]", elem.key.String())
+			} else {
+				fmt.Fprintf(&buf, "[%v]", elem.key.Interface())
+			}
+		default:
+			fmt.Fprintf(&buf, "[%d]", elem.index)
+		}
+	}
+	return buf.String()
+}
+
+// reportSet reports the change by setting src to dst.
+// This must be called before setting.
+func (s *protectingCopyState) reportSet(dst, src reflect.Value) {
+	if s.report == nil || s.creating > 0 {
+		return
+	}
+	s.reportChange(interfaceOf(dst), interfaceOf(src))
+}
+
+// reportChange reports the change from oldValue to newValue
+// if they differ.
+func (s *protectingCopyState) reportChange(oldValue, newValue interface{}) {
+	if s.report == nil || s.creating > 0 || protectingCopyEqual(oldValue, newValue) {
+		return
+	}
+	s.report.Changed = append(s.report.Changed, ProtectingCopyChange{
+		Path: s.pathString(),
+		Old:  oldValue,
+		New:  newValue,
+	})
+}
+
+// reportDiscarded reports protected fields
+// whose values in src are not zero and differ from dst.
+// presence is the presence of the struct in the bound body, or nil.
+func (s *protectingCopyState) reportDiscarded(plan *protectingCopyPlan, presence *protectingCopyPresence, dst, src reflect.Value) {
+	for _, field := range plan.protected {
+		if _, present := s.fieldPresence(presence, field); !present {
+			// not written in the bound body
+			continue
+		}
+		s.pushField(field.name)
+		s.reportDiscardedValue(dst.Field(field.index), src.Field(field.index), presence.hasField(field))
+		s.pop()
+	}
+}
+
+// reportDiscardedValue records the value at the current path is discarded
+// if src is not zero and differs from dst.
+// present is true if the value is present in the bound body,
+// where zero values are also written explicitly.
+func (s *protectingCopyState) reportDiscardedValue(dst, src reflect.Value, present bool) {
+	if !src.CanInterface() {
+		// unexported embedded struct
+		return
+	}
+	sValue := src.Interface()
+	if !present && protectingCopyEqual(reflect.Zero(src.Type()).Interface(), sValue) {
+		return
+	}
+	dValue := dst.Interface()
+	if protectingCopyEqual(dValue, sValue) {
+		return
+	}
+	s.discarded = append(s.discarded, ProtectingCopyChange{
+		Path: s.pathString(),
+		Old:  dValue,
+		New:  sValue,
+	})
+}
+
+// interfaceOf returns the value of v, or nil if v is invalid.
+func interfaceOf(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// protectingCopyEqual tests values are equal.
+// time.Time is compared with Equal
+// as the location does not matter.
+func protectingCopyEqual(a, b interface{}) bool {
+	if aTime, ok := a.(time.Time); ok {
+		if bTime, ok := b.(time.Time); ok {
+			return aTime.Equal(bTime)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// ProtectingCopyFieldProtector is implemented by structs
+// to protect fields depending on values, like write-once fields.
+// ProtectField is called with the receiver in the destination
+// for each field to copy with its name and values in the destination and the source,
+// and protects the field if it returns true.
+// ProtectField is called for all fields before copying any of them,
+// so the receiver is in the state before the copy.
+// It is called also for structs newly created in the destination,
+// where the receiver is the zero value.
+type ProtectingCopyFieldProtector interface {
+	ProtectField(field string, dst, src interface{}) bool
+}
+
+var protectingCopyFieldProtectorType = reflect.TypeOf((*ProtectingCopyFieldProtector)(nil)).Elem()
+
+// ProtectingCopier is the configuration to perform protecting copy.
+// See the package documentation for how values are copied.
 type ProtectingCopier struct {
 	// StructTag is the tag name to test fields not to copy.
 	// If not specified, ProtectingCopyDefaultStructTag is used.
 	StructTag string
+	// WritableTag is the tag name to test fields to copy in the allow-list mode.
+	// If not specified, ProtectingCopyDefaultWritableTag is used.
+	WritableTag string
+	// Mode is the mode for struct types without tags.
+	// Struct types with WritableTag in any fields are always in the allow-list mode,
+	// and ones with only StructTag are in the deny-list mode,
+	// so both modes coexist across nested structs.
+	// In the allow-list mode, StructTag still protects fields.
+	Mode ProtectingCopyMode
 	// ProtectFor is the tag value to test fields not to copy
+	// (or to copy for WritableTag).
+	// A tag value prefixed with "!" is a negation:
+	// `protectfor:"update,!admin"` protects the field for "update"
+	// unless "admin" is also specified.
+	// A tag only with negations matches any purposes except negated ones.
 	ProtectFor string
+	// Purposes are tag values to test fields in addition to ProtectFor.
+	Purposes []string
+	// Match is how tag values match ProtectFor and Purposes.
+	Match ProtectingCopyMatch
+	// Types specifies how to copy specific types like time.Time.
+	// If not specified, the one created with NewProtectingCopyTypes is used.
+	// Values of opaque types and ones copied with functions may be shared
+	// with the source (e.g. the mutable *multipart.FileHeader).
+	Types *ProtectingCopyTypes
+	// ProtectPaths specifies fields to protect in addition to tags.
+	// Copying values of other types than the one ProtectPaths is created for fails.
+	ProtectPaths *ProtectingCopyPaths
+	// ProtectField is called for each field to copy
+	// with the path of the field and values in the destination and the source,
+	// and protects the field if it returns true.
+	// Structs can also implement ProtectingCopyFieldProtector.
+	ProtectField func(path string, dst, src interface{}) bool
+	// MapTag is the tag name of policies of map fields.
+	// If not specified, ProtectingCopyDefaultMapTag is used.
+	// The tag value is comma-separated options:
+	//
+	//   - "replace" removes keys absent in the source (default).
+	//   - "merge" only adds or updates keys.
+	//   - "protectexisting" only adds keys absent in the destination.
+	//   - "protect=key1|key2" protects the keys from being added, updated or removed.
+	//
+	// e.g. `protectmap:"merge,protect=owner"`
+	MapTag string
+	// TransformTag is the tag name of transforms of fields.
+	// If not specified, ProtectingCopyDefaultTransformTag is used.
+	// The tag value is comma-separated names of transforms in Transforms
+	// applied in order to values copied from the source,
+	// with arguments following "=" if any.
+	//
+	// e.g. `protecttransform:"trim,lower"`, `protecttransform:"truncate=1s"`
+	TransformTag string
+	// Transforms is transforms available in TransformTag.
+	// If not specified, the one created with NewProtectingCopyTransforms is used.
+	// Transforms are not applied to structs implementing datastore.PropertyLoadSaver.
+	Transforms *ProtectingCopyTransforms
+	// KeyTag is the tag name of key fields for ProtectingCopySliceMergeByKey.
+	// If not specified, ProtectingCopyDefaultKeyTag is used.
+	KeyTag string
+	// SliceStrategy is how to copy slices.
+	// Slices in interfaces are always copied as ProtectingCopySliceReplace.
+	SliceStrategy ProtectingCopySliceStrategy
+	// Strict makes Copy fail with ErrCopyProtected
+	// if the source has values for protected fields
+	// which differ from the destination.
+	// Zero values in the source are not treated as values to write,
+	// unless they are present in the body bound with BindRequest.
+	// The destination may be modified even when failed.
+	Strict bool
+	// ClearNull makes Bind copy fields explicitly null in the request body,
+	// which clears them to zero values.
+	// Otherwise null is treated as absent and the field is kept.
+	ClearNull bool
+	// Unexported is how to treat unexported fields.
+	// Unexported fields are kept in the destination by default.
+	Unexported ProtectingCopyUnexported
+	// Uncopyable is how to treat chans, funcs and unsafe.Pointer,
+	// which are shared with the source by default.
+	// Specify ProtectingCopyUncopyableSkip or ProtectingCopyUncopyableError
+	// not to share them.
+	Uncopyable ProtectingCopyUncopyable
 }
 
 // Copy performs deepcopy protecting fields specified with tag.
@@ -96,6 +774,154 @@ type ProtectingCopier struct {
 // * src and dst are the non-nil map.
 // * src and dst are the non-nil slice with the same length.
 func (c *ProtectingCopier) Copy(dst, src interface{}) error {
+	return c.copy(&protectingCopyState{}, dst, src)
+}
+
+// CopyWithReport performs Copy and reports
+// values changed in dst and protected values discarded from src.
+func (c *ProtectingCopier) CopyWithReport(dst, src interface{}) (*ProtectingCopyReport, error) {
+	s := &protectingCopyState{
+		report: &ProtectingCopyReport{},
+	}
+	if err := c.copy(s, dst, src); err != nil {
+		return nil, err
+	}
+	return s.report, nil
+}
+
+// Bind binds to a new value with binder (e.g. echo.Context.Bind()),
+// and copies it to dst.
+// binder is passed a pointer to a new value of the type dst points to.
+// All fields are copied as Copy does: use BindRequest to copy only fields present in the request.
+func (c *ProtectingCopier) Bind(binder func(dst interface{}) error, dst interface{}) error {
+	s := &protectingCopyState{}
+	src, err := bindToNew(s, nil, binder, dst)
+	if err != nil {
+		return err
+	}
+	return c.copy(s, dst, src)
+}
+
+// BindWithReport is Bind also reporting changes like CopyWithReport.
+func (c *ProtectingCopier) BindWithReport(binder func(dst interface{}) error, dst interface{}) (*ProtectingCopyReport, error) {
+	s := &protectingCopyState{
+		report: &ProtectingCopyReport{},
+	}
+	src, err := bindToNew(s, nil, binder, dst)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.copy(s, dst, src); err != nil {
+		return nil, err
+	}
+	return s.report, nil
+}
+
+// BindRequest is Bind copying only fields whose keys are present in req
+// at every nesting level.
+// Values of maps and elements of slices are merged the same way:
+// a map value for a key present in dst and an element at an index
+// within dst are updated only with fields present in req
+// (as encoding/json decodes arrays into slices),
+// while new keys and indexes are created from req.
+// Keys are looked up as echo.DefaultBinder binds req:
+// the JSON body, the form body ("form" tags),
+// or the query string of GET and DELETE without body ("query" tags).
+// The JSON body is buffered for binder.
+// Fields explicitly null in the JSON body are kept unless ClearNull is set.
+// All fields are copied for other requests like XML.
+func (c *ProtectingCopier) BindRequest(req *http.Request, binder func(dst interface{}) error, dst interface{}) error {
+	s := &protectingCopyState{}
+	src, err := bindToNew(s, req, binder, dst)
+	if err != nil {
+		return err
+	}
+	return c.copy(s, dst, src)
+}
+
+// BindRequestWithReport is BindRequest also reporting changes like CopyWithReport.
+func (c *ProtectingCopier) BindRequestWithReport(req *http.Request, binder func(dst interface{}) error, dst interface{}) (*ProtectingCopyReport, error) {
+	s := &protectingCopyState{
+		report: &ProtectingCopyReport{},
+	}
+	src, err := bindToNew(s, req, binder, dst)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.copy(s, dst, src); err != nil {
+		return nil, err
+	}
+	return s.report, nil
+}
+
+// planKey returns the key of plans for this configuration.
+func (c *ProtectingCopier) planKey() protectingCopyPlanKey {
+	key := protectingCopyPlanKey{
+		types:        c.Types,
+		structTag:    c.StructTag,
+		writableTag:  c.WritableTag,
+		keyTag:       c.KeyTag,
+		mapTag:       c.MapTag,
+		transformTag: c.TransformTag,
+		unexported:   c.Unexported,
+		mode:         c.Mode,
+		match:        c.Match,
+	}
+	if key.types == nil {
+		key.types = defaultProtectingCopyTypes
+	}
+	if key.structTag == "" {
+		key.structTag = ProtectingCopyDefaultStructTag
+	}
+	if key.writableTag == "" {
+		key.writableTag = ProtectingCopyDefaultWritableTag
+	}
+	if key.keyTag == "" {
+		key.keyTag = ProtectingCopyDefaultKeyTag
+	}
+	if key.mapTag == "" {
+		key.mapTag = ProtectingCopyDefaultMapTag
+	}
+	if key.transformTag == "" {
+		key.transformTag = ProtectingCopyDefaultTransformTag
+	}
+	purposes := []string{}
+	for _, purpose := range append([]string{c.ProtectFor}, c.Purposes...) {
+		if purpose != "" && !containsString(purposes, purpose) {
+			purposes = append(purposes, purpose)
+		}
+	}
+	sort.Strings(purposes)
+	key.purposes = strings.Join(purposes, ",")
+	return key
+}
+
+// copy is the implementation of Copy.
+func (c *ProtectingCopier) copy(s *protectingCopyState, dst, src interface{}) error {
+	s.strict = c.Strict
+	s.clearNull = c.ClearNull
+	s.planKey = c.planKey()
+	s.transforms = c.Transforms
+	if s.transforms == nil {
+		s.transforms = defaultProtectingCopyTransforms
+	}
+	if c.ProtectPaths != nil {
+		s.rootNode = c.ProtectPaths.root
+	}
+	if err := c.copyRoot(s, dst, src); err != nil {
+		return s.locateError(err, reflect.ValueOf(dst), reflect.ValueOf(src))
+	}
+	if s.report != nil {
+		s.report.Discarded = s.discarded
+	}
+	if s.strict && len(s.discarded) > 0 {
+		return s.locateError(NewErrCopyProtected(s.discarded), reflect.ValueOf(dst), reflect.ValueOf(src))
+	}
+	return nil
+}
+
+// copyRoot checks dst and src and copies.
+func (c *ProtectingCopier) copyRoot(s *protectingCopyState, dst, src interface{}) error {
 	dValue := reflect.ValueOf(dst)
 	sValue := reflect.ValueOf(src)
 	dType := reflect.TypeOf(dst)
@@ -103,153 +929,621 @@ func (c *ProtectingCopier) Copy(dst, src interface{}) error {
 
 	if !dValue.IsValid() {
 		// dst == nil
-		return &ErrCopyValueInvalid{
-			msg: "Cannot copy as dst is nil",
+		return NewErrCopyValueInvalid("Cannot copy as dst is nil")
+	}
+
+	if !sValue.IsValid() {
+		// src == nil
+		return NewErrCopyValueInvalid("Cannot copy as src is nil")
+	}
+
+	if dType != sType {
+		return NewErrCopyTypeMismatch(dType, sType)
+	}
+
+	if c.ProtectPaths != nil {
+		pathsType := sType
+		for pathsType.Kind() == reflect.Ptr {
+			pathsType = pathsType.Elem()
+		}
+		if pathsType != c.ProtectPaths.typ {
+			return NewErrCopyTypeMismatch(c.ProtectPaths.typ, pathsType)
+		}
+	}
+
+	switch sType.Kind() {
+	case reflect.Ptr:
+		s.visit(dValue, sValue)
+		return c.copyImpl(s, dValue.Elem(), sValue.Elem())
+	case reflect.Map:
+		s.visit(dValue, sValue)
+		return c.copyMapImpl(s, nil, dValue, sValue)
+	case reflect.Slice:
+		if sValue.Len() != dValue.Len() {
+			return NewErrCopyValueInvalid("lengths of src and dst must be the same")
+		}
+		s.visit(dValue, sValue)
+		return c.copySliceOrArrayImpl(s, dValue, sValue)
+	}
+
+	return NewErrCopyValueInvalid("dst must be a pointer or a map")
+}
+
+// copyImpl is a sub function of ProtectingCopier.Copy
+// Errors are located at the current path.
+// This assumes values are:
+// * CanSet()
+// * Same static types
+func (c *ProtectingCopier) copyImpl(s *protectingCopyState, dst, src reflect.Value) error {
+	if err := c.copyValue(s, dst, src); err != nil {
+		return s.locateError(err, dst, src)
+	}
+	return nil
+}
+
+// copyValue copies values by kinds.
+// This assumes values are:
+// * CanSet()
+// * Same static types
+func (c *ProtectingCopier) copyValue(s *protectingCopyState, dst, src reflect.Value) error {
+	if handler, ok := s.planKey.types.lookup(src.Type()); ok {
+		return c.copyRegistered(s, handler, dst, src)
+	}
+	if src.Type() == propertyListType {
+		return c.copyPropertyList(s, dst, src)
+	}
+	switch src.Kind() {
+	case reflect.Interface:
+		return c.copyInterface(s, dst, src)
+	case reflect.Struct:
+		return c.copyStruct(s, dst, src)
+	case reflect.Slice:
+		return c.copySlice(s, dst, src)
+	case reflect.Array:
+		return c.copyArray(s, dst, src)
+	case reflect.Map:
+		return c.copyMap(s, dst, src)
+	case reflect.Ptr:
+		return c.copyPtr(s, dst, src)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return c.copyUncopyable(s, dst, src)
+	}
+
+	// non-structured types
+	s.reportSet(dst, src)
+	dst.Set(src)
+	return nil
+}
+
+// copyUncopyable copies chans, funcs and unsafe.Pointer
+// according to ProtectingCopier.Uncopyable.
+// nil is always copied as it shares nothing.
+// This assumes values are:
+// * CanSet()
+// * Same static types
+func (c *ProtectingCopier) copyUncopyable(s *protectingCopyState, dst, src reflect.Value) error {
+	if !src.IsNil() {
+		switch c.Uncopyable {
+		case ProtectingCopyUncopyableSkip:
+			return nil
+		case ProtectingCopyUncopyableError:
+			return newErrCopyValueInvalid(ProtectingCopyReasonUncopyable, fmt.Sprintf("cannot copy %v", src.Type()))
+		}
+	}
+	s.reportSet(dst, src)
+	dst.Set(src)
+	return nil
+}
+
+// copyRegistered copies values of types registered in ProtectingCopyTypes.
+// This assumes values are:
+// * CanSet()
+// * Same static types
+func (c *ProtectingCopier) copyRegistered(s *protectingCopyState, handler protectingCopyTypeHandler, dst, src reflect.Value) error {
+	if handler.copyFunc == nil {
+		// opaque
+		s.reportSet(dst, src)
+		dst.Set(src)
+		return nil
+	}
+	var oldValue interface{}
+	if s.report != nil {
+		oldValue = dst.Interface()
+	}
+	if err := handler.copyFunc(dst, src); err != nil {
+		return err
+	}
+	s.reportChange(oldValue, dst.Interface())
+	return nil
+}
+
+// setCopiedDest sets a new copy of src to dst.
+// This assumes dst is CanSet()
+func (c *ProtectingCopier) setCopiedDest(s *protectingCopyState, dst, src reflect.Value) error {
+	_dst, err := c.createCopiedDest(s, src)
+	if err != nil {
+		return err
+	}
+	s.reportChange(interfaceOf(dst), interfaceOf(_dst))
+	dst.Set(_dst)
+	return nil
+}
+
+// copyInterface is a sub function of ProtectingCopier.Copy
+// This assumes values are:
+// * reflect.Interface
+// * CanSet()
+func (c *ProtectingCopier) copyInterface(s *protectingCopyState, dst, src reflect.Value) error {
+	if src.IsNil() {
+		s.reportSet(dst, src)
+		dst.Set(src)
+		return nil
+	}
+	sType := reflect.TypeOf(src.Interface())
+	dType := reflect.TypeOf(dst.Interface())
+	if _, ok := s.planKey.types.lookup(sType); ok {
+		return c.setCopiedDest(s, dst, src.Elem())
+	}
+	switch sType.Kind() {
+	case reflect.Slice:
+		if src.Elem().IsNil() {
+			s.reportSet(dst, src)
+			dst.Set(src)
+			return nil
+		} else if dType != sType || dst.IsNil() || dst.Elem().IsNil() || dst.Elem().Len() != src.Elem().Len() || !s.canCopyInto(dst.Elem(), src.Elem()) {
+			return c.setCopiedDest(s, dst, src.Elem())
+		}
+		return c.copyImpl(s, dst.Elem(), src.Elem())
+	case reflect.Map, reflect.Ptr:
+		if src.Elem().IsNil() {
+			s.reportSet(dst, src)
+			dst.Set(src)
+			return nil
+		} else if dType != sType || dst.IsNil() || dst.Elem().IsNil() || !s.canCopyInto(dst.Elem(), src.Elem()) {
+			return c.setCopiedDest(s, dst, src.Elem())
+		}
+		return c.copyImpl(s, dst.Elem(), src.Elem())
+	}
+
+	// non-pointer types in interface are unmodifiable
+	return c.setCopiedDest(s, dst, src.Elem())
+}
+
+// copyStruct is a sub function of ProtectingCopier.Copy
+// This assumes values are:
+// * reflect.Struct
+// * CanSet()
+// * types are same
+func (c *ProtectingCopier) copyStruct(s *protectingCopyState, dst, src reflect.Value) error {
+	plan := c.structPlan(s, src.Type())
+	if plan.loadSaver {
+		return c.copyPropertyLoadSaver(s, plan, dst, src)
+	}
+	return c.copyStructPlan(s, plan, dst, src)
+}
+
+// copyStructPlan copies fields of src to dst according to plan.
+func (c *ProtectingCopier) copyStructPlan(s *protectingCopyState, plan *protectingCopyPlan, dst, src reflect.Value) error {
+	if plan.unexported {
+		for _, field := range plan.fields {
+			if field.unexported && c.Unexported == ProtectingCopyUnexportedError {
+				return newErrCopyValueInvalid(ProtectingCopyReasonUnexported, fmt.Sprintf("cannot copy unexported field %v of %v", field.name, src.Type()))
+			}
+		}
+		if !src.CanAddr() {
+			// unexported fields are exposed with addresses.
+			addressable := reflect.New(src.Type()).Elem()
+			addressable.Set(src)
+			src = addressable
+		}
+	}
+	presence := s.presence()
+	if plan.unmarshaler {
+		presence = nil
+	}
+	if s.report != nil || s.strict {
+		s.reportDiscarded(plan, presence, dst, src)
+	}
+	var hooked []bool
+	if plan.protector || c.ProtectField != nil {
+		// decide before copying as hooks may refer other fields in dst.
+		hooked = make([]bool, len(plan.fields))
+		for idx, field := range plan.fields {
+			if field.embedded != nil {
+				// promoted fields are tested in copyEmbedded
+				continue
+			}
+			if _, present := s.fieldPresence(presence, field); !present {
+				continue
+			}
+			dValue, sValue, err := fieldValues(field, dst, src)
+			if err != nil {
+				return err
+			}
+			s.pushField(field.name)
+			hooked[idx] = !s.pathNode().isProtected() &&
+				c.isProtectedByHook(s, plan, field.name, dst, dValue, sValue)
+			s.pop()
+		}
+	}
+	for idx, field := range plan.fields {
+		fieldPresence, present := s.fieldPresence(presence, field)
+		if !present {
+			// not in the bound body
+			continue
+		}
+		dValue, sValue, err := fieldValues(field, dst, src)
+		if err != nil {
+			return err
+		}
+		s.pushField(field.name)
+		s.setPresence(fieldPresence)
+		if s.pathNode().isProtected() || (hooked != nil && hooked[idx]) {
+			if s.report != nil || s.strict {
+				s.reportDiscardedValue(dValue, sValue, presence.hasField(field))
+			}
+		} else if field.embedded != nil {
+			err = c.copyEmbedded(s, field, dValue, sValue)
+		} else if field.transforms != nil {
+			err = c.copyTransformed(s, field, dValue, sValue)
+		} else if field.mapPolicy != nil {
+			err = c.copyMapWithPolicy(s, field.mapPolicy, dValue, sValue)
+		} else if field.simple {
+			s.reportSet(dValue, sValue)
+			dValue.Set(sValue)
+		} else {
+			err = c.copyImpl(s, dValue, sValue)
+		}
+		if err != nil {
+			return s.locateError(err, dValue, sValue)
+		}
+		s.pop()
+	}
+	return nil
+}
+
+// fieldValues returns values of field in dst and src,
+// exposing unexported fields.
+func fieldValues(field protectingCopyField, dst, src reflect.Value) (reflect.Value, reflect.Value, error) {
+	dValue := dst.Field(field.index)
+	sValue := src.Field(field.index)
+	if !field.unexported {
+		return dValue, sValue, nil
+	}
+	dValue, err := exposeUnexported(dValue)
+	if err != nil {
+		return reflect.Value{}, reflect.Value{}, err
+	}
+	sValue, err = exposeUnexported(sValue)
+	if err != nil {
+		return reflect.Value{}, reflect.Value{}, err
+	}
+	return dValue, sValue, nil
+}
+
+// copyEmbedded copies the embedded struct or pointer to struct
+// as promoted fields of the embedding struct.
+// An embedded pointer is created in dst only if src has it,
+// and nil in src is treated as a struct with zero values.
+func (c *ProtectingCopier) copyEmbedded(s *protectingCopyState, field protectingCopyField, dst, src reflect.Value) error {
+	if !field.ptr {
+		return c.copyStructPlan(s, field.embedded, dst, src)
+	}
+	if src.IsNil() {
+		if dst.IsNil() {
+			return nil
 		}
+		return c.copyStructPlan(s, field.embedded, dst.Elem(), reflect.Zero(src.Type().Elem()))
 	}
-
-	if !sValue.IsValid() {
-		// src == nil
-		return &ErrCopyValueInvalid{
-			msg: "Cannot copy as src is nil",
+	if dst.IsNil() {
+		created := reflect.New(src.Type().Elem())
+		s.creating++
+		err := c.copyStructPlan(s, field.embedded, created.Elem(), src.Elem())
+		s.creating--
+		if err != nil {
+			return err
 		}
+		s.reportChange(interfaceOf(dst), created.Interface())
+		dst.Set(created)
+		return nil
 	}
+	return c.copyStructPlan(s, field.embedded, dst.Elem(), src.Elem())
+}
 
-	if dType != sType {
-		return NewErrCopyTypeMismatch(dType, sType)
+// isProtectedByHook tests whether the field name of the struct dst is protected
+// with ProtectingCopyFieldProtector or ProtectingCopier.ProtectField.
+func (c *ProtectingCopier) isProtectedByHook(s *protectingCopyState, plan *protectingCopyPlan, name string, dst, dValue, sValue reflect.Value) bool {
+	if plan.protector && dst.CanAddr() && dst.Addr().CanInterface() {
+		protector := dst.Addr().Interface().(ProtectingCopyFieldProtector)
+		if protector.ProtectField(name, dValue.Interface(), sValue.Interface()) {
+			return true
+		}
 	}
+	return c.ProtectField != nil && c.ProtectField(s.pathString(), dValue.Interface(), sValue.Interface())
+}
 
-	switch sType.Kind() {
-	case reflect.Ptr:
-		return c.copyImpl(dValue.Elem(), sValue.Elem())
-	case reflect.Map:
-		return c.copyMapImpl(dValue, sValue)
-	case reflect.Slice:
-		if sValue.Len() != dValue.Len() {
-			return &ErrCopyValueInvalid{
-				msg: "lengths of src and dst must be the same",
-			}
-		}
-		return c.copySliceOrArrayImpl(dValue, sValue)
+// structPlan returns the plan to copy the struct type sType,
+// building it at the first call.
+// Plans are cached in ProtectingCopyTypes of the copy.
+func (c *ProtectingCopier) structPlan(s *protectingCopyState, sType reflect.Type) *protectingCopyPlan {
+	key := s.planKey
+	key.sType = sType
+	plans := key.types.planCache()
+	if plan, ok := plans.Load(key); ok {
+		return plan.(*protectingCopyPlan)
 	}
+	plan, _ := plans.LoadOrStore(key, buildStructPlan(key))
+	return plan.(*protectingCopyPlan)
+}
 
-	return &ErrCopyValueInvalid{
-		msg: "dst must be a pointer or a map",
+// buildStructPlan lists fields of the struct type to copy.
+func buildStructPlan(key protectingCopyPlanKey) *protectingCopyPlan {
+	var purposes []string
+	if key.purposes != "" {
+		purposes = strings.Split(key.purposes, ",")
+	}
+	b := &protectingCopyPlanBuilder{
+		key:      key,
+		purposes: purposes,
+		mode:     key.mode,
+	}
+	embedding := []reflect.Type{key.sType}
+	if hasWritable, hasProtect := b.lookupTags(key.sType, embedding); hasWritable {
+		b.mode = ProtectingCopyAllowList
+	} else if hasProtect {
+		b.mode = ProtectingCopyDenyList
 	}
+	return b.build(key.sType, nil, protectingCopyInheritance{}, embedding)
 }
 
-// copyImpl is a sub function of ProtectingCopier.Copy
-// This assumes values are:
-// * CanSet()
-// * Same static types
-func (c *ProtectingCopier) copyImpl(dst, src reflect.Value) error {
-	switch src.Kind() {
-	case reflect.Interface:
-		return c.copyInterface(dst, src)
-	case reflect.Struct:
-		return c.copyStruct(dst, src)
-	case reflect.Slice:
-		return c.copySlice(dst, src)
-	case reflect.Array:
-		return c.copyArray(dst, src)
-	case reflect.Map:
-		return c.copyMap(dst, src)
-	case reflect.Ptr:
-		return c.copyPtr(dst, src)
+// protectingCopyPlanBuilder builds the plan of a struct type
+// including promoted fields of embedded structs.
+type protectingCopyPlanBuilder struct {
+	key      protectingCopyPlanKey
+	purposes []string
+	mode     ProtectingCopyMode
+}
+
+// protectingCopyInheritance is tags of embedded fields
+// inherited by promoted fields.
+type protectingCopyInheritance struct {
+	// protected is true if any of embedded fields is protected.
+	protected bool
+	// hasWritable is true if any of embedded fields has WritableTag,
+	// and writable is whether the nearest one matches.
+	hasWritable bool
+	writable    bool
+}
+
+// promoted returns the type of the struct
+// if fields of the embedded field are promoted.
+// embedding is the list of struct types embedding the field
+// to treat recursive embedding as an ordinary field.
+func (b *protectingCopyPlanBuilder) promoted(field reflect.StructField, embedding []reflect.Type) (reflect.Type, bool) {
+	if !field.Anonymous {
+		return nil, false
+	}
+	typ := field.Type
+	if typ.Kind() == reflect.Ptr {
+		if field.PkgPath != "" {
+			// cannot be created
+			return nil, false
+		}
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, false
+	}
+	if _, ok := b.key.types.lookup(field.Type); ok {
+		return nil, false
 	}
+	if _, ok := b.key.types.lookup(typ); ok {
+		return nil, false
+	}
+	for _, t := range embedding {
+		if t == typ {
+			return nil, false
+		}
+	}
+	return typ, true
+}
 
-	// non-structured types
-	dst.Set(src)
-	return nil
+// lookupTags tests whether fields of sType including promoted ones
+// have WritableTag or StructTag.
+func (b *protectingCopyPlanBuilder) lookupTags(sType reflect.Type, embedding []reflect.Type) (hasWritable, hasProtect bool) {
+	for idx := 0; idx < sType.NumField(); idx++ {
+		field := sType.Field(idx)
+		elemType, promoted := b.promoted(field, embedding)
+		if field.PkgPath == "" || promoted {
+			if _, ok := field.Tag.Lookup(b.key.writableTag); ok {
+				hasWritable = true
+			}
+			if _, ok := field.Tag.Lookup(b.key.structTag); ok {
+				hasProtect = true
+			}
+		}
+		if promoted {
+			writable, protect := b.lookupTags(elemType, append(embedding[:len(embedding):len(embedding)], elemType))
+			hasWritable = hasWritable || writable
+			hasProtect = hasProtect || protect
+		}
+	}
+	return hasWritable, hasProtect
 }
 
-// copyInterface is a sub function of ProtectingCopier.Copy
-// This assumes values are:
-// * reflect.Interface
-// * CanSet()
-func (c *ProtectingCopier) copyInterface(dst, src reflect.Value) error {
-	if src.IsNil() {
-		dst.Set(src)
-		return nil
+// build builds the plan for sType at index in the root struct.
+func (b *protectingCopyPlanBuilder) build(sType reflect.Type, index []int, inherited protectingCopyInheritance, embedding []reflect.Type) *protectingCopyPlan {
+	plan := &protectingCopyPlan{
+		protector:   reflect.PtrTo(sType).Implements(protectingCopyFieldProtectorType),
+		keyIndex:    -1,
+		unmarshaler: reflect.PtrTo(sType).Implements(jsonUnmarshalerType),
+		loadSaver:   reflect.PtrTo(sType).Implements(propertyLoadSaverType),
+		properties:  map[string]protectingCopyProperty{},
 	}
-	sType := reflect.TypeOf(src.Interface())
-	dType := reflect.TypeOf(dst.Interface())
-	switch sType.Kind() {
-	case reflect.Slice:
-		if src.Elem().IsNil() {
-			dst.Set(src)
-			return nil
-		} else if dType != sType || dst.IsNil() || dst.Elem().IsNil() || dst.Elem().Len() != src.Elem().Len() {
-			if _dst, err := c.createCopiedDest(src.Elem()); err == nil {
-				dst.Set(_dst)
-			} else {
-				return err
+	for idx := 0; idx < sType.NumField(); idx++ {
+		field := sType.Field(idx)
+		fieldIndex := append(index[:len(index):len(index)], idx)
+		if _, ok := field.Tag.Lookup(b.key.keyTag); ok && len(index) == 0 && field.PkgPath == "" && plan.keyIndex < 0 {
+			plan.keyIndex = idx
+		}
+		jsonKey, jsonPromoted := jsonFieldKey(field)
+		propertyName, propertyPromoted := datastorePropertyName(field)
+		if elemType, ok := b.promoted(field, embedding); ok {
+			embedded := b.build(
+				elemType,
+				fieldIndex,
+				b.inherit(inherited, field),
+				append(embedding[:len(embedding):len(embedding)], elemType),
+			)
+			plan.fields = append(plan.fields, protectingCopyField{
+				index:        idx,
+				name:         field.Name,
+				jsonKey:      jsonKey,
+				jsonPromoted: jsonPromoted,
+				embedded:     embedded,
+				ptr:          field.Type.Kind() == reflect.Ptr,
+			})
+			if propertyPromoted {
+				for name, property := range embedded.properties {
+					if _, ok := plan.properties[name]; !ok {
+						plan.properties[name] = property
+					}
+				}
+			} else if propertyName != "" {
+				plan.properties[propertyName] = protectingCopyProperty{name: field.Name}
 			}
-			return nil
+			continue
 		}
-		return c.copyImpl(dst.Elem(), src.Elem())
-	case reflect.Map, reflect.Ptr:
-		if src.Elem().IsNil() {
-			dst.Set(src)
-			return nil
-		} else if dType != sType || dst.IsNil() || dst.Elem().IsNil() {
-			if _dst, err := c.createCopiedDest(src.Elem()); err == nil {
-				dst.Set(_dst)
-			} else {
-				return err
+		if field.PkgPath != "" && b.key.unexported == ProtectingCopyUnexportedSkip {
+			// unexported field. skip.
+			continue
+		}
+		_, registered := b.key.types.lookup(field.Type)
+		planField := protectingCopyField{
+			index:      idx,
+			name:       field.Name,
+			simple:     isSimpleKind(field.Type.Kind()) && !registered,
+			jsonKey:    jsonKey,
+			unexported: field.PkgPath != "",
+		}
+		if v, ok := field.Tag.Lookup(b.key.mapTag); ok {
+			planField.mapPolicy = parseProtectingCopyMapPolicy(b.key.mapTag, v, field)
+			planField.simple = false
+		}
+		if v, ok := field.Tag.Lookup(b.key.transformTag); ok {
+			planField.transforms = parseProtectingCopyTransforms(b.key.transformTag, v, field)
+			planField.simple = false
+		}
+		writable := b.isWritable(field, inherited) && !b.isShadowed(field.Name, fieldIndex)
+		if writable {
+			plan.fields = append(plan.fields, planField)
+			plan.unexported = plan.unexported || planField.unexported
+		} else {
+			plan.protected = append(plan.protected, planField)
+		}
+		if propertyName != "" {
+			plan.properties[propertyName] = protectingCopyProperty{
+				name:      field.Name,
+				protected: !writable,
 			}
-			return nil
 		}
-		return c.copyImpl(dst.Elem(), src.Elem())
 	}
+	return plan
+}
+
+// inherit returns the inheritance for fields promoted through field.
+func (b *protectingCopyPlanBuilder) inherit(inherited protectingCopyInheritance, field reflect.StructField) protectingCopyInheritance {
+	if matchTagValues(field.Tag.Get(b.key.structTag), b.purposes, b.key.match) {
+		inherited.protected = true
+	}
+	if v, ok := field.Tag.Lookup(b.key.writableTag); ok {
+		inherited.hasWritable = true
+		inherited.writable = matchTagValues(v, b.purposes, b.key.match)
+	}
+	return inherited
+}
 
-	// non-pointer types in interface are unmodifiable
-	if _dst, err := c.createCopiedDest(src.Elem()); err == nil {
-		dst.Set(_dst)
-	} else {
-		return err
+// isWritable tests whether field is copied.
+func (b *protectingCopyPlanBuilder) isWritable(field reflect.StructField, inherited protectingCopyInheritance) bool {
+	if inherited.protected || matchTagValues(field.Tag.Get(b.key.structTag), b.purposes, b.key.match) {
+		return false
 	}
-	return nil
+	if b.mode != ProtectingCopyAllowList {
+		return true
+	}
+	if v, ok := field.Tag.Lookup(b.key.writableTag); ok {
+		// tags of the field itself override embedded fields.
+		return matchTagValues(v, b.purposes, b.key.match)
+	}
+	return inherited.hasWritable && inherited.writable
 }
 
-// copyStruct is a sub function of ProtectingCopier.Copy
-// This assumes values are:
-// * reflect.Struct
-// * CanSet()
-// * types are same
-func (c *ProtectingCopier) copyStruct(dst, src reflect.Value) error {
-	// special cases
-	if IsNonStruct(src.Interface()) {
-		dst.Set(src)
-		return nil
+// isShadowed tests whether the field at index in the root struct
+// is shadowed by another field with the same name (or ambiguous).
+func (b *protectingCopyPlanBuilder) isShadowed(name string, index []int) bool {
+	if len(index) <= 1 {
+		return false
 	}
-	sType := reflect.TypeOf(src.Interface())
-	tagName := c.StructTag
-	if tagName == "" {
-		tagName = ProtectingCopyDefaultStructTag
+	field, ok := b.key.sType.FieldByName(name)
+	return !ok || !reflect.DeepEqual(field.Index, index)
+}
+
+// matchTagValues tests whether the comma-separated tagValues matches purposes.
+func matchTagValues(tagValues string, purposes []string, match ProtectingCopyMatch) bool {
+	if tagValues == "" {
+		return false
 	}
-FIELDS:
-	for idx := 0; idx < sType.NumField(); idx++ {
-		field := sType.Field(idx)
-		if field.PkgPath != "" {
-			// unexported field. skip.
+	positives := []string{}
+	for _, tagValue := range strings.Split(tagValues, ",") {
+		if strings.HasPrefix(tagValue, "!") {
+			if containsString(purposes, tagValue[1:]) {
+				return false
+			}
 			continue
 		}
-		tagValues := field.Tag.Get(tagName)
-		if tagValues != "" {
-			for _, tagValue := range strings.Split(tagValues, ",") {
-				if c.ProtectFor == tagValue {
-					continue FIELDS
-				}
+		positives = append(positives, tagValue)
+	}
+	if len(positives) == 0 {
+		// only negations
+		return true
+	}
+	if len(purposes) == 0 {
+		return false
+	}
+	for _, purpose := range purposes {
+		if containsString(positives, purpose) {
+			if match == ProtectingCopyMatchAny {
+				return true
 			}
+		} else if match == ProtectingCopyMatchAll {
+			return false
 		}
-		sValue := src.Field(idx)
-		dValue := dst.Field(idx)
-		if err := c.copyImpl(dValue, sValue); err != nil {
-			return err
+	}
+	return match == ProtectingCopyMatchAll
+}
+
+// containsString tests whether values contains value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
 		}
 	}
-	return nil
+	return false
+}
+
+// isSimpleKind tests values of the kind contain no references
+// and can be copied just with Set.
+func isSimpleKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128,
+		reflect.String:
+		return true
+	}
+	return false
 }
 
 // copyPtr is a sub function of ProtectingCopier.Copy
@@ -257,15 +1551,21 @@ FIELDS:
 // * reflect.Ptr
 // * CanSet()
 // * types are same
-func (c *ProtectingCopier) copyPtr(dst, src reflect.Value) error {
+func (c *ProtectingCopier) copyPtr(s *protectingCopyState, dst, src reflect.Value) error {
 	if src.IsNil() {
+		s.reportSet(dst, src)
 		dst.Set(src)
 		return nil
 	}
-	if dst.IsNil() {
-		dst.Set(reflect.New(reflect.TypeOf(src.Interface()).Elem()))
+	if visited, ok := s.lookupVisited(src); ok {
+		s.setVisited(dst, visited)
+		return nil
 	}
-	return c.copyImpl(dst.Elem(), src.Elem())
+	if dst.IsNil() || !s.canCopyInto(dst, src) {
+		return c.setCopiedDest(s, dst, src)
+	}
+	s.visit(dst, src)
+	return c.copyImpl(s, dst.Elem(), src.Elem())
 }
 
 // copySlice is a sub function of ProtectingCopier.Copy
@@ -273,8 +1573,9 @@ func (c *ProtectingCopier) copyPtr(dst, src reflect.Value) error {
 // * reflect.Slice
 // * CanSet()
 // * types are same
-func (c *ProtectingCopier) copySlice(dst, src reflect.Value) error {
+func (c *ProtectingCopier) copySlice(s *protectingCopyState, dst, src reflect.Value) error {
 	if src.IsNil() {
+		s.reportSet(dst, src)
 		dst.Set(src)
 		return nil
 	}
@@ -290,17 +1591,184 @@ func (c *ProtectingCopier) copySlice(dst, src reflect.Value) error {
 	// 	dst.SetLen(src.Len())
 	// }
 
+	if visited, ok := s.lookupVisited(src); ok {
+		s.setVisited(dst, visited)
+		return nil
+	}
+
+	if dst.CanSet() {
+		if plan := c.slicePlan(s, src.Type()); plan != nil {
+			return c.mergeSlice(s, plan, dst, src)
+		}
+	}
+
+	if dst.Len() != src.Len() && s.presence() != nil && dst.CanSet() && s.canCopyInto(dst, src) {
+		return c.mergeSliceByIndex(s, dst, src)
+	}
+
 	// Safer way.
-	if dst.Len() != src.Len() {
-		if _dst, err := c.createCopiedDest(src); err == nil {
-			dst.Set(_dst)
+	if dst.Len() != src.Len() || !s.canCopyInto(dst, src) {
+		return c.setCopiedDest(s, dst, src)
+	}
+
+	s.visit(dst, src)
+	return c.copySliceOrArrayImpl(s, dst, src)
+}
+
+// mergeSliceByIndex copies src to a new slice with the length of src
+// merging elements into ones of dst at the same indexes
+// as encoding/json decodes arrays into existing slices.
+// Used for slices with another length in the body bound with BindRequest.
+func (c *ProtectingCopier) mergeSliceByIndex(s *protectingCopyState, dst, src reflect.Value) error {
+	for idx := src.Len(); idx < dst.Len(); idx++ {
+		s.pushIndex(idx)
+		s.reportChange(dst.Index(idx).Interface(), nil)
+		s.pop()
+	}
+	merged := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+	reflect.Copy(merged, dst)
+	s.visit(merged, src)
+	presence := s.presence()
+	for idx := 0; idx < src.Len(); idx++ {
+		sValue := src.Index(idx)
+		dValue := merged.Index(idx)
+		s.pushIndex(idx)
+		if s.pathNode().isProtected() {
+			if s.report != nil || s.strict {
+				s.reportDiscardedValue(dValue, sValue, presence.hasElem(idx))
+			}
+		} else if idx < dst.Len() {
+			if err := c.copyImpl(s, dValue, sValue); err != nil {
+				return err
+			}
 		} else {
-			return err
+			s.creating++
+			err := c.copyImpl(s, dValue, sValue)
+			s.creating--
+			if err != nil {
+				return err
+			}
+			s.reportChange(nil, dValue.Interface())
 		}
+		s.pop()
+	}
+	dst.Set(merged)
+	return nil
+}
+
+// slicePlan returns the plan of elements of slices of sliceType
+// if they are merged with ProtectingCopySliceMergeByKey, or nil.
+func (c *ProtectingCopier) slicePlan(s *protectingCopyState, sliceType reflect.Type) *protectingCopyPlan {
+	if c.SliceStrategy != ProtectingCopySliceMergeByKey {
+		return nil
+	}
+	elemType := sliceType.Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil
+	}
+	if _, ok := s.planKey.types.lookup(elemType); ok {
 		return nil
 	}
+	if plan := c.structPlan(s, elemType); plan.keyIndex >= 0 {
+		return plan
+	}
+	return nil
+}
+
+// sliceElemKey returns the key of the element of a slice, or false if it has no key.
+func sliceElemKey(plan *protectingCopyPlan, elem reflect.Value) (interface{}, bool) {
+	if elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			return nil, false
+		}
+		elem = elem.Elem()
+	}
+	key := elem.Field(plan.keyIndex)
+	if protectingCopyEqual(reflect.Zero(key.Type()).Interface(), key.Interface()) {
+		return nil, false
+	}
+	return key.Interface(), true
+}
+
+// mergeSlice is a sub function of ProtectingCopier.Copy
+// for ProtectingCopySliceMergeByKey.
+// This assumes values are:
+// * reflect.Slice
+// * CanSet()
+// * types are same
+// * src is not nil
+func (c *ProtectingCopier) mergeSlice(s *protectingCopyState, plan *protectingCopyPlan, dst, src reflect.Value) error {
+	keyType := src.Type().Elem()
+	if keyType.Kind() == reflect.Ptr {
+		keyType = keyType.Elem()
+	}
+	if keyType = keyType.Field(plan.keyIndex).Type; !keyType.Comparable() {
+		return newErrCopyValueInvalid(ProtectingCopyReasonInvalidTag, fmt.Sprintf("key field of %v is not comparable: %v", src.Type(), keyType))
+	}
+
+	// indexes of elements in dst for each key
+	dIndexes := map[interface{}][]int{}
+	for idx := 0; idx < dst.Len(); idx++ {
+		if key, ok := sliceElemKey(plan, dst.Index(idx)); ok {
+			dIndexes[key] = append(dIndexes[key], idx)
+		}
+	}
+	// matched is the index in dst for each element in src, or -1.
+	matched := make([]int, src.Len())
+	used := make([]bool, dst.Len())
+	inPlace := dst.Len() == src.Len()
+	for idx := 0; idx < src.Len(); idx++ {
+		matched[idx] = -1
+		if key, ok := sliceElemKey(plan, src.Index(idx)); ok {
+			if indexes := dIndexes[key]; len(indexes) > 0 {
+				matched[idx] = indexes[0]
+				dIndexes[key] = indexes[1:]
+				used[indexes[0]] = true
+			}
+		}
+		if matched[idx] != idx {
+			inPlace = false
+		}
+	}
+	if inPlace && s.canCopyInto(dst, src) {
+		s.visit(dst, src)
+		return c.copySliceOrArrayImpl(s, dst, src)
+	}
 
-	return c.copySliceOrArrayImpl(dst, src)
+	for idx, u := range used {
+		if !u {
+			s.pushIndex(idx)
+			s.reportChange(dst.Index(idx).Interface(), nil)
+			s.pop()
+		}
+	}
+	merged := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+	s.visit(merged, src)
+	for idx := 0; idx < src.Len(); idx++ {
+		sValue := src.Index(idx)
+		dValue := merged.Index(idx)
+		s.pushIndex(idx)
+		if matched[idx] >= 0 {
+			dValue.Set(dst.Index(matched[idx]))
+			if err := c.copyImpl(s, dValue, sValue); err != nil {
+				return err
+			}
+		} else {
+			s.creating++
+			err := c.copyImpl(s, dValue, sValue)
+			s.creating--
+			if err != nil {
+				return err
+			}
+			s.reportChange(nil, dValue.Interface())
+		}
+		s.pop()
+	}
+	dst.Set(merged)
+	return nil
 }
 
 // copySlice is a sub function of ProtectingCopier.Copy
@@ -308,8 +1776,8 @@ func (c *ProtectingCopier) copySlice(dst, src reflect.Value) error {
 // * reflect.Array
 // * CanSet()
 // * types are same
-func (c *ProtectingCopier) copyArray(dst, src reflect.Value) error {
-	return c.copySliceOrArrayImpl(dst, src)
+func (c *ProtectingCopier) copyArray(s *protectingCopyState, dst, src reflect.Value) error {
+	return c.copySliceOrArrayImpl(s, dst, src)
 }
 
 // copySliceOrArrayImpl is a sub function of ProtectingCopier.Copy
@@ -318,13 +1786,20 @@ func (c *ProtectingCopier) copyArray(dst, src reflect.Value) error {
 // * IsValid()
 // * have the same length
 // * types are same
-func (c *ProtectingCopier) copySliceOrArrayImpl(dst, src reflect.Value) error {
+func (c *ProtectingCopier) copySliceOrArrayImpl(s *protectingCopyState, dst, src reflect.Value) error {
+	presence := s.presence()
 	for idx := 0; idx < src.Len(); idx++ {
 		sValue := src.Index(idx)
 		dValue := dst.Index(idx)
-		if err := c.copyImpl(dValue, sValue); err != nil {
+		s.pushIndex(idx)
+		if s.pathNode().isProtected() {
+			if s.report != nil || s.strict {
+				s.reportDiscardedValue(dValue, sValue, presence.hasElem(idx))
+			}
+		} else if err := c.copyImpl(s, dValue, sValue); err != nil {
 			return err
 		}
+		s.pop()
 	}
 
 	return nil
@@ -335,53 +1810,185 @@ func (c *ProtectingCopier) copySliceOrArrayImpl(dst, src reflect.Value) error {
 // * reflect.Map
 // * CanSet()
 // * types are same
-func (c *ProtectingCopier) copyMap(dst, src reflect.Value) error {
+func (c *ProtectingCopier) copyMap(s *protectingCopyState, dst, src reflect.Value) error {
 	if src.IsNil() {
+		s.reportSet(dst, src)
 		dst.Set(src)
 		return nil
 	}
-	if dst.IsNil() {
-		// dst.Set(reflect.MakeMapWithSize(reflect.TypeOf(src.Interface()), src.Len()))
-		dst.Set(reflect.MakeMap(reflect.TypeOf(src.Interface())))
+	if visited, ok := s.lookupVisited(src); ok {
+		s.setVisited(dst, visited)
+		return nil
+	}
+	if dst.IsNil() || !s.canCopyInto(dst, src) {
+		return c.setCopiedDest(s, dst, src)
+	}
+	s.visit(dst, src)
+	return c.copyMapImpl(s, nil, dst, src)
+}
+
+// protectingCopyMapMode is how to treat existing keys of maps.
+type protectingCopyMapMode int
+
+const (
+	protectingCopyMapReplace protectingCopyMapMode = iota
+	protectingCopyMapMerge
+	protectingCopyMapProtectExisting
+)
+
+// protectingCopyMapPolicy is the policy of a map field specified with MapTag.
+// nil is the default policy.
+type protectingCopyMapPolicy struct {
+	mode protectingCopyMapMode
+	// protectedKeys are keys formatted with fmt.Sprint.
+	protectedKeys []string
+	// err is the error for invalid tags, reported on copy.
+	err *ErrCopyValueInvalid
+}
+
+// parseProtectingCopyMapPolicy parses the value of MapTag on field.
+func parseProtectingCopyMapPolicy(tag, value string, field reflect.StructField) *protectingCopyMapPolicy {
+	policy := &protectingCopyMapPolicy{}
+	if field.Type.Kind() != reflect.Map {
+		policy.err = newErrCopyValueInvalid(ProtectingCopyReasonInvalidTag, fmt.Sprintf("%v tag is specified for non-map field %v", tag, field.Name))
+		return policy
+	}
+	for _, option := range strings.Split(value, ",") {
+		switch {
+		case option == "replace":
+			policy.mode = protectingCopyMapReplace
+		case option == "merge":
+			policy.mode = protectingCopyMapMerge
+		case option == "protectexisting":
+			policy.mode = protectingCopyMapProtectExisting
+		case strings.HasPrefix(option, "protect="):
+			policy.protectedKeys = append(policy.protectedKeys, strings.Split(option[len("protect="):], "|")...)
+		default:
+			policy.err = newErrCopyValueInvalid(ProtectingCopyReasonInvalidTag, fmt.Sprintf("invalid option in %v tag of %v: %q", tag, field.Name, option))
+			return policy
+		}
+	}
+	return policy
+}
+
+// removes tests whether keys absent in the source are removed.
+func (p *protectingCopyMapPolicy) removes() bool {
+	return p == nil || p.mode == protectingCopyMapReplace
+}
+
+// protects tests whether the key is protected.
+// exists is whether the key exists in the destination.
+func (p *protectingCopyMapPolicy) protects(key reflect.Value, exists bool) bool {
+	if p == nil {
+		return false
+	}
+	if exists && p.mode == protectingCopyMapProtectExisting {
+		return true
+	}
+	return len(p.protectedKeys) > 0 && containsString(p.protectedKeys, fmt.Sprint(key.Interface()))
+}
+
+// copyMapWithPolicy is copyMap for map fields with MapTag.
+// nil in the source is treated as an empty map.
+func (c *ProtectingCopier) copyMapWithPolicy(s *protectingCopyState, policy *protectingCopyMapPolicy, dst, src reflect.Value) error {
+	if policy.err != nil {
+		return policy.err.clone()
+	}
+	if src.IsNil() {
+		if dst.IsNil() {
+			return nil
+		}
+		src = reflect.MakeMap(src.Type())
+	} else if visited, ok := s.lookupVisited(src); ok {
+		s.setVisited(dst, visited)
+		return nil
+	}
+	if dst.IsNil() || !s.canCopyInto(dst, src) {
+		created := reflect.MakeMap(src.Type())
+		s.visit(created, src)
+		s.creating++
+		err := c.copyMapImpl(s, policy, created, src)
+		s.creating--
+		if err != nil {
+			return err
+		}
+		s.reportChange(interfaceOf(dst), created.Interface())
+		dst.Set(created)
+		return nil
 	}
-	return c.copyMapImpl(dst, src)
+	s.visit(dst, src)
+	return c.copyMapImpl(s, policy, dst, src)
 }
 
 // copyMapImpl is a sub function of ProtectingCopier.Copy
 // This assumes values are:
 // * reflect.Map
 // * types are same
-func (c *ProtectingCopier) copyMapImpl(dst, src reflect.Value) error {
+func (c *ProtectingCopier) copyMapImpl(s *protectingCopyState, policy *protectingCopyMapPolicy, dst, src reflect.Value) error {
 	// Remove unnecessary Keys
 	for _, key := range dst.MapKeys() {
-		if src.MapIndex(key).IsValid() {
+		if src.MapIndex(key).IsValid() || !policy.removes() {
+			continue
+		}
+		s.pushKey(key)
+		if s.pathNode().isProtected() || policy.protects(key, true) {
+			s.pop()
 			continue
 		}
+		s.reportChange(dst.MapIndex(key).Interface(), nil)
+		s.pop()
 		dst.SetMapIndex(key, reflect.ValueOf(nil))
 	}
 
+	presence := s.presence()
 	for _, key := range src.MapKeys() {
 		sValue := src.MapIndex(key)
 		dValue := dst.MapIndex(key)
 
-		if c.canSetForMap(dValue, sValue) {
+		s.pushKey(key)
+		if s.pathNode().isProtected() || policy.protects(key, dValue.IsValid()) {
+			if s.report != nil || s.strict {
+				if !dValue.IsValid() {
+					dValue = reflect.Zero(dst.Type().Elem())
+				}
+				s.reportDiscardedValue(dValue, sValue, presence.hasKey(key))
+			}
+		} else if dValue.IsValid() && dValue.Kind() == reflect.Slice && c.slicePlan(s, dValue.Type()) != nil {
+			// merge to a settable copy of the slice
+			merged := reflect.New(dValue.Type()).Elem()
+			merged.Set(dValue)
+			if err := c.copySlice(s, merged, sValue); err != nil {
+				return err
+			}
+			dst.SetMapIndex(key, merged)
+		} else if c.canSetForMap(s, dValue, sValue) {
 			// pointer type, slice, map, and so on.
-			if err := c.copyImpl(dValue, sValue); err != nil {
+			if err := c.copyImpl(s, dValue, sValue); err != nil {
+				return err
+			}
+		} else if dValue.IsValid() && presence != nil {
+			// merge to a settable copy of the value as slice elements are
+			merged := reflect.New(dValue.Type()).Elem()
+			merged.Set(dValue)
+			if err := c.copyImpl(s, merged, sValue); err != nil {
 				return err
 			}
+			dst.SetMapIndex(key, merged)
 		} else {
-			if _dValue, err := c.createCopiedDest(sValue); err == nil {
+			if _dValue, err := c.createCopiedDest(s, sValue); err == nil {
+				s.reportChange(interfaceOf(dValue), interfaceOf(_dValue))
 				dst.SetMapIndex(key, _dValue)
 			} else {
 				return err
 			}
 		}
+		s.pop()
 	}
 	return nil
 }
 
 // canSetForMap tests whether copying src to dst affects the caller.
-func (c *ProtectingCopier) canSetForMap(dst, src reflect.Value) bool {
+func (c *ProtectingCopier) canSetForMap(s *protectingCopyState, dst, src reflect.Value) bool {
 	if !src.IsValid() || !dst.IsValid() {
 		return false
 	}
@@ -393,6 +2000,14 @@ func (c *ProtectingCopier) canSetForMap(dst, src reflect.Value) bool {
 		// this occurs when type is interface{}
 		return false
 	}
+	if sType == nil {
+		// both are nil interfaces
+		return false
+	}
+	if _, ok := s.planKey.types.lookup(sType); ok {
+		// registered types are copied as a whole
+		return false
+	}
 
 	switch dType.Kind() {
 	case reflect.Ptr, reflect.Map:
@@ -402,7 +2017,7 @@ func (c *ProtectingCopier) canSetForMap(dst, src reflect.Value) bool {
 		for dst.Kind() == reflect.Interface && dst.IsValid() {
 			dst = dst.Elem()
 		}
-		return src.IsValid() && !src.IsNil() && dst.IsValid() && !dst.IsNil()
+		return src.IsValid() && !src.IsNil() && dst.IsValid() && !dst.IsNil() && s.canCopyInto(dst, src)
 	case reflect.Slice:
 		for src.Kind() == reflect.Interface && src.IsValid() {
 			src = src.Elem()
@@ -410,13 +2025,17 @@ func (c *ProtectingCopier) canSetForMap(dst, src reflect.Value) bool {
 		for dst.Kind() == reflect.Interface && dst.IsValid() {
 			dst = dst.Elem()
 		}
-		return src.IsValid() && !src.IsNil() && dst.IsValid() && !dst.IsNil() && src.Len() == dst.Len()
+		return src.IsValid() && !src.IsNil() && dst.IsValid() && !dst.IsNil() && src.Len() == dst.Len() && s.canCopyInto(dst, src)
 	}
 	return dst.CanSet()
 }
 
 // createCopiedDest creates a new object and perform protecting copy
-func (c *ProtectingCopier) createCopiedDest(src reflect.Value) (reflect.Value, error) {
+func (c *ProtectingCopier) createCopiedDest(s *protectingCopyState, src reflect.Value) (reflect.Value, error) {
+	s.creating++
+	defer func() {
+		s.creating--
+	}()
 	origSrc := src
 	for src.Kind() == reflect.Interface && src.IsValid() {
 		src = src.Elem()
@@ -424,13 +2043,22 @@ func (c *ProtectingCopier) createCopiedDest(src reflect.Value) (reflect.Value, e
 	if !src.IsValid() {
 		return origSrc, nil
 	}
+	if _, ok := s.planKey.types.lookup(src.Type()); ok {
+		dst := reflect.New(src.Type()).Elem()
+		err := c.copyImpl(s, dst, src)
+		return dst, err
+	}
+	if visited, ok := s.lookupVisited(src); ok {
+		// cycles or shared references
+		return visited, nil
+	}
 	switch src.Kind() {
 	case reflect.Slice:
 		if src.IsNil() {
 			return origSrc, nil
 		}
 		dst := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
-		err := c.copyImpl(dst, src)
+		err := c.copyImpl(s, dst, src)
 		return dst, err
 	case reflect.Map:
 		if src.IsNil() {
@@ -438,17 +2066,17 @@ func (c *ProtectingCopier) createCopiedDest(src reflect.Value) (reflect.Value, e
 		}
 		// dst := reflect.MakeMapWithSize(src.Type(), src.Len())
 		dst := reflect.MakeMap(src.Type())
-		err := c.copyImpl(dst, src)
+		err := c.copyImpl(s, dst, src)
 		return dst, err
 	case reflect.Ptr:
 		if src.IsNil() {
 			return origSrc, nil
 		}
 		dst := reflect.New(src.Type().Elem())
-		err := c.copyImpl(dst, src)
+		err := c.copyImpl(s, dst, src)
 		return dst, err
 	}
 	dst := reflect.New(src.Type()).Elem()
-	err := c.copyImpl(dst, src)
+	err := c.copyImpl(s, dst, src)
 	return dst, err
 }
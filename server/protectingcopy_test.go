@@ -1,13 +1,25 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
 )
 
 func expectEquals(t *testing.T, expected, actual interface{}) {
@@ -70,20 +82,20 @@ func identityString(v interface{}) string {
 	switch typeV.Kind() {
 	case reflect.Slice:
 		return fmt.Sprintf(
-			"Slice[ptr=%p, len=%v, contents=%#v]",
+			"Slice[ptr=%#x, len=%v, contents=%#v]",
 			refV.Pointer(),
 			refV.Len(),
 			v,
 		)
 	case reflect.Map:
 		return fmt.Sprintf(
-			"Map[ptr=%p, contents=%#v]",
+			"Map[ptr=%#x, contents=%#v]",
 			refV.Pointer(),
 			v,
 		)
 	case reflect.Ptr:
 		return fmt.Sprintf(
-			"Ptr[ptr=%p, contents=%v]",
+			"Ptr[ptr=%#x, contents=%v]",
 			refV.Pointer(),
 			identityString(refV.Elem().Interface()),
 		)
@@ -243,6 +255,247 @@ func TestProtectingCopyStructTag(t *testing.T) {
 	expectEquals(t, expected, dst)
 }
 
+func TestProtectingCopyStructTagPurposes(t *testing.T) {
+	type testStruct struct {
+		Field1 int `protectfor:"update"`
+		Field2 int `protectfor:"admin"`
+		Field3 int `protectfor:"update,admin"`
+		Field4 int `protectfor:"update,!admin"`
+		Field5 int `protectfor:"!admin"`
+		Field6 int `protectfor:"create,import"`
+		Field7 int `protectfor:"import"`
+		Field8 int
+	}
+
+	dst := testStruct{
+		Field1: 1,
+		Field2: 2,
+		Field3: 3,
+		Field4: 4,
+		Field5: 5,
+		Field6: 6,
+		Field7: 7,
+		Field8: 8,
+	}
+	src := testStruct{
+		Field1: 111,
+		Field2: 222,
+		Field3: 333,
+		Field4: 444,
+		Field5: 555,
+		Field6: 666,
+		Field7: 777,
+		Field8: 888,
+	}
+
+	for _, c := range []struct {
+		copier   *ProtectingCopier
+		expected testStruct
+	}{
+		{
+			copier: &ProtectingCopier{ProtectFor: "update"},
+			expected: testStruct{
+				Field1: 1,
+				Field2: 222,
+				Field3: 3,
+				Field4: 4,
+				Field5: 5,
+				Field6: 666,
+				Field7: 777,
+				Field8: 888,
+			},
+		},
+		{
+			copier: &ProtectingCopier{Purposes: []string{"update", "admin"}},
+			expected: testStruct{
+				Field1: 1,
+				Field2: 2,
+				Field3: 3,
+				Field4: 444,
+				Field5: 555,
+				Field6: 666,
+				Field7: 777,
+				Field8: 888,
+			},
+		},
+		{
+			// ProtectFor と Purposes は合わせて使われる
+			copier: &ProtectingCopier{ProtectFor: "update", Purposes: []string{"admin"}},
+			expected: testStruct{
+				Field1: 1,
+				Field2: 2,
+				Field3: 3,
+				Field4: 444,
+				Field5: 555,
+				Field6: 666,
+				Field7: 777,
+				Field8: 888,
+			},
+		},
+		{
+			copier: &ProtectingCopier{Purposes: []string{"update", "admin"}, Match: ProtectingCopyMatchAll},
+			expected: testStruct{
+				Field1: 111,
+				Field2: 222,
+				Field3: 3,
+				Field4: 444,
+				Field5: 555,
+				Field6: 666,
+				Field7: 777,
+				Field8: 888,
+			},
+		},
+		{
+			copier: &ProtectingCopier{Purposes: []string{"create", "import"}},
+			expected: testStruct{
+				Field1: 111,
+				Field2: 222,
+				Field3: 333,
+				Field4: 444,
+				Field5: 5,
+				Field6: 6,
+				Field7: 7,
+				Field8: 888,
+			},
+		},
+		{
+			copier: &ProtectingCopier{Purposes: []string{"create", "import"}, Match: ProtectingCopyMatchAll},
+			expected: testStruct{
+				Field1: 111,
+				Field2: 222,
+				Field3: 333,
+				Field4: 444,
+				Field5: 5,
+				Field6: 6,
+				Field7: 777,
+				Field8: 888,
+			},
+		},
+		{
+			// 重複は無視される
+			copier: &ProtectingCopier{ProtectFor: "admin", Purposes: []string{"admin"}, Match: ProtectingCopyMatchAll},
+			expected: testStruct{
+				Field1: 111,
+				Field2: 2,
+				Field3: 3,
+				Field4: 444,
+				Field5: 555,
+				Field6: 666,
+				Field7: 777,
+				Field8: 888,
+			},
+		},
+		{
+			// 否定だけのタグは目的が指定されていなくても一致する
+			copier: &ProtectingCopier{},
+			expected: testStruct{
+				Field1: 111,
+				Field2: 222,
+				Field3: 333,
+				Field4: 444,
+				Field5: 5,
+				Field6: 666,
+				Field7: 777,
+				Field8: 888,
+			},
+		},
+		{
+			copier: &ProtectingCopier{Match: ProtectingCopyMatchAll},
+			expected: testStruct{
+				Field1: 111,
+				Field2: 222,
+				Field3: 333,
+				Field4: 444,
+				Field5: 5,
+				Field6: 666,
+				Field7: 777,
+				Field8: 888,
+			},
+		},
+	} {
+		_dst := dst
+		_src := src
+		expectEquals(t, nil, c.copier.Copy(&_dst, &_src))
+		expectEquals(t, c.expected, _dst)
+	}
+}
+
+func TestProtectingCopyStructTagPurposesWritableFor(t *testing.T) {
+	type testStruct struct {
+		Field1 int `writablefor:"update"`
+		Field2 int `writablefor:"update,!admin"`
+		Field3 int `writablefor:"admin"`
+		Field4 int `writablefor:"update,admin" protectfor:"!update"`
+		Field5 int
+	}
+
+	dst := testStruct{
+		Field1: 1,
+		Field2: 2,
+		Field3: 3,
+		Field4: 4,
+		Field5: 5,
+	}
+	src := testStruct{
+		Field1: 111,
+		Field2: 222,
+		Field3: 333,
+		Field4: 444,
+		Field5: 555,
+	}
+
+	for _, c := range []struct {
+		copier   *ProtectingCopier
+		expected testStruct
+	}{
+		{
+			copier: &ProtectingCopier{ProtectFor: "update"},
+			expected: testStruct{
+				Field1: 111,
+				Field2: 222,
+				Field3: 3,
+				Field4: 444,
+				Field5: 5,
+			},
+		},
+		{
+			copier: &ProtectingCopier{Purposes: []string{"update", "admin"}},
+			expected: testStruct{
+				Field1: 111,
+				Field2: 2,
+				Field3: 333,
+				Field4: 444,
+				Field5: 5,
+			},
+		},
+		{
+			copier: &ProtectingCopier{Purposes: []string{"update", "admin"}, Match: ProtectingCopyMatchAll},
+			expected: testStruct{
+				Field1: 1,
+				Field2: 2,
+				Field3: 3,
+				Field4: 444,
+				Field5: 5,
+			},
+		},
+		{
+			copier: &ProtectingCopier{ProtectFor: "admin"},
+			expected: testStruct{
+				Field1: 1,
+				Field2: 2,
+				Field3: 333,
+				Field4: 4,
+				Field5: 5,
+			},
+		},
+	} {
+		_dst := dst
+		_src := src
+		expectEquals(t, nil, c.copier.Copy(&_dst, &_src))
+		expectEquals(t, c.expected, _dst)
+	}
+}
+
 func TestProtectingCopyStructSimpleTypes(t *testing.T) {
 	type testStruct struct {
 		Field1 int
@@ -464,6 +717,215 @@ func TestProtectingCopyStructMapOverwrite(t *testing.T) {
 	expectSame(t, v1, dst.Field1)
 }
 
+func TestProtectingCopyStructMapReplace(t *testing.T) {
+	type testStruct struct {
+		Field1 map[string]int `protectmap:"replace"`
+	}
+
+	v1 := map[string]int{"key1": 1, "key2": 103, "key4": 4}
+	dst := testStruct{
+		Field1: v1,
+	}
+	src := testStruct{
+		Field1: map[string]int{"key1": 1, "key2": 2, "key3": 3},
+	}
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, ""),
+	)
+	expectEquals(t, src, dst)
+	expectNotSame(t, src.Field1, dst.Field1)
+	expectSame(t, v1, dst.Field1)
+}
+
+func TestProtectingCopyStructMapMerge(t *testing.T) {
+	type testStruct struct {
+		Field1 map[string]int `protectmap:"merge"`
+	}
+
+	v1 := map[string]int{"key1": 1, "key2": 103, "key4": 4}
+	dst := testStruct{
+		Field1: v1,
+	}
+	src := testStruct{
+		Field1: map[string]int{"key1": 1, "key2": 2, "key3": 3},
+	}
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, ""),
+	)
+	expectEquals(t, map[string]int{"key1": 1, "key2": 2, "key3": 3, "key4": 4}, dst.Field1)
+	expectSame(t, v1, dst.Field1)
+}
+
+func TestProtectingCopyStructMapMergeNil(t *testing.T) {
+	type testStruct struct {
+		Field1 map[string]int `protectmap:"merge"`
+		Field2 map[string]int `protectmap:"merge"`
+	}
+
+	dst := testStruct{
+		Field1: map[string]int{"key1": 1, "key2": 2},
+	}
+	src := testStruct{
+		Field1: nil,
+		Field2: map[string]int{"key1": 1},
+	}
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, ""),
+	)
+	// nil は空の map として扱われる
+	expectEquals(t, map[string]int{"key1": 1, "key2": 2}, dst.Field1)
+	expectEquals(t, map[string]int{"key1": 1}, dst.Field2)
+	expectNotSame(t, src.Field2, dst.Field2)
+}
+
+func TestProtectingCopyStructMapProtectExisting(t *testing.T) {
+	type testStruct struct {
+		Field1 map[string]int `protectmap:"protectexisting"`
+	}
+
+	v1 := map[string]int{"key1": 1, "key2": 103, "key4": 4}
+	dst := testStruct{
+		Field1: v1,
+	}
+	src := testStruct{
+		Field1: map[string]int{"key1": 1, "key2": 2, "key3": 3},
+	}
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, ""),
+	)
+	expectEquals(t, map[string]int{"key1": 1, "key2": 103, "key3": 3, "key4": 4}, dst.Field1)
+	expectSame(t, v1, dst.Field1)
+}
+
+func TestProtectingCopyStructMapProtectKeys(t *testing.T) {
+	type testStruct struct {
+		Field1 map[string]int `protectmap:"protect=key2|key4|key5"`
+		Field2 map[int]string `protectmap:"merge,protect=2"`
+	}
+
+	dst := testStruct{
+		Field1: map[string]int{"key1": 1, "key2": 103, "key4": 4},
+		Field2: map[int]string{1: "dst1", 2: "dst2", 3: "dst3"},
+	}
+	src := testStruct{
+		Field1: map[string]int{"key1": 1, "key2": 2, "key3": 3, "key5": 5},
+		Field2: map[int]string{1: "src1", 2: "src2"},
+	}
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, ""),
+	)
+	expectEquals(t, map[string]int{"key1": 1, "key2": 103, "key3": 3, "key4": 4}, dst.Field1)
+	expectEquals(t, map[int]string{1: "src1", 2: "dst2", 3: "dst3"}, dst.Field2)
+}
+
+func TestProtectingCopyStructMapProtectKeysNil(t *testing.T) {
+	type testStruct struct {
+		Field1 map[string]int `protectmap:"protect=key2"`
+	}
+
+	dst := testStruct{}
+	src := testStruct{
+		Field1: map[string]int{"key1": 1, "key2": 2},
+	}
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, ""),
+	)
+	expectEquals(t, map[string]int{"key1": 1}, dst.Field1)
+
+	// src が nil の場合も保護されたキーは残る
+	dst = testStruct{
+		Field1: map[string]int{"key1": 1, "key2": 2},
+	}
+	src = testStruct{}
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, ""),
+	)
+	expectEquals(t, map[string]int{"key2": 2}, dst.Field1)
+}
+
+func TestProtectingCopyStructMapPolicyReport(t *testing.T) {
+	type testStruct struct {
+		Field1 map[string]int `protectmap:"merge,protect=key2"`
+	}
+
+	dst := testStruct{
+		Field1: map[string]int{"key2": 102, "key3": 3},
+	}
+	src := testStruct{
+		Field1: map[string]int{"key1": 1, "key2": 2},
+	}
+	report, err := (&ProtectingCopier{}).CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: `Field1["key1"]`, Old: nil, New: 1},
+		},
+		report.Changed,
+	)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: `Field1["key2"]`, Old: 102, New: 2},
+		},
+		report.Discarded,
+	)
+
+	err = (&ProtectingCopier{Strict: true}).Copy(&dst, &src)
+	if _, ok := err.(*ErrCopyProtected); !ok {
+		t.Errorf("Expected ErrCopyProtected, but %v", err)
+	}
+}
+
+func TestProtectingCopyStructMapPolicyTag(t *testing.T) {
+	type testStruct struct {
+		Field1 map[string]int `policy:"merge"`
+	}
+
+	dst := testStruct{
+		Field1: map[string]int{"key1": 1},
+	}
+	src := testStruct{
+		Field1: map[string]int{"key2": 2},
+	}
+	expectEquals(
+		t,
+		nil,
+		(&ProtectingCopier{MapTag: "policy"}).Copy(&dst, &src),
+	)
+	expectEquals(t, map[string]int{"key1": 1, "key2": 2}, dst.Field1)
+}
+
+func TestProtectingCopyStructMapPolicyInvalid(t *testing.T) {
+	type invalidOption struct {
+		Field1 map[string]int `protectmap:"unknown"`
+	}
+	type nonMap struct {
+		Field1 []int `protectmap:"merge"`
+	}
+
+	if _, ok := ProtectingCopy(&invalidOption{}, &invalidOption{}, "").(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expected ErrCopyValueInvalid")
+	}
+	if _, ok := ProtectingCopy(&nonMap{}, &nonMap{}, "").(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expected ErrCopyValueInvalid")
+	}
+}
+
 func TestProtectingCopyStructMapInterface(t *testing.T) {
 	type testStruct struct {
 		Field1 map[string]interface{}
@@ -526,8 +988,14 @@ func TestProtectingCopyStructMapInterface(t *testing.T) {
 	expectEquals(t, src, dst)
 	expectNotSame(t, src.Field1, dst.Field1)
 	expectSame(t, dstMap, dst.Field1)
-	expectEquals(t, v1, v2)
+	// &v2 は3つのキーで共有されている。
+	// どのキーから走査されても、コピー先では src と異なる1つのポインタを共有し、
+	// src は変更されない。
 	expectNotSame(t, src.Field1["sameTypePointer"], dst.Field1["sameTypePointer"])
+	expectSame(t, dst.Field1["sameTypePointer"], dst.Field1["toNil"])
+	expectSame(t, dst.Field1["sameTypePointer"], dst.Field1["toTypedNil"])
+	expectEquals(t, 2, *dst.Field1["sameTypePointer"].(*int))
+	expectEquals(t, 2, v2)
 	expectNotSame(t, src.Field1["differentTypePointer"], dst.Field1["differentTypePointer"])
 	expectNotSame(t, src.Field1["sliceWithSameLength"], dst.Field1["sliceWithSameLength"])
 	expectSame(t, v5, dst.Field1["sliceWithSameLength"])
@@ -537,6 +1005,45 @@ func TestProtectingCopyStructMapInterface(t *testing.T) {
 	expectSame(t, v7, dst.Field1["map"])
 }
 
+func TestProtectingCopyStructMapInterfaceDistinctPointers(t *testing.T) {
+	type testStruct struct {
+		Field1 map[string]interface{}
+	}
+
+	v1 := 1
+	v2 := 2
+	v3 := 2
+	v4 := 2
+	var typedNil *int
+	dstMap := map[string]interface{}{
+		"sameTypePointer": &v1,
+		"toNil": nil,
+		"toTypedNil": typedNil,
+	}
+	dst := testStruct{
+		Field1: dstMap,
+	}
+	src := testStruct{
+		Field1: map[string]interface{}{
+			"sameTypePointer": &v2,
+			"toNil": &v3,
+			"toTypedNil": &v4,
+		},
+	}
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, ""),
+	)
+	expectEquals(t, src, dst)
+	expectSame(t, dstMap, dst.Field1)
+	expectEquals(t, v1, v2)
+	expectSame(t, &v1, dst.Field1["sameTypePointer"])
+	expectNotSame(t, src.Field1["toNil"], dst.Field1["toNil"])
+	expectNotSame(t, src.Field1["toTypedNil"], dst.Field1["toTypedNil"])
+	expectNotSame(t, dst.Field1["toNil"], dst.Field1["toTypedNil"])
+}
+
 func TestProtectingCopyStructInterfaceSimple(t *testing.T) {
 	type testStruct struct {
 		Field1 interface{}
@@ -984,16 +1491,265 @@ func TestProtectingCopyStructInterfaceNilMap(t *testing.T) {
 	expectEquals(t, src, dst)
 }
 
-func TestProtectingCopyStructStruct(t *testing.T) {
-	type nestStruct struct {
-		Value int
+func TestProtectingCopyMapNilInterface(t *testing.T) {
+	dst := map[string]interface{}{
+		"key1": nil,
 	}
-	type testStruct struct {
-		Field1 nestStruct
+	src := map[string]interface{}{
+		"key1": nil,
 	}
-
-	dst := testStruct{}
-	src := testStruct{
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(dst, src, ""),
+	)
+	expectEquals(t, src, dst)
+}
+
+type cycleTestNode struct {
+	Value  int
+	Secret string `protectfor:"update"`
+	Next   *cycleTestNode
+}
+
+func TestProtectingCopyLinkedListCycle(t *testing.T) {
+	src1 := &cycleTestNode{Value: 1, Secret: "src1"}
+	src2 := &cycleTestNode{Value: 2, Secret: "src2"}
+	src3 := &cycleTestNode{Value: 3, Secret: "src3"}
+	src1.Next = src2
+	src2.Next = src3
+	src3.Next = src1
+
+	dst1 := &cycleTestNode{Secret: "dst1"}
+	dst2 := &cycleTestNode{Secret: "dst2"}
+	dst1.Next = dst2
+
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(dst1, src1, "update"),
+	)
+	// 既存の要素は再利用され、循環は dst 側で再現される
+	expectSame(t, dst2, dst1.Next)
+	expectSame(t, dst1, dst1.Next.Next.Next)
+	expectEquals(t, 1, dst1.Value)
+	expectEquals(t, 2, dst1.Next.Value)
+	expectEquals(t, 3, dst1.Next.Next.Value)
+	expectEquals(t, "dst1", dst1.Secret)
+	expectEquals(t, "dst2", dst1.Next.Secret)
+	expectEquals(t, "", dst1.Next.Next.Secret)
+	// src は変更されない
+	expectSame(t, src1, src3.Next)
+	expectEquals(t, "src3", src3.Secret)
+}
+
+func TestProtectingCopySharedPointer(t *testing.T) {
+	type testStruct struct {
+		Field1 *cycleTestNode
+		Field2 *cycleTestNode
+		Nodes  []*cycleTestNode
+	}
+
+	shared := &cycleTestNode{Value: 1, Secret: "src"}
+	src := testStruct{
+		Field1: shared,
+		Field2: shared,
+		Nodes:  []*cycleTestNode{shared},
+	}
+	dst := testStruct{
+		Field1: &cycleTestNode{Secret: "dst1"},
+		Field2: &cycleTestNode{Secret: "dst2"},
+		Nodes:  []*cycleTestNode{{Secret: "dst3"}},
+	}
+	dst1 := dst.Field1
+
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, "update"),
+	)
+	expectSame(t, dst1, dst.Field1)
+	expectSame(t, dst.Field1, dst.Field2)
+	expectSame(t, dst.Field1, dst.Nodes[0])
+	expectNotSame(t, src.Field1, dst.Field1)
+	expectEquals(t, 1, dst.Field1.Value)
+	expectEquals(t, "dst1", dst.Field1.Secret)
+}
+
+func TestProtectingCopySharedPointerInDst(t *testing.T) {
+	type testStruct struct {
+		Field1 *cycleTestNode
+		Field2 *cycleTestNode
+	}
+
+	// dst 側だけで共有されている場合は、共有を解消する
+	shared := &cycleTestNode{Secret: "dst"}
+	dst := testStruct{
+		Field1: shared,
+		Field2: shared,
+	}
+	src := testStruct{
+		Field1: &cycleTestNode{Value: 1},
+		Field2: &cycleTestNode{Value: 2},
+	}
+
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, "update"),
+	)
+	expectSame(t, shared, dst.Field1)
+	expectNotSame(t, dst.Field1, dst.Field2)
+	expectNotSame(t, src.Field2, dst.Field2)
+	expectEquals(t, 1, dst.Field1.Value)
+	expectEquals(t, 2, dst.Field2.Value)
+	expectEquals(t, "dst", dst.Field1.Secret)
+	expectEquals(t, "", dst.Field2.Secret)
+}
+
+func TestProtectingCopyTreeWithParent(t *testing.T) {
+	type treeNode struct {
+		Name     string
+		Secret   string `protectfor:"update"`
+		Parent   *treeNode
+		Children []*treeNode
+	}
+
+	src := &treeNode{Name: "root"}
+	child1 := &treeNode{Name: "child1", Secret: "secret", Parent: src}
+	child2 := &treeNode{Name: "child2", Parent: src}
+	grandchild := &treeNode{Name: "grandchild", Parent: child1}
+	child1.Children = []*treeNode{grandchild}
+	src.Children = []*treeNode{child1, child2}
+
+	dst := &treeNode{Secret: "root secret"}
+
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(dst, src, "update"),
+	)
+	expectEquals(t, "root", dst.Name)
+	expectEquals(t, "root secret", dst.Secret)
+	expectEquals(t, 2, len(dst.Children))
+	for _, child := range dst.Children {
+		expectNotSame(t, src, child.Parent)
+		expectSame(t, dst, child.Parent)
+	}
+	expectEquals(t, "child1", dst.Children[0].Name)
+	expectEquals(t, "", dst.Children[0].Secret)
+	expectEquals(t, "child2", dst.Children[1].Name)
+	expectEquals(t, 1, len(dst.Children[0].Children))
+	expectEquals(t, "grandchild", dst.Children[0].Children[0].Name)
+	expectSame(t, dst.Children[0], dst.Children[0].Children[0].Parent)
+	expectNotSame(t, child1, dst.Children[0])
+}
+
+func TestProtectingCopyMapContainingItself(t *testing.T) {
+	src := map[string]interface{}{
+		"name": "src",
+	}
+	src["self"] = src
+	src["nested"] = map[string]interface{}{
+		"parent": src,
+	}
+	dst := map[string]interface{}{}
+
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(dst, src, ""),
+	)
+	// 循環した map は fmt で出力できないため、直接比較する
+	if !isSame(dst, dst["self"]) {
+		t.Errorf("Expected dst[\"self\"] is dst")
+	}
+	if nested, ok := dst["nested"].(map[string]interface{}); !ok {
+		t.Errorf("Expected dst[\"nested\"] is a map")
+	} else {
+		if isSame(src["nested"], nested) {
+			t.Errorf("Expected dst[\"nested\"] is a copy")
+		}
+		if !isSame(dst, nested["parent"]) {
+			t.Errorf("Expected dst[\"nested\"][\"parent\"] is dst")
+		}
+	}
+	expectEquals(t, "src", dst["name"])
+}
+
+func TestProtectingCopyMapContainingItselfInStruct(t *testing.T) {
+	type testStruct struct {
+		Map map[string]interface{}
+	}
+
+	srcMap := map[string]interface{}{}
+	srcMap["self"] = srcMap
+	src := testStruct{Map: srcMap}
+	dstMap := map[string]interface{}{
+		"self": map[string]interface{}{},
+	}
+	dst := testStruct{Map: dstMap}
+
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, ""),
+	)
+	if !isSame(dstMap, dst.Map) {
+		t.Errorf("Expected dst.Map is reused")
+	}
+	if !isSame(dstMap, dst.Map["self"]) {
+		t.Errorf("Expected dst.Map[\"self\"] is dst.Map")
+	}
+}
+
+func TestProtectingCopySliceContainingItself(t *testing.T) {
+	src := []interface{}{nil, "value"}
+	src[0] = src
+	dst := []interface{}{nil, nil}
+
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(dst, src, ""),
+	)
+	if !isSame(dst, dst[0]) {
+		t.Errorf("Expected dst[0] is dst")
+	}
+	expectEquals(t, "value", dst[1])
+}
+
+func TestProtectingCopyCycleReport(t *testing.T) {
+	src1 := &cycleTestNode{Value: 1}
+	src2 := &cycleTestNode{Value: 2}
+	src1.Next = src2
+	src2.Next = src1
+
+	dst1 := &cycleTestNode{}
+	dst2 := &cycleTestNode{}
+	dst1.Next = dst2
+	dst2.Next = &cycleTestNode{}
+
+	report, err := (&ProtectingCopier{}).CopyWithReport(dst1, src1)
+	expectEquals(t, nil, err)
+	expectSame(t, dst1, dst2.Next)
+	paths := []string{}
+	for _, change := range report.Changed {
+		paths = append(paths, change.Path)
+	}
+	expectEquals(t, []string{"Value", "Next.Value", "Next.Next"}, paths)
+}
+
+func TestProtectingCopyStructStruct(t *testing.T) {
+	type nestStruct struct {
+		Value int
+	}
+	type testStruct struct {
+		Field1 nestStruct
+	}
+
+	dst := testStruct{}
+	src := testStruct{
 		Field1: nestStruct{Value: 1234567},
 	}
 	expectEquals(
@@ -1479,8 +2235,2970 @@ func TestProtectingBindError(t* testing.T) {
 	expectSame(t, expectErr, err)
 }
 
+// jsonBinder returns a binder decoding body like echo.Context.Bind().
+func jsonBinder(body string) func(dst interface{}) error {
+	return func(dst interface{}) error {
+		return json.Unmarshal([]byte(body), dst)
+	}
+}
+
+// jsonRequest returns a request with the JSON body
+// and a binder decoding it like echo.Context.Bind().
+func jsonRequest(body string) (*http.Request, func(dst interface{}) error) {
+	req := httptest.NewRequest("PUT", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req, func(dst interface{}) error {
+		return json.NewDecoder(req.Body).Decode(dst)
+	}
+}
+
+type bindTestAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type bindTestItem struct {
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+}
+
+type bindTestUser struct {
+	Name     string                   `json:"name"`
+	Age      int                      `json:"age"`
+	Nickname *string                  `json:"nickname"`
+	Address  bindTestAddress          `json:"address"`
+	Home     *bindTestAddress         `json:"home"`
+	Items    []bindTestItem           `json:"items"`
+	Friends  map[string]*bindTestItem `json:"friends"`
+	Password string                   `json:"password" protectfor:"update"`
+}
+
+func TestProtectingBindAbsent(t *testing.T) {
+	nickname := "nick"
+	newUser := func() bindTestUser {
+		return bindTestUser{
+			Name:     "oldname",
+			Age:      20,
+			Nickname: &nickname,
+			Address:  bindTestAddress{City: "oldcity", Zip: "000"},
+			Home:     &bindTestAddress{City: "oldhome", Zip: "111"},
+			Items:    []bindTestItem{{Name: "item0", Price: 100}, {Name: "item1", Price: 200}},
+			Friends: map[string]*bindTestItem{
+				"friend1": {Name: "friend1", Price: 1},
+				"friend2": {Name: "friend2", Price: 2},
+			},
+			Password: "secret",
+		}
+	}
+
+	testcases := []struct {
+		name     string
+		body     string
+		expected func(*bindTestUser)
+	}{
+		{
+			name:     "empty",
+			body:     `{}`,
+			expected: func(u *bindTestUser) {},
+		},
+		{
+			name: "top level",
+			body: `{"age": 0}`,
+			expected: func(u *bindTestUser) {
+				u.Age = 0
+			},
+		},
+		{
+			name: "nested struct",
+			body: `{"address": {"zip": "999"}, "home": {"city": "newhome"}}`,
+			expected: func(u *bindTestUser) {
+				u.Address.Zip = "999"
+				u.Home.City = "newhome"
+			},
+		},
+		{
+			name: "slice elements",
+			body: `{"items": [{"price": 101}, {"name": "newitem1"}]}`,
+			expected: func(u *bindTestUser) {
+				u.Items[0].Price = 101
+				u.Items[1].Name = "newitem1"
+			},
+		},
+		{
+			// elements are merged by indexes even for another length
+			name: "slice length",
+			body: `{"items": [{"price": 101}]}`,
+			expected: func(u *bindTestUser) {
+				u.Items = []bindTestItem{{Name: "item0", Price: 101}}
+			},
+		},
+		{
+			name: "slice grown",
+			body: `{"items": [{"price": 101}, {"price": 201}, {"name": "newitem2"}]}`,
+			expected: func(u *bindTestUser) {
+				u.Items = []bindTestItem{
+					{Name: "item0", Price: 101},
+					{Name: "item1", Price: 201},
+					{Name: "newitem2"},
+				}
+			},
+		},
+		{
+			// keys absent in maps are removed as Copy does
+			name: "map values",
+			body: `{"friends": {"friend1": {"price": 11}, "friend3": {"name": "friend3"}}}`,
+			expected: func(u *bindTestUser) {
+				u.Friends = map[string]*bindTestItem{
+					"friend1": {Name: "friend1", Price: 11},
+					"friend3": {Name: "friend3"},
+				}
+			},
+		},
+		{
+			name: "protected",
+			body: `{"name": "newname", "password": "sesame"}`,
+			expected: func(u *bindTestUser) {
+				u.Name = "newname"
+			},
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			user := newUser()
+			expected := newUser()
+			testcase.expected(&expected)
+			req, binder := jsonRequest(testcase.body)
+			expectEquals(t, nil, ProtectingBindRequest(req, binder, &user, "update"))
+			expectEquals(t, expected, user)
+		})
+	}
+}
+
+func TestProtectingBindContainers(t *testing.T) {
+	type bindTestContainers struct {
+		Items    []bindTestItem           `json:"items"`
+		Values   map[string]bindTestItem  `json:"values"`
+		Pointers map[string]*bindTestItem `json:"pointers"`
+	}
+	newContainers := func() bindTestContainers {
+		return bindTestContainers{
+			Items:    []bindTestItem{{Name: "a", Price: 1}},
+			Values:   map[string]bindTestItem{"k": {Name: "a", Price: 1}},
+			Pointers: map[string]*bindTestItem{"k": {Name: "a", Price: 1}},
+		}
+	}
+
+	// どのコンテナでも存在するキーのみ上書きする
+	testcases := []struct {
+		name     string
+		body     string
+		expected func(*bindTestContainers)
+	}{
+		{
+			name: "slice",
+			body: `{"items": [{"name": "b"}]}`,
+			expected: func(v *bindTestContainers) {
+				v.Items[0].Name = "b"
+			},
+		},
+		{
+			name: "map of values",
+			body: `{"values": {"k": {"name": "b"}}}`,
+			expected: func(v *bindTestContainers) {
+				v.Values["k"] = bindTestItem{Name: "b", Price: 1}
+			},
+		},
+		{
+			name: "map of pointers",
+			body: `{"pointers": {"k": {"name": "b"}}}`,
+			expected: func(v *bindTestContainers) {
+				v.Pointers["k"].Name = "b"
+			},
+		},
+		{
+			// 新しいキーは body から作成する
+			name: "new keys",
+			body: `{"values": {"k": {"name": "b"}, "l": {"name": "c"}}, "pointers": {"k": {"name": "b"}, "l": {"name": "c"}}}`,
+			expected: func(v *bindTestContainers) {
+				v.Values["k"] = bindTestItem{Name: "b", Price: 1}
+				v.Values["l"] = bindTestItem{Name: "c"}
+				v.Pointers["k"].Name = "b"
+				v.Pointers["l"] = &bindTestItem{Name: "c"}
+			},
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			v := newContainers()
+			expected := newContainers()
+			testcase.expected(&expected)
+			req, binder := jsonRequest(testcase.body)
+			expectEquals(t, nil, (&ProtectingCopier{}).BindRequest(req, binder, &v))
+			expectEquals(t, expected, v)
+		})
+	}
+
+	// Copy は従来どおり値全体をコピーする
+	v := newContainers()
+	expectEquals(t, nil, ProtectingCopy(&v, &bindTestContainers{
+		Values: map[string]bindTestItem{"k": {Name: "b"}},
+	}, "update"))
+	expectEquals(t, map[string]bindTestItem{"k": {Name: "b"}}, v.Values)
+}
+
+func TestProtectingBindNull(t *testing.T) {
+	nickname := "nick"
+	body := `{"name": null, "nickname": null, "address": null, "items": [null, {"name": null}]}`
+	newUser := func() bindTestUser {
+		return bindTestUser{
+			Name:     "oldname",
+			Nickname: &nickname,
+			Address:  bindTestAddress{City: "oldcity"},
+			Items:    []bindTestItem{{Name: "item0"}, {Name: "item1"}},
+		}
+	}
+
+	// null は省略と同じ扱い
+	user := newUser()
+	req, binder := jsonRequest(body)
+	expectEquals(t, nil, ProtectingBindRequest(req, binder, &user, "update"))
+	expected := newUser()
+	// null in elements of slices is decoded as is
+	expected.Items = []bindTestItem{{}, {Name: "item1"}}
+	expectEquals(t, expected, user)
+
+	// ClearNull で null はクリアされる
+	user = newUser()
+	req, binder = jsonRequest(body)
+	expectEquals(t, nil, (&ProtectingCopier{ClearNull: true}).BindRequest(req, binder, &user))
+	expectEquals(
+		t,
+		bindTestUser{
+			Items: []bindTestItem{{}, {}},
+		},
+		user,
+	)
+}
+
+func TestProtectingBindJSONKey(t *testing.T) {
+	type embedded struct {
+		ID   int64
+		Note string
+	}
+	type testStruct struct {
+		embedded
+		Base     embedded `json:"base"`
+		Name     string   `json:"name,omitempty"`
+		Code     string
+		Internal string `json:"-"`
+	}
+
+	dst := testStruct{
+		embedded: embedded{ID: 1, Note: "note"},
+		Base:     embedded{ID: 2, Note: "basenote"},
+		Name:     "name",
+		Code:     "code",
+		Internal: "internal",
+	}
+	body := `{"Note": "newnote", "base": {"ID": 3}, "NAME": "newname", "code": "newcode"}`
+	req, binder := jsonRequest(body)
+	expectEquals(t, nil, ProtectingBindRequest(req, binder, &dst, ""))
+	expectEquals(
+		t,
+		testStruct{
+			embedded: embedded{ID: 1, Note: "newnote"},
+			Base:     embedded{ID: 3, Note: "basenote"},
+			Name:     "newname",
+			Code:     "newcode",
+			Internal: "internal",
+		},
+		dst,
+	)
+}
+
+func TestProtectingBindWithReportAbsent(t *testing.T) {
+	user := bindTestUser{
+		Name:    "oldname",
+		Age:     20,
+		Address: bindTestAddress{City: "oldcity", Zip: "000"},
+	}
+	req, binder := jsonRequest(`{"address": {"zip": "999"}}`)
+	report, err := ProtectingBindRequestWithReport(req, binder, &user, "update")
+	expectEquals(t, nil, err)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Address.Zip", Old: "000", New: "999"},
+		},
+		report.Changed,
+	)
+}
+
+func TestProtectingBindNotJSON(t *testing.T) {
+	type xmlTestUser struct {
+		Name     string `xml:"name"`
+		Age      int    `xml:"age"`
+		Password string `xml:"password" protectfor:"update"`
+	}
+
+	// XML は echo のバインダーでバインドされ、全フィールドがコピーされる
+	req := httptest.NewRequest("PUT", "/", strings.NewReader(`<user><name>newname</name><password>sesame</password></user>`))
+	req.Header.Set("Content-Type", "application/xml")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	user := xmlTestUser{Name: "oldname", Age: 20, Password: "secret"}
+	expectEquals(t, nil, ProtectingBindRequest(req, c.Bind, &user, "update"))
+	expectEquals(t, xmlTestUser{Name: "newname", Password: "secret"}, user)
+}
+
+func TestProtectingBindBinderType(t *testing.T) {
+	// バインダーには dst と同じ型のポインタが渡される
+	binder := func(dst interface{}) error {
+		user, ok := dst.(*exampleUser)
+		if !ok {
+			return fmt.Errorf("unexpected type: %T", dst)
+		}
+		user.Name = "newname"
+		return nil
+	}
+	user := exampleUser{Name: "oldname", Password: "secret"}
+	expectEquals(t, nil, ProtectingBind(binder, &user, "update"))
+	expectEquals(t, exampleUser{Name: "newname", Password: "secret"}, user)
+}
+
+func TestProtectingBindEchoForm(t *testing.T) {
+	// echo のバインダーでもフォームで送信されたキーのみコピーされる
+	form := url.Values{
+		"name":     {"newname"},
+		"password": {"sesame"},
+	}
+	req := httptest.NewRequest("PUT", "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	user := newFormTestUser()
+	expectEquals(t, nil, ProtectingBindRequest(req, c.Bind, &user, "update"))
+
+	expected := newFormTestUser()
+	expected.Name = "newname"
+	expectEquals(t, expected, user)
+}
+
+type formTestProfile struct {
+	Bio  string `form:"bio" query:"bio"`
+	Site string `form:"site" query:"site"`
+}
+
+type formTestUser struct {
+	Name     string   `form:"name" query:"name"`
+	Age      int      `form:"age" query:"age"`
+	Active   bool     `form:"active" query:"active"`
+	Score    *float64 `form:"score" query:"score"`
+	Tags     []string `form:"tag" query:"tag"`
+	Password string   `form:"password" query:"password" protectfor:"update"`
+	Profile  formTestProfile
+	Avatar   *multipart.FileHeader   `form:"avatar"`
+	Photos   []*multipart.FileHeader `form:"photo"`
+	Contract *multipart.FileHeader   `form:"contract" protectfor:"update"`
+}
+
+func newFormTestUser() formTestUser {
+	score := 1.5
+	return formTestUser{
+		Name:     "oldname",
+		Age:      20,
+		Active:   true,
+		Score:    &score,
+		Tags:     []string{"tag1"},
+		Password: "secret",
+		Profile:  formTestProfile{Bio: "oldbio", Site: "oldsite"},
+		Avatar:   &multipart.FileHeader{Filename: "old.png"},
+		Contract: &multipart.FileHeader{Filename: "contract.pdf"},
+	}
+}
+
+func TestProtectingBindForm(t *testing.T) {
+	form := url.Values{
+		"name":     {"newname"},
+		"Active":   {"false"},
+		"tag":      {"tag2", "tag3"},
+		"bio":      {""},
+		"password": {"sesame"},
+	}
+	req := httptest.NewRequest("POST", "/?age=30", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	user := newFormTestUser()
+	expectEquals(t, nil, ProtectingBindRequest(req, ProtectingFormBinder(req), &user, "update"))
+
+	// 送信されたキーのみコピーされる (クエリは対象外)
+	expected := newFormTestUser()
+	expected.Name = "newname"
+	expected.Active = false
+	expected.Tags = []string{"tag2", "tag3"}
+	expected.Profile.Bio = ""
+	expectEquals(t, expected, user)
+}
+
+func TestProtectingBindFormMultipart(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("age", "30")
+	w.WriteField("score", "2.5")
+	for _, file := range []struct {
+		field    string
+		filename string
+		content  string
+	}{
+		{"photo", "photo1.jpg", "photo1"},
+		{"photo", "photo2.jpg", "photo2"},
+		{"contract", "fake.pdf", "fake"},
+	} {
+		fw, err := w.CreateFormFile(file.field, file.filename)
+		if err != nil {
+			t.Fatalf("Failed to create a file: %v", err)
+		}
+		fw.Write([]byte(file.content))
+	}
+	w.Close()
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	user := newFormTestUser()
+	expectEquals(t, nil, ProtectingBindRequest(req, ProtectingFormBinder(req), &user, "update"))
+
+	expectEquals(t, 30, user.Age)
+	expectEquals(t, 2.5, *user.Score)
+	expectEquals(t, "oldname", user.Name)
+	// 送信されなかったファイルと保護されたファイルは維持される
+	expectEquals(t, "old.png", user.Avatar.Filename)
+	expectEquals(t, "contract.pdf", user.Contract.Filename)
+	if len(user.Photos) != 2 {
+		t.Fatalf("Expect 2 photos, but: %v", user.Photos)
+	}
+	for idx, expected := range []string{"photo1", "photo2"} {
+		// file headers are not copied but shared
+		expectSame(t, req.MultipartForm.File["photo"][idx], user.Photos[idx])
+		f, err := user.Photos[idx].Open()
+		if err != nil {
+			t.Fatalf("Failed to open a file: %v", err)
+		}
+		var content bytes.Buffer
+		content.ReadFrom(f)
+		f.Close()
+		expectEquals(t, expected, content.String())
+	}
+}
+
+func TestProtectingBindQuery(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?NAME=newname&site=newsite&password=sesame", nil)
+	user := newFormTestUser()
+	report, err := ProtectingBindRequestWithReport(req, ProtectingQueryBinder(req), &user, "update")
+	expectEquals(t, nil, err)
+
+	expected := newFormTestUser()
+	expected.Name = "newname"
+	expected.Profile.Site = "newsite"
+	expectEquals(t, expected, user)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Name", Old: "oldname", New: "newname"},
+			{Path: "Profile.Site", Old: "oldsite", New: "newsite"},
+		},
+		report.Changed,
+	)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Password", Old: "secret", New: "sesame"},
+		},
+		report.Discarded,
+	)
+}
+
+func TestProtectingBindFormError(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name": "newname"}`))
+	req.Header.Set("Content-Type", "application/json")
+	user := newFormTestUser()
+	if _, ok := ProtectingBind(ProtectingFormBinder(req), &user, "update").(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expect ErrCopyValueInvalid")
+	}
+
+	req = httptest.NewRequest("GET", "/?age=old", nil)
+	if err := ProtectingBind(ProtectingQueryBinder(req), &user, "update"); err == nil {
+		t.Errorf("Expect err, but nil")
+	}
+	expectEquals(t, newFormTestUser(), user)
+}
+
+func TestProtectingFormBinderDirect(t *testing.T) {
+	// ProtectingBind を経由しない場合も echo と同様にバインドできる
+	req := httptest.NewRequest("GET", "/?name=newname", nil)
+	var user formTestUser
+	expectEquals(t, nil, ProtectingQueryBinder(req)(&user))
+	expectEquals(t, formTestUser{Name: "newname"}, user)
+}
+
 func TestProtectingErrCopyValueInvalid(t* testing.T) {
 	msg := "test message"
 	err := &ErrCopyValueInvalid{msg: msg}
 	expectEquals(t, msg, err.Error())
 }
+
+func TestProtectingCopyReport(t *testing.T) {
+	type itemStruct struct {
+		Name  string
+		Price int `protectfor:"update"`
+	}
+	type testStruct struct {
+		ID    int64 `protectfor:"update"`
+		Name  string
+		Items []itemStruct
+		Meta  map[string]string
+		Date  time.Time
+	}
+
+	date := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	dst := testStruct{
+		ID:   1,
+		Name: "name",
+		Items: []itemStruct{
+			{Name: "item0", Price: 100},
+			{Name: "item1", Price: 200},
+		},
+		Meta: map[string]string{
+			"k1": "v1",
+			"k2": "v2",
+		},
+		Date: date,
+	}
+	src := testStruct{
+		ID:   2,
+		Name: "name",
+		Items: []itemStruct{
+			{Name: "item0", Price: 100},
+			{Name: "newitem1", Price: 300},
+		},
+		Meta: map[string]string{
+			"k1": "newv1",
+			"k3": "v3",
+		},
+		// 同時刻の異なるロケーションは変更とみなさない
+		Date: date.In(time.FixedZone("JST", 9*60*60)),
+	}
+	c := &ProtectingCopier{ProtectFor: "update"}
+	report, err := c.CopyWithReport(&dst, &src)
+	if err != nil {
+		t.Fatalf("Expect no err, but: %v", err)
+	}
+
+	changed := map[string]ProtectingCopyChange{}
+	for _, change := range report.Changed {
+		changed[change.Path] = change
+	}
+	expectEquals(
+		t,
+		map[string]ProtectingCopyChange{
+			"Items[1].Name": {Path: "Items[1].Name", Old: "item1", New: "newitem1"},
+			`Meta["k1"]`:    {Path: `Meta["k1"]`, Old: "v1", New: "newv1"},
+			`Meta["k2"]`:    {Path: `Meta["k2"]`, Old: "v2", New: nil},
+			`Meta["k3"]`:    {Path: `Meta["k3"]`, Old: nil, New: "v3"},
+		},
+		changed,
+	)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "ID", Old: int64(1), New: int64(2)},
+			{Path: "Items[1].Price", Old: 200, New: 300},
+		},
+		report.Discarded,
+	)
+
+	expectEquals(t, true, report.IsChanged("Items"))
+	expectEquals(t, true, report.IsChanged("Items[1]"))
+	expectEquals(t, false, report.IsChanged("Items[0]"))
+	expectEquals(t, false, report.IsChanged("Name"))
+	expectEquals(t, false, report.IsChanged("Date"))
+}
+
+func TestProtectingCopyReportCreated(t *testing.T) {
+	type nestStruct struct {
+		Value  int
+		Secret int `protectfor:"update"`
+	}
+	type testStruct struct {
+		Nest  *nestStruct
+		Slice []int
+		Any   interface{}
+	}
+
+	dst := testStruct{
+		Slice: []int{1, 2},
+		Any:   1,
+	}
+	src := testStruct{
+		Nest:  &nestStruct{Value: 1, Secret: 2},
+		Slice: []int{1, 2, 3},
+		Any:   "1",
+	}
+	c := &ProtectingCopier{ProtectFor: "update"}
+	report, err := c.CopyWithReport(&dst, &src)
+	if err != nil {
+		t.Fatalf("Expect no err, but: %v", err)
+	}
+	// 新たに作られた値は全体で報告される
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Nest", Old: (*nestStruct)(nil), New: &nestStruct{Value: 1}},
+			{Path: "Slice", Old: []int{1, 2}, New: []int{1, 2, 3}},
+			{Path: "Any", Old: 1, New: "1"},
+		},
+		report.Changed,
+	)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Nest.Secret", Old: 0, New: 2},
+		},
+		report.Discarded,
+	)
+}
+
+func TestProtectingCopyReportNoChange(t *testing.T) {
+	type testStruct struct {
+		ID    int64 `protectfor:"update"`
+		Name  string
+		Slice []string
+	}
+
+	dst := testStruct{ID: 1, Name: "name", Slice: []string{"a"}}
+	// ゼロ値は破棄されたとはみなさない
+	src := testStruct{ID: 0, Name: "name", Slice: []string{"a"}}
+	c := &ProtectingCopier{ProtectFor: "update"}
+	report, err := c.CopyWithReport(&dst, &src)
+	if err != nil {
+		t.Fatalf("Expect no err, but: %v", err)
+	}
+	expectEquals(t, 0, len(report.Changed))
+	expectEquals(t, 0, len(report.Discarded))
+}
+
+func TestProtectingBindWithReport(t *testing.T) {
+	binder := func(dst interface{}) error {
+		return json.Unmarshal(
+			[]byte(
+				`{` +
+					`"name": "newname",` +
+					`"password": "sesame"` +
+					`}`,
+			),
+			dst,
+		)
+	}
+	user := exampleUser{
+		Name:     "oldname",
+		Password: "secret",
+	}
+	report, err := ProtectingBindWithReport(binder, &user, "update")
+	if err != nil {
+		t.Fatalf("Expect no err, but: %v", err)
+	}
+	expectEquals(
+		t,
+		&ProtectingCopyReport{
+			Changed: []ProtectingCopyChange{
+				{Path: "Name", Old: "oldname", New: "newname"},
+			},
+			Discarded: []ProtectingCopyChange{
+				{Path: "Password", Old: "secret", New: "sesame"},
+			},
+		},
+		report,
+	)
+}
+
+func TestProtectingCopyStrict(t *testing.T) {
+	type itemStruct struct {
+		Name  string
+		Price int `protectfor:"update"`
+	}
+	type testStruct struct {
+		ID    int64 `protectfor:"update"`
+		Name  string
+		Items []itemStruct
+	}
+
+	dst := testStruct{
+		ID:    1,
+		Name:  "name",
+		Items: []itemStruct{{Name: "item0", Price: 100}},
+	}
+	src := testStruct{
+		ID:    2,
+		Name:  "newname",
+		Items: []itemStruct{{Name: "item0", Price: 200}},
+	}
+	c := &ProtectingCopier{ProtectFor: "update", Strict: true}
+	err := c.Copy(&dst, &src)
+	if e, ok := err.(*ErrCopyProtected); !ok {
+		t.Fatalf("Expect ErrCopyProtected, but: %v", err)
+	} else {
+		expectEquals(t, []string{"ID", "Items[0].Price"}, e.Paths)
+		expectEquals(t, "protected fields cannot be written: ID, Items[0].Price", e.Error())
+	}
+}
+
+func TestProtectingCopyStrictSameValue(t *testing.T) {
+	type testStruct struct {
+		ID   int64  `protectfor:"update"`
+		Code string `protectfor:"update"`
+		Name string
+	}
+
+	dst := testStruct{ID: 1, Code: "code", Name: "name"}
+	// 同じ値とゼロ値は許容される
+	src := testStruct{ID: 1, Name: "newname"}
+	c := &ProtectingCopier{ProtectFor: "update", Strict: true}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(t, testStruct{ID: 1, Code: "code", Name: "newname"}, dst)
+}
+
+func TestProtectingCopierBindStrict(t *testing.T) {
+	binder := func(dst interface{}) error {
+		return json.Unmarshal(
+			[]byte(
+				`{` +
+					`"name": "newname",` +
+					`"password": "sesame"` +
+					`}`,
+			),
+			dst,
+		)
+	}
+	user := exampleUser{
+		Name:     "oldname",
+		Password: "secret",
+	}
+	c := &ProtectingCopier{ProtectFor: "update", Strict: true}
+	err := c.Bind(binder, &user)
+	if e, ok := err.(*ErrCopyProtected); !ok {
+		t.Fatalf("Expect ErrCopyProtected, but: %v", err)
+	} else {
+		expectEquals(t, []string{"Password"}, e.Paths)
+	}
+}
+
+func TestProtectingCopierBindRequestStrictZero(t *testing.T) {
+	type itemStruct struct {
+		Name  string `json:"name"`
+		Price int    `json:"price" protectfor:"update"`
+	}
+	type testStruct struct {
+		Name   string            `json:"name"`
+		Code   string            `json:"code" protectfor:"update"`
+		Active bool              `json:"active" protectfor:"update"`
+		Items  []itemStruct      `json:"items"`
+		Meta   map[string]string `json:"meta" protectmap:"merge,protect=fixed"`
+	}
+
+	// 本文に明示されたゼロ値も保護されたフィールドへの書き込みとして扱う
+	dst := testStruct{
+		Name:   "name",
+		Code:   "code",
+		Active: true,
+		Items:  []itemStruct{{Name: "item0", Price: 100}},
+		Meta:   map[string]string{"fixed": "value"},
+	}
+	req, binder := jsonRequest(`{"name": "newname", "code": "", "active": false, "items": [{"name": "item0", "price": 0}], "meta": {"fixed": ""}}`)
+	c := &ProtectingCopier{ProtectFor: "update", Strict: true}
+	err := c.BindRequest(req, binder, &dst)
+	if e, ok := err.(*ErrCopyProtected); !ok {
+		t.Fatalf("Expect ErrCopyProtected, but: %v", err)
+	} else {
+		expectEquals(t, []string{"Code", "Active", "Items[0].Price", `Meta["fixed"]`}, e.Paths)
+	}
+
+	// 本文にないフィールドは書き込みとして扱わない
+	dst = testStruct{Name: "name", Code: "code", Active: true}
+	req, binder = jsonRequest(`{"name": "newname"}`)
+	expectEquals(t, nil, c.BindRequest(req, binder, &dst))
+	expectEquals(t, testStruct{Name: "newname", Code: "code", Active: true}, dst)
+}
+
+func TestProtectingCopyWritableFor(t *testing.T) {
+	type testStruct struct {
+		Name      string `writablefor:"create,update"`
+		Code      string `writablefor:"create"`
+		Note      string `writablefor:"update" protectfor:"update"`
+		CreatedAt time.Time
+	}
+
+	date := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	dst := testStruct{Name: "name", Code: "code", Note: "note", CreatedAt: date}
+	src := testStruct{Name: "newname", Code: "newcode", Note: "newnote", CreatedAt: date.AddDate(1, 0, 0)}
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, "update"))
+	// protectfor は writablefor より優先される
+	expectEquals(t, testStruct{Name: "newname", Code: "code", Note: "note", CreatedAt: date}, dst)
+}
+
+func TestProtectingCopyWritableForNested(t *testing.T) {
+	type denyListStruct struct {
+		Value  string
+		Secret string `protectfor:"update"`
+	}
+	type noTagStruct struct {
+		Value string
+	}
+	type allowListStruct struct {
+		Name    string `writablefor:"update"`
+		Code    string
+		Nest    denyListStruct `writablefor:"update"`
+		NoTag   noTagStruct    `writablefor:"update"`
+		Ignored denyListStruct
+	}
+	type rootStruct struct {
+		ID    int64 `protectfor:"update"`
+		Allow allowListStruct
+		NoTag noTagStruct
+	}
+
+	newDst := func() rootStruct {
+		return rootStruct{
+			ID: 1,
+			Allow: allowListStruct{
+				Name:    "name",
+				Code:    "code",
+				Nest:    denyListStruct{Value: "value", Secret: "secret"},
+				NoTag:   noTagStruct{Value: "value"},
+				Ignored: denyListStruct{Value: "value", Secret: "secret"},
+			},
+			NoTag: noTagStruct{Value: "value"},
+		}
+	}
+	src := rootStruct{
+		ID: 2,
+		Allow: allowListStruct{
+			Name:    "newname",
+			Code:    "newcode",
+			Nest:    denyListStruct{Value: "newvalue", Secret: "newsecret"},
+			NoTag:   noTagStruct{Value: "newvalue"},
+			Ignored: denyListStruct{Value: "newvalue", Secret: "newsecret"},
+		},
+		NoTag: noTagStruct{Value: "newvalue"},
+	}
+
+	// タグのない構造体はコピーする
+	dst := newDst()
+	c := &ProtectingCopier{ProtectFor: "update"}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(
+		t,
+		rootStruct{
+			ID: 1,
+			Allow: allowListStruct{
+				Name:    "newname",
+				Code:    "code",
+				Nest:    denyListStruct{Value: "newvalue", Secret: "secret"},
+				NoTag:   noTagStruct{Value: "newvalue"},
+				Ignored: denyListStruct{Value: "value", Secret: "secret"},
+			},
+			NoTag: noTagStruct{Value: "newvalue"},
+		},
+		dst,
+	)
+
+	// タグのない構造体はコピーしない
+	dst = newDst()
+	c = &ProtectingCopier{ProtectFor: "update", Mode: ProtectingCopyAllowList}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(
+		t,
+		rootStruct{
+			ID: 1,
+			Allow: allowListStruct{
+				Name:    "newname",
+				Code:    "code",
+				Nest:    denyListStruct{Value: "newvalue", Secret: "secret"},
+				NoTag:   noTagStruct{Value: "value"},
+				Ignored: denyListStruct{Value: "value", Secret: "secret"},
+			},
+			NoTag: noTagStruct{Value: "value"},
+		},
+		dst,
+	)
+}
+
+func TestProtectingCopyWritableTag(t *testing.T) {
+	type testStruct struct {
+		Field1 string `settable:"update"`
+		Field2 string `writablefor:"update"`
+	}
+
+	dst := testStruct{Field1: "value1", Field2: "value2"}
+	src := testStruct{Field1: "newvalue1", Field2: "newvalue2"}
+	c := &ProtectingCopier{ProtectFor: "update", WritableTag: "settable"}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(t, testStruct{Field1: "newvalue1", Field2: "value2"}, dst)
+}
+
+func TestProtectingCopyTypesDefault(t *testing.T) {
+	type testStruct struct {
+		Key      *datastore.Key
+		Location appengine.GeoPoint
+		Date     time.Time
+		KeyMap   map[string]*datastore.Key
+		Any      interface{}
+	}
+
+	key1 := &datastore.Key{}
+	key2 := &datastore.Key{}
+	key3 := &datastore.Key{}
+	key4 := &datastore.Key{}
+	date := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	dst := testStruct{
+		Key:    key1,
+		KeyMap: map[string]*datastore.Key{"key1": key1},
+		Any:    key1,
+	}
+	src := testStruct{
+		Key:      key2,
+		Location: appengine.GeoPoint{Lat: 35.6, Lng: 139.7},
+		Date:     date,
+		KeyMap:   map[string]*datastore.Key{"key1": key3},
+		Any:      key4,
+	}
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, ""))
+	// キーはポインタのままコピーされる
+	expectSame(t, key2, dst.Key)
+	expectSame(t, key3, dst.KeyMap["key1"])
+	expectSame(t, key4, dst.Any)
+	expectEquals(t, appengine.GeoPoint{Lat: 35.6, Lng: 139.7}, dst.Location)
+	expectEquals(t, date, dst.Date)
+}
+
+func TestProtectingCopyTypesOpaque(t *testing.T) {
+	type opaqueStruct struct {
+		Value  string
+		Secret string `protectfor:"update"`
+	}
+	type testStruct struct {
+		Value    opaqueStruct
+		Ptr      *opaqueStruct
+		ValueMap map[string]opaqueStruct
+	}
+
+	types := NewProtectingCopyTypes().
+		RegisterOpaque(reflect.TypeOf(opaqueStruct{})).
+		RegisterOpaque(reflect.TypeOf(&opaqueStruct{}))
+	c := &ProtectingCopier{ProtectFor: "update", Types: types}
+
+	ptr := &opaqueStruct{Value: "newvalue", Secret: "newsecret"}
+	dst := testStruct{
+		Value:    opaqueStruct{Value: "value", Secret: "secret"},
+		Ptr:      &opaqueStruct{Value: "value", Secret: "secret"},
+		ValueMap: map[string]opaqueStruct{"key1": {Value: "value", Secret: "secret"}},
+	}
+	src := testStruct{
+		Value:    opaqueStruct{Value: "newvalue", Secret: "newsecret"},
+		Ptr:      ptr,
+		ValueMap: map[string]opaqueStruct{"key1": {Value: "newvalue", Secret: "newsecret"}},
+	}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	// 登録された型ではタグは無視される
+	expectEquals(t, opaqueStruct{Value: "newvalue", Secret: "newsecret"}, dst.Value)
+	expectSame(t, ptr, dst.Ptr)
+	expectEquals(t, opaqueStruct{Value: "newvalue", Secret: "newsecret"}, dst.ValueMap["key1"])
+
+	// 既定の登録には影響しない
+	dst = testStruct{
+		Value: opaqueStruct{Value: "value", Secret: "secret"},
+	}
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, "update"))
+	expectEquals(t, opaqueStruct{Value: "newvalue", Secret: "secret"}, dst.Value)
+	expectNotSame(t, ptr, dst.Ptr)
+}
+
+func TestProtectingCopyTypesFunc(t *testing.T) {
+	type testStruct struct {
+		Value *big.Int
+		Slice []*big.Int
+	}
+
+	types := NewProtectingCopyTypes().RegisterFunc(
+		reflect.TypeOf(&big.Int{}),
+		func(dst, src reflect.Value) error {
+			if src.IsNil() {
+				dst.Set(src)
+				return nil
+			}
+			dst.Set(reflect.ValueOf(new(big.Int).Set(src.Interface().(*big.Int))))
+			return nil
+		},
+	)
+	c := &ProtectingCopier{Types: types}
+
+	dst := testStruct{}
+	src := testStruct{
+		Value: big.NewInt(100),
+		Slice: []*big.Int{big.NewInt(1), nil},
+	}
+	report, err := c.CopyWithReport(&dst, &src)
+	if err != nil {
+		t.Fatalf("Expect no err, but: %v", err)
+	}
+	expectEquals(t, "100", dst.Value.String())
+	expectNotSame(t, src.Value, dst.Value)
+	expectEquals(t, "1", dst.Slice[0].String())
+	expectNotSame(t, src.Slice[0], dst.Slice[0])
+	expectEquals(t, (*big.Int)(nil), dst.Slice[1])
+	expectEquals(t, true, report.IsChanged("Value"))
+}
+
+func TestProtectingCopyTypesSimpleKind(t *testing.T) {
+	type cents int
+	type testStruct struct {
+		Price cents
+	}
+
+	// 単純な型も登録できる
+	types := NewProtectingCopyTypes().RegisterFunc(
+		reflect.TypeOf(cents(0)),
+		func(dst, src reflect.Value) error {
+			dst.SetInt(src.Int() / 100 * 100)
+			return nil
+		},
+	)
+	c := &ProtectingCopier{Types: types}
+
+	dst := testStruct{}
+	src := testStruct{Price: 1234}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(t, testStruct{Price: 1200}, dst)
+
+	dst = testStruct{}
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, ""))
+	expectEquals(t, testStruct{Price: 1234}, dst)
+}
+
+func TestProtectingCopyTypesRegisterAfterCopy(t *testing.T) {
+	type opaqueStruct struct {
+		Secret string `protectfor:"update"`
+	}
+	type testStruct struct {
+		Value opaqueStruct
+	}
+
+	types := NewProtectingCopyTypes()
+	c := &ProtectingCopier{ProtectFor: "update", Types: types}
+	src := testStruct{Value: opaqueStruct{Secret: "newsecret"}}
+
+	dst := testStruct{Value: opaqueStruct{Secret: "secret"}}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(t, "secret", dst.Value.Secret)
+
+	// 登録するとキャッシュされたプランは使われない
+	types.RegisterOpaque(reflect.TypeOf(opaqueStruct{}))
+	dst = testStruct{Value: opaqueStruct{Secret: "secret"}}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(t, "newsecret", dst.Value.Secret)
+
+	types.Unregister(reflect.TypeOf(opaqueStruct{}))
+	dst = testStruct{Value: opaqueStruct{Secret: "secret"}}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(t, "secret", dst.Value.Secret)
+}
+
+func TestProtectingCopyTypesConcurrent(t *testing.T) {
+	type opaqueStruct struct {
+		Secret string `protectfor:"update"`
+	}
+	type testStruct struct {
+		Value opaqueStruct
+	}
+
+	// コピーと並行して登録できる
+	types := NewProtectingCopyTypes()
+	c := &ProtectingCopier{ProtectFor: "update", Types: types}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				dst := testStruct{}
+				src := testStruct{Value: opaqueStruct{Secret: "secret"}}
+				if err := c.Copy(&dst, &src); err != nil {
+					t.Errorf("Expect no error, but: %v", err)
+				}
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		types.RegisterOpaque(reflect.TypeOf(opaqueStruct{}))
+		types.Unregister(reflect.TypeOf(opaqueStruct{}))
+	}
+	wg.Wait()
+}
+
+func TestIsNonStruct(t *testing.T) {
+	expectEquals(t, true, IsNonStruct(time.Now()))
+	expectEquals(t, false, IsNonStruct(struct{}{}))
+	expectEquals(t, false, IsNonStruct(nil))
+}
+
+func TestProtectingCopyPlanCachedPerProtectFor(t *testing.T) {
+	type testStruct struct {
+		Field1 int `protectfor:"cond1"`
+		Field2 int `protectfor:"cond2"`
+		Field3 int `anothertag:"cond1"`
+	}
+
+	for _, c := range []struct {
+		copier   *ProtectingCopier
+		expected testStruct
+	}{
+		{
+			copier:   &ProtectingCopier{ProtectFor: "cond1"},
+			expected: testStruct{Field1: 1, Field2: 222, Field3: 333},
+		},
+		{
+			copier:   &ProtectingCopier{ProtectFor: "cond2"},
+			expected: testStruct{Field1: 111, Field2: 2, Field3: 333},
+		},
+		{
+			copier:   &ProtectingCopier{StructTag: "anothertag", ProtectFor: "cond1"},
+			expected: testStruct{Field1: 111, Field2: 222, Field3: 3},
+		},
+		// again with the cached plans
+		{
+			copier:   &ProtectingCopier{ProtectFor: "cond1"},
+			expected: testStruct{Field1: 1, Field2: 222, Field3: 333},
+		},
+	} {
+		dst := testStruct{Field1: 1, Field2: 2, Field3: 3}
+		src := testStruct{Field1: 111, Field2: 222, Field3: 333}
+		expectEquals(t, nil, c.copier.Copy(&dst, &src))
+		expectEquals(t, c.expected, dst)
+	}
+}
+
+func TestProtectingCopyPlanConcurrent(t *testing.T) {
+	type testStruct struct {
+		Field1 int `protectfor:"cond1"`
+		Field2 []string
+	}
+
+	done := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			dst := testStruct{Field1: i}
+			src := testStruct{Field1: -1, Field2: []string{"a", "b"}}
+			if err := ProtectingCopy(&dst, &src, "cond1"); err != nil {
+				done <- err
+				return
+			}
+			if !reflect.DeepEqual(testStruct{Field1: i, Field2: []string{"a", "b"}}, dst) {
+				done <- fmt.Errorf("Unexpected result: %#v", dst)
+				return
+			}
+			done <- nil
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// pathTestItem and pathTestStruct are structs assumed to be not taggable.
+type pathTestItem struct {
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+}
+
+type pathTestStruct struct {
+	Name   string
+	Owner  *pathTestItem
+	Items  []pathTestItem `json:"items"`
+	Meta   map[string]string
+	Detail struct {
+		Value1 string
+		Value2 string
+	}
+	Any        interface{}
+	unexported string
+}
+
+func TestProtectingCopyPaths(t *testing.T) {
+	paths, err := NewProtectingCopyPaths(
+		reflect.TypeOf(&pathTestStruct{}),
+		"Owner",
+		"items[*].price",
+		"Detail.*",
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dst := pathTestStruct{
+		Owner: &pathTestItem{Name: "owner"},
+		Items: []pathTestItem{{Name: "dst1", Price: 100}},
+		Meta:  map[string]string{"key": "dst"},
+	}
+	dst.Detail.Value1 = "dst"
+	src := pathTestStruct{
+		Name:  "src",
+		Owner: &pathTestItem{Name: "src"},
+		Items: []pathTestItem{{Name: "src1", Price: 200}},
+		Meta:  map[string]string{"key": "src"},
+	}
+	src.Detail.Value1 = "src"
+	src.Detail.Value2 = "src"
+
+	expectEquals(
+		t,
+		nil,
+		(&ProtectingCopier{ProtectPaths: paths}).Copy(&dst, &src),
+	)
+	expectEquals(t, "src", dst.Name)
+	expectEquals(t, &pathTestItem{Name: "owner"}, dst.Owner)
+	expectEquals(t, []pathTestItem{{Name: "src1", Price: 100}}, dst.Items)
+	expectEquals(t, map[string]string{"key": "src"}, dst.Meta)
+	expectEquals(t, "dst", dst.Detail.Value1)
+	expectEquals(t, "", dst.Detail.Value2)
+}
+
+func TestProtectingCopyPathsElements(t *testing.T) {
+	type testStruct struct {
+		Values []string
+		Map    map[string]string
+	}
+
+	paths, err := NewProtectingCopyPaths(
+		reflect.TypeOf(testStruct{}),
+		"Values[*]",
+		"Map[*]",
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dst := testStruct{
+		Values: []string{"dst1", "dst2"},
+		Map:    map[string]string{"key1": "dst1", "key2": "dst2"},
+	}
+	src := testStruct{
+		Values: []string{"src1"},
+		Map:    map[string]string{"key1": "src1", "key3": "src3"},
+	}
+
+	expectEquals(
+		t,
+		nil,
+		(&ProtectingCopier{ProtectPaths: paths}).Copy(&dst, &src),
+	)
+	// 新たに作られたスライスの要素は保護されたままゼロ値になる
+	expectEquals(t, []string{""}, dst.Values)
+	expectEquals(t, map[string]string{"key1": "dst1", "key2": "dst2"}, dst.Map)
+}
+
+func TestProtectingCopyPathsWithTags(t *testing.T) {
+	type testStruct struct {
+		Value1 string `protectfor:"update"`
+		Value2 string
+		Value3 string
+	}
+
+	paths, err := NewProtectingCopyPaths(reflect.TypeOf(testStruct{}), "Value2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dst := testStruct{}
+	src := testStruct{
+		Value1: "src1",
+		Value2: "src2",
+		Value3: "src3",
+	}
+
+	expectEquals(
+		t,
+		nil,
+		(&ProtectingCopier{ProtectFor: "update", ProtectPaths: paths}).Copy(&dst, &src),
+	)
+	expectEquals(t, testStruct{Value3: "src3"}, dst)
+}
+
+func TestProtectingCopyPathsReport(t *testing.T) {
+	paths, err := NewProtectingCopyPaths(
+		reflect.TypeOf(pathTestStruct{}),
+		"Name",
+		"Items[*].Price",
+		"Meta.*",
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dst := pathTestStruct{
+		Items: []pathTestItem{{Price: 100}},
+	}
+	src := pathTestStruct{
+		Name:  "src",
+		Items: []pathTestItem{{Price: 200}},
+		Meta:  map[string]string{"key": "src"},
+	}
+
+	report, err := (&ProtectingCopier{ProtectPaths: paths}).CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Name", Old: "", New: "src"},
+			{Path: "Items[0].Price", Old: 100, New: 200},
+			{Path: `Meta["key"]`, Old: "", New: "src"},
+		},
+		report.Discarded,
+	)
+
+	dst = pathTestStruct{}
+	err = (&ProtectingCopier{ProtectPaths: paths, Strict: true}).Copy(&dst, &src)
+	if _, ok := err.(*ErrCopyProtected); !ok {
+		t.Errorf("Expected ErrCopyProtected, but %v", err)
+	}
+}
+
+func TestProtectingCopyPathsInvalid(t *testing.T) {
+	for _, pattern := range []string{
+		"",
+		"Unknown",
+		"name",
+		"Owner.Unknown",
+		"Items.Price",
+		"Items[*]Price",
+		"Items[*].",
+		"Name[*]",
+		"Detail.*.Value",
+		"Any.Value",
+		"unexported",
+		"*.Unknown",
+	} {
+		if _, err := NewProtectingCopyPaths(reflect.TypeOf(pathTestStruct{}), pattern); err == nil {
+			t.Errorf("%q: Expected error", pattern)
+		}
+	}
+}
+
+func TestProtectingCopyPathsTypeMismatch(t *testing.T) {
+	paths, err := NewProtectingCopyPaths(reflect.TypeOf(pathTestStruct{}), "Name")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dst := pathTestItem{}
+	src := pathTestItem{}
+	err = (&ProtectingCopier{ProtectPaths: paths}).Copy(&dst, &src)
+	if _, ok := err.(*ErrCopyTypeMismatch); !ok {
+		t.Errorf("Expected ErrCopyTypeMismatch, but %v", err)
+	}
+}
+
+// protectorTestStruct has fields protected depending on values.
+type protectorTestStruct struct {
+	Status        string
+	ScheduledDate time.Time
+	Locked        bool
+	Value         string
+}
+
+// ProtectField makes Status write-once,
+// ScheduledDate changeable only while it is in the future,
+// and Value unchangeable while Locked.
+func (v *protectorTestStruct) ProtectField(field string, dst, src interface{}) bool {
+	switch field {
+	case "Status":
+		return dst != ""
+	case "ScheduledDate":
+		return !dst.(time.Time).IsZero() && dst.(time.Time).Before(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	case "Value":
+		return v.Locked
+	}
+	return false
+}
+
+func TestProtectingCopyFieldProtector(t *testing.T) {
+	past := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	future := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	src := protectorTestStruct{
+		Status:        "src",
+		ScheduledDate: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Locked:        false,
+		Value:         "src",
+	}
+	for _, tc := range []struct {
+		name     string
+		dst      protectorTestStruct
+		expected protectorTestStruct
+	}{
+		{
+			name:     "empty",
+			dst:      protectorTestStruct{},
+			expected: src,
+		},
+		{
+			name: "protected",
+			dst: protectorTestStruct{
+				Status:        "dst",
+				ScheduledDate: past,
+				Locked:        true,
+				Value:         "dst",
+			},
+			// Locked は先にコピーされるが、コピー前の状態で判定する
+			expected: protectorTestStruct{
+				Status:        "dst",
+				ScheduledDate: past,
+				Locked:        false,
+				Value:         "dst",
+			},
+		},
+		{
+			name: "future",
+			dst: protectorTestStruct{
+				ScheduledDate: future,
+			},
+			expected: src,
+		},
+	} {
+		dst := tc.dst
+		expectEquals(
+			t,
+			nil,
+			ProtectingCopy(&dst, &src, ""),
+		)
+		if !reflect.DeepEqual(tc.expected, dst) {
+			t.Errorf("%v: Expected %+v, but %+v", tc.name, tc.expected, dst)
+		}
+	}
+}
+
+func TestProtectingCopyFieldProtectorNested(t *testing.T) {
+	type testStruct struct {
+		Ptr   *protectorTestStruct
+		Slice []protectorTestStruct
+		Map   map[string]protectorTestStruct
+	}
+
+	dst := testStruct{
+		Slice: []protectorTestStruct{{Status: "dst"}},
+		Map: map[string]protectorTestStruct{
+			"key1": {Status: "dst"},
+		},
+	}
+	src := testStruct{
+		Ptr:   &protectorTestStruct{Status: "src"},
+		Slice: []protectorTestStruct{{Status: "src"}},
+		Map: map[string]protectorTestStruct{
+			"key1": {Status: "src"},
+		},
+	}
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, ""),
+	)
+	// 新たに作られた値はゼロ値の状態で判定される
+	expectEquals(t, &protectorTestStruct{Status: "src"}, dst.Ptr)
+	expectEquals(t, []protectorTestStruct{{Status: "dst"}}, dst.Slice)
+	// map の要素は新たに作られる
+	expectEquals(t, map[string]protectorTestStruct{"key1": {Status: "src"}}, dst.Map)
+}
+
+func TestProtectingCopyFieldProtectorReport(t *testing.T) {
+	dst := protectorTestStruct{Status: "dst"}
+	src := protectorTestStruct{Status: "src", Value: "src"}
+
+	report, err := (&ProtectingCopier{}).CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Value", Old: "", New: "src"},
+		},
+		report.Changed,
+	)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Status", Old: "dst", New: "src"},
+		},
+		report.Discarded,
+	)
+
+	dst = protectorTestStruct{Status: "dst"}
+	err = (&ProtectingCopier{Strict: true}).Copy(&dst, &src)
+	if _, ok := err.(*ErrCopyProtected); !ok {
+		t.Errorf("Expected ErrCopyProtected, but %v", err)
+	}
+}
+
+func TestProtectingCopierProtectField(t *testing.T) {
+	type testItem struct {
+		Name  string
+		Price int `protectfor:"update"`
+	}
+	type testStruct struct {
+		Name  string
+		Items []testItem
+	}
+
+	dst := testStruct{
+		Name:  "dst",
+		Items: []testItem{{Name: "dst1"}, {Name: "dst2"}},
+	}
+	src := testStruct{
+		Name:  "src",
+		Items: []testItem{{Name: "src1", Price: 100}, {Name: "src2", Price: 200}},
+	}
+	paths := []string{}
+	c := &ProtectingCopier{
+		ProtectFor: "update",
+		ProtectField: func(path string, dst, src interface{}) bool {
+			paths = append(paths, path)
+			return path == "Items[1].Name"
+		},
+	}
+	expectEquals(
+		t,
+		nil,
+		c.Copy(&dst, &src),
+	)
+	// タグで保護されたフィールドでは呼ばれない
+	expectEquals(t, []string{"Name", "Items", "Items[0].Name", "Items[1].Name"}, paths)
+	expectEquals(
+		t,
+		testStruct{
+			Name:  "src",
+			Items: []testItem{{Name: "src1"}, {Name: "dst2"}},
+		},
+		dst,
+	)
+}
+
+// embedTestLower is embedded as an unexported field.
+type embedTestLower struct {
+	ID   int64 `protectfor:"update"`
+	Name string
+}
+
+func TestProtectingCopyEmbedded(t *testing.T) {
+	type Base struct {
+		ID   int64 `protectfor:"update"`
+		Name string
+		Code string `protectfor:"create,update"`
+	}
+	type WritableBase struct {
+		ID   int64
+		Name string `writablefor:"update"`
+		Code string
+	}
+	type Other struct {
+		Name string
+		Note string
+	}
+	type Embedded struct {
+		Base
+		Value string
+	}
+	type EmbeddedProtected struct {
+		Base  `protectfor:"admin"`
+		Value string
+	}
+	type EmbeddedProtectedCreate struct {
+		Base  `protectfor:"create"`
+		Value string
+	}
+	type EmbeddedPtr struct {
+		*Base
+		Value string
+	}
+	type Shadowed struct {
+		Base
+		Name string
+	}
+	type Ambiguous struct {
+		Base
+		Other
+	}
+	type EmbeddedWritable struct {
+		WritableBase
+		Value string
+	}
+	type WritableEmbedding struct {
+		Base  `writablefor:"update"`
+		Value string `writablefor:"update"`
+		Other string
+	}
+	type WritableEmbeddingOverridden struct {
+		WritableBase `writablefor:"create"`
+		Value        string
+	}
+	type Nested struct {
+		EmbeddedProtectedCreate
+		Value2 string
+	}
+	type Lower struct {
+		embedTestLower
+		Value string
+	}
+	type LowerPtr struct {
+		*embedTestLower
+		Value string
+	}
+
+	for _, tc := range []struct {
+		name       string
+		protectFor string
+		dst        interface{}
+		src        interface{}
+		expected   interface{}
+	}{
+		{
+			name:       "tags in the embedded struct",
+			protectFor: "update",
+			dst:        &Embedded{Base: Base{ID: 1, Name: "dst", Code: "dst"}},
+			src:        &Embedded{Base: Base{ID: 2, Name: "src", Code: "src"}, Value: "src"},
+			expected:   &Embedded{Base: Base{ID: 1, Name: "src", Code: "dst"}, Value: "src"},
+		},
+		{
+			name:       "tags in the embedded struct for another purpose",
+			protectFor: "create",
+			dst:        &Embedded{Base: Base{ID: 1, Name: "dst", Code: "dst"}},
+			src:        &Embedded{Base: Base{ID: 2, Name: "src", Code: "src"}, Value: "src"},
+			expected:   &Embedded{Base: Base{ID: 2, Name: "src", Code: "dst"}, Value: "src"},
+		},
+		{
+			name:       "tag on the embedded field protects all",
+			protectFor: "admin",
+			dst:        &EmbeddedProtected{Base: Base{ID: 1, Name: "dst", Code: "dst"}},
+			src:        &EmbeddedProtected{Base: Base{ID: 2, Name: "src", Code: "src"}, Value: "src"},
+			expected:   &EmbeddedProtected{Base: Base{ID: 1, Name: "dst", Code: "dst"}, Value: "src"},
+		},
+		{
+			name:       "tag on the embedded field adds to inner tags",
+			protectFor: "update",
+			dst:        &EmbeddedProtectedCreate{Base: Base{ID: 1, Name: "dst", Code: "dst"}},
+			src:        &EmbeddedProtectedCreate{Base: Base{ID: 2, Name: "src", Code: "src"}, Value: "src"},
+			expected:   &EmbeddedProtectedCreate{Base: Base{ID: 1, Name: "src", Code: "dst"}, Value: "src"},
+		},
+		{
+			name:       "tags are inherited through multiple levels",
+			protectFor: "create",
+			dst:        &Nested{EmbeddedProtectedCreate: EmbeddedProtectedCreate{Base: Base{ID: 1, Name: "dst"}}},
+			src:        &Nested{EmbeddedProtectedCreate: EmbeddedProtectedCreate{Base: Base{ID: 2, Name: "src"}, Value: "src"}, Value2: "src"},
+			expected:   &Nested{EmbeddedProtectedCreate: EmbeddedProtectedCreate{Base: Base{ID: 1, Name: "dst"}, Value: "src"}, Value2: "src"},
+		},
+		{
+			name:       "embedded pointer created in dst",
+			protectFor: "update",
+			dst:        &EmbeddedPtr{},
+			src:        &EmbeddedPtr{Base: &Base{ID: 2, Name: "src", Code: "src"}, Value: "src"},
+			expected:   &EmbeddedPtr{Base: &Base{Name: "src"}, Value: "src"},
+		},
+		{
+			name:       "embedded pointer nil in src",
+			protectFor: "update",
+			dst:        &EmbeddedPtr{Base: &Base{ID: 1, Name: "dst", Code: "dst"}},
+			src:        &EmbeddedPtr{Value: "src"},
+			expected:   &EmbeddedPtr{Base: &Base{ID: 1, Code: "dst"}, Value: "src"},
+		},
+		{
+			name:       "embedded pointer nil in both",
+			protectFor: "update",
+			dst:        &EmbeddedPtr{},
+			src:        &EmbeddedPtr{Value: "src"},
+			expected:   &EmbeddedPtr{Value: "src"},
+		},
+		{
+			name:       "shadowed field is protected",
+			protectFor: "update",
+			dst:        &Shadowed{Base: Base{Name: "dst"}, Name: "dst"},
+			src:        &Shadowed{Base: Base{Name: "src"}, Name: "src"},
+			expected:   &Shadowed{Base: Base{Name: "dst"}, Name: "src"},
+		},
+		{
+			name:       "ambiguous fields are protected",
+			protectFor: "update",
+			dst:        &Ambiguous{Base: Base{Name: "dst"}, Other: Other{Name: "dst"}},
+			src:        &Ambiguous{Base: Base{Name: "src"}, Other: Other{Name: "src", Note: "src"}},
+			expected:   &Ambiguous{Base: Base{Name: "dst"}, Other: Other{Name: "dst", Note: "src"}},
+		},
+		{
+			name:       "writable tags in the embedded struct",
+			protectFor: "update",
+			dst:        &EmbeddedWritable{},
+			src:        &EmbeddedWritable{WritableBase: WritableBase{ID: 2, Name: "src", Code: "src"}, Value: "src"},
+			expected:   &EmbeddedWritable{WritableBase: WritableBase{Name: "src"}},
+		},
+		{
+			name:       "writable tag on the embedded field",
+			protectFor: "update",
+			dst:        &WritableEmbedding{},
+			src:        &WritableEmbedding{Base: Base{ID: 2, Name: "src", Code: "src"}, Value: "src", Other: "src"},
+			expected:   &WritableEmbedding{Base: Base{Name: "src"}, Value: "src"},
+		},
+		{
+			name:       "writable tags in the embedded struct override",
+			protectFor: "update",
+			dst:        &WritableEmbeddingOverridden{},
+			src:        &WritableEmbeddingOverridden{WritableBase: WritableBase{ID: 2, Name: "src", Code: "src"}, Value: "src"},
+			expected:   &WritableEmbeddingOverridden{WritableBase: WritableBase{Name: "src"}},
+		},
+		{
+			name:       "writable tag on the embedded field for another purpose",
+			protectFor: "create",
+			dst:        &WritableEmbeddingOverridden{},
+			src:        &WritableEmbeddingOverridden{WritableBase: WritableBase{ID: 2, Name: "src", Code: "src"}, Value: "src"},
+			expected:   &WritableEmbeddingOverridden{WritableBase: WritableBase{ID: 2, Code: "src"}},
+		},
+		{
+			name:       "unexported embedded struct",
+			protectFor: "update",
+			dst:        &Lower{embedTestLower: embedTestLower{ID: 1, Name: "dst"}},
+			src:        &Lower{embedTestLower: embedTestLower{ID: 2, Name: "src"}, Value: "src"},
+			expected:   &Lower{embedTestLower: embedTestLower{ID: 1, Name: "src"}, Value: "src"},
+		},
+		{
+			name:       "unexported embedded pointer is not copied",
+			protectFor: "update",
+			dst:        &LowerPtr{},
+			src:        &LowerPtr{embedTestLower: &embedTestLower{ID: 2, Name: "src"}, Value: "src"},
+			expected:   &LowerPtr{Value: "src"},
+		},
+	} {
+		if err := ProtectingCopy(tc.dst, tc.src, tc.protectFor); err != nil {
+			t.Errorf("%v: Unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(tc.expected, tc.dst) {
+			t.Errorf("%v: Expected %+v, but %+v", tc.name, tc.expected, tc.dst)
+		}
+	}
+}
+
+func TestProtectingCopyEmbeddedRecursive(t *testing.T) {
+	type Node struct {
+		*Node
+		Value  string
+		Secret string `protectfor:"update"`
+	}
+
+	dst := &Node{Secret: "dst"}
+	src := &Node{Value: "src1", Secret: "src", Node: &Node{Value: "src2", Secret: "src"}}
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(dst, src, "update"),
+	)
+	expectEquals(t, &Node{Value: "src1", Secret: "dst", Node: &Node{Value: "src2"}}, dst)
+	expectNotSame(t, src.Node, dst.Node)
+}
+
+func TestProtectingCopyEmbeddedReport(t *testing.T) {
+	type Base struct {
+		ID   int64 `protectfor:"update"`
+		Name string
+	}
+	type testStruct struct {
+		*Base
+		Value string
+	}
+
+	dst := testStruct{Base: &Base{ID: 1, Name: "dst"}}
+	src := testStruct{Base: &Base{ID: 2, Name: "src"}}
+	report, err := (&ProtectingCopier{ProtectFor: "update"}).CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Base.Name", Old: "dst", New: "src"},
+		},
+		report.Changed,
+	)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Base.ID", Old: int64(1), New: int64(2)},
+		},
+		report.Discarded,
+	)
+	expectEquals(t, true, report.IsChanged("Base"))
+
+	// 作成された場合は全体が報告される
+	dst = testStruct{}
+	report, err = (&ProtectingCopier{ProtectFor: "update"}).CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Base", Old: (*Base)(nil), New: &Base{Name: "src"}},
+		},
+		report.Changed,
+	)
+}
+
+func TestProtectingCopyEmbeddedPaths(t *testing.T) {
+	type Base struct {
+		ID   int64
+		Name string
+	}
+	type testStruct struct {
+		Base
+		Value string
+	}
+
+	paths, err := NewProtectingCopyPaths(reflect.TypeOf(testStruct{}), "Base.ID")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dst := testStruct{Base: Base{ID: 1}}
+	src := testStruct{Base: Base{ID: 2, Name: "src"}, Value: "src"}
+	expectEquals(
+		t,
+		nil,
+		(&ProtectingCopier{ProtectPaths: paths}).Copy(&dst, &src),
+	)
+	expectEquals(t, testStruct{Base: Base{ID: 1, Name: "src"}, Value: "src"}, dst)
+}
+
+type mergeTestItem struct {
+	ID    int64 `protectkey:""`
+	Name  string
+	Price int `protectfor:"update"`
+}
+
+func TestProtectingCopySliceMergeByKey(t *testing.T) {
+	type testStruct struct {
+		Items []mergeTestItem
+	}
+
+	dst := testStruct{
+		Items: []mergeTestItem{
+			{ID: 1, Name: "dst1", Price: 100},
+			{ID: 2, Name: "dst2", Price: 200},
+			{ID: 3, Name: "dst3", Price: 300},
+		},
+	}
+	src := testStruct{
+		Items: []mergeTestItem{
+			{ID: 3, Name: "src3", Price: 999},
+			{ID: 1, Name: "src1"},
+			{ID: 4, Name: "src4", Price: 400},
+			{Name: "src0", Price: 500},
+		},
+	}
+	c := &ProtectingCopier{ProtectFor: "update", SliceStrategy: ProtectingCopySliceMergeByKey}
+	expectEquals(
+		t,
+		nil,
+		c.Copy(&dst, &src),
+	)
+	expectEquals(
+		t,
+		[]mergeTestItem{
+			{ID: 3, Name: "src3", Price: 300},
+			{ID: 1, Name: "src1", Price: 100},
+			{ID: 4, Name: "src4"},
+			{Name: "src0"},
+		},
+		dst.Items,
+	)
+	expectNotSame(t, src.Items, dst.Items)
+}
+
+func TestProtectingCopySliceMergeByKeyAppend(t *testing.T) {
+	type testStruct struct {
+		Items []mergeTestItem
+	}
+
+	for _, tc := range []struct {
+		strategy ProtectingCopySliceStrategy
+		expected []mergeTestItem
+	}{
+		{
+			// 長さが異なると置き換えられ、保護されたフィールドが失われる
+			strategy: ProtectingCopySliceReplace,
+			expected: []mergeTestItem{{ID: 1, Name: "src1"}, {ID: 2, Name: "src2"}},
+		},
+		{
+			strategy: ProtectingCopySliceMergeByKey,
+			expected: []mergeTestItem{{ID: 1, Name: "src1", Price: 100}, {ID: 2, Name: "src2"}},
+		},
+	} {
+		dst := testStruct{
+			Items: []mergeTestItem{{ID: 1, Name: "dst1", Price: 100}},
+		}
+		src := testStruct{
+			Items: []mergeTestItem{{ID: 1, Name: "src1"}, {ID: 2, Name: "src2", Price: 200}},
+		}
+		c := &ProtectingCopier{ProtectFor: "update", SliceStrategy: tc.strategy}
+		expectEquals(
+			t,
+			nil,
+			c.Copy(&dst, &src),
+		)
+		expectEquals(t, tc.expected, dst.Items)
+	}
+}
+
+func TestProtectingCopySliceMergeByKeyInPlace(t *testing.T) {
+	type testStruct struct {
+		Items []mergeTestItem
+	}
+
+	dstItems := []mergeTestItem{{ID: 1, Price: 100}, {ID: 2, Price: 200}}
+	dst := testStruct{Items: dstItems}
+	src := testStruct{
+		Items: []mergeTestItem{{ID: 1, Name: "src1"}, {ID: 2, Name: "src2"}},
+	}
+	c := &ProtectingCopier{ProtectFor: "update", SliceStrategy: ProtectingCopySliceMergeByKey}
+	expectEquals(
+		t,
+		nil,
+		c.Copy(&dst, &src),
+	)
+	expectSame(t, dstItems, dst.Items)
+	expectEquals(t, []mergeTestItem{{ID: 1, Name: "src1", Price: 100}, {ID: 2, Name: "src2", Price: 200}}, dst.Items)
+}
+
+func TestProtectingCopySliceMergeByKeyPointers(t *testing.T) {
+	type testStruct struct {
+		Items []*mergeTestItem
+	}
+
+	dst1 := &mergeTestItem{ID: 1, Price: 100}
+	dst2 := &mergeTestItem{ID: 2, Price: 200}
+	dst := testStruct{Items: []*mergeTestItem{dst1, dst2}}
+	src := testStruct{
+		Items: []*mergeTestItem{
+			{ID: 2, Name: "src2"},
+			nil,
+			{ID: 3, Name: "src3", Price: 300},
+		},
+	}
+	c := &ProtectingCopier{ProtectFor: "update", SliceStrategy: ProtectingCopySliceMergeByKey}
+	expectEquals(
+		t,
+		nil,
+		c.Copy(&dst, &src),
+	)
+	expectEquals(
+		t,
+		[]*mergeTestItem{
+			{ID: 2, Name: "src2", Price: 200},
+			nil,
+			{ID: 3, Name: "src3"},
+		},
+		dst.Items,
+	)
+	expectSame(t, dst2, dst.Items[0])
+	expectNotSame(t, src.Items[2], dst.Items[2])
+	// 削除された要素は変更されない
+	expectEquals(t, &mergeTestItem{ID: 1, Price: 100}, dst1)
+}
+
+func TestProtectingCopySliceMergeByKeyInMap(t *testing.T) {
+	dst := map[string][]mergeTestItem{
+		"key1": {{ID: 1, Price: 100}},
+	}
+	src := map[string][]mergeTestItem{
+		"key1": {{ID: 2, Name: "src2"}, {ID: 1, Name: "src1"}},
+	}
+	c := &ProtectingCopier{ProtectFor: "update", SliceStrategy: ProtectingCopySliceMergeByKey}
+	expectEquals(
+		t,
+		nil,
+		c.Copy(dst, src),
+	)
+	expectEquals(
+		t,
+		map[string][]mergeTestItem{
+			"key1": {{ID: 2, Name: "src2"}, {ID: 1, Name: "src1", Price: 100}},
+		},
+		dst,
+	)
+}
+
+func TestProtectingCopySliceMergeByKeyReport(t *testing.T) {
+	type testStruct struct {
+		Items []mergeTestItem
+	}
+
+	dst := testStruct{
+		Items: []mergeTestItem{{ID: 1, Name: "dst1"}, {ID: 2, Name: "dst2"}},
+	}
+	src := testStruct{
+		Items: []mergeTestItem{{ID: 2, Name: "src2"}, {ID: 3, Name: "src3"}},
+	}
+	c := &ProtectingCopier{ProtectFor: "update", SliceStrategy: ProtectingCopySliceMergeByKey}
+	report, err := c.CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			// 削除された要素は dst でのインデックスで報告される
+			{Path: "Items[0]", Old: mergeTestItem{ID: 1, Name: "dst1"}, New: nil},
+			{Path: "Items[0].Name", Old: "dst2", New: "src2"},
+			{Path: "Items[1]", Old: nil, New: mergeTestItem{ID: 3, Name: "src3"}},
+		},
+		report.Changed,
+	)
+}
+
+func TestProtectingCopySliceMergeByKeyTag(t *testing.T) {
+	type testItem struct {
+		ID    string `id:""`
+		Value string `protectfor:"update"`
+	}
+	type testStruct struct {
+		Items []testItem
+	}
+
+	dst := testStruct{Items: []testItem{{ID: "a", Value: "dst"}}}
+	src := testStruct{Items: []testItem{{ID: "b"}, {ID: "a"}}}
+	c := &ProtectingCopier{
+		ProtectFor:    "update",
+		KeyTag:        "id",
+		SliceStrategy: ProtectingCopySliceMergeByKey,
+	}
+	expectEquals(
+		t,
+		nil,
+		c.Copy(&dst, &src),
+	)
+	expectEquals(t, []testItem{{ID: "b"}, {ID: "a", Value: "dst"}}, dst.Items)
+}
+
+func TestProtectingCopySliceMergeByKeyNotComparable(t *testing.T) {
+	type testItem struct {
+		ID []string `protectkey:""`
+	}
+	type testStruct struct {
+		Items []testItem
+	}
+
+	dst := testStruct{}
+	src := testStruct{Items: []testItem{{ID: []string{"a"}}}}
+	c := &ProtectingCopier{SliceStrategy: ProtectingCopySliceMergeByKey}
+	if _, ok := c.Copy(&dst, &src).(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expected ErrCopyValueInvalid")
+	}
+}
+
+func TestProtectingCopyPropertyList(t *testing.T) {
+	paths, err := NewProtectingCopyPaths(reflect.TypeOf(datastore.PropertyList{}), "Owner")
+	expectEquals(t, nil, err)
+	c := &ProtectingCopier{ProtectPaths: paths}
+
+	dst := datastore.PropertyList{
+		{Name: "Name", Value: "oldname"},
+		{Name: "Owner", Value: "alice"},
+		{Name: "Tags", Value: "tag1", Multiple: true},
+		{Name: "Tags", Value: "tag2", Multiple: true},
+		{Name: "Removed", Value: int64(1)},
+	}
+	src := datastore.PropertyList{
+		{Name: "Name", Value: "newname", NoIndex: true},
+		{Name: "Owner", Value: "bob"},
+		{Name: "Tags", Value: "tag3", Multiple: true},
+		{Name: "Added", Value: int64(2)},
+	}
+	report, err := c.CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	expectEquals(
+		t,
+		datastore.PropertyList{
+			{Name: "Name", Value: "newname", NoIndex: true},
+			{Name: "Owner", Value: "alice"},
+			{Name: "Tags", Value: "tag3", Multiple: true},
+			{Name: "Added", Value: int64(2)},
+		},
+		dst,
+	)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: `["Name"]`, Old: "oldname", New: "newname"},
+			{Path: `["Tags"]`, Old: []interface{}{"tag1", "tag2"}, New: []interface{}{"tag3"}},
+			{Path: `["Added"]`, Old: nil, New: int64(2)},
+			{Path: `["Removed"]`, Old: int64(1), New: nil},
+		},
+		report.Changed,
+	)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: `["Owner"]`, Old: "alice", New: "bob"},
+		},
+		report.Discarded,
+	)
+}
+
+func TestProtectingCopyPropertyListField(t *testing.T) {
+	type testStruct struct {
+		Name  string
+		Props datastore.PropertyList
+	}
+	paths, err := NewProtectingCopyPaths(reflect.TypeOf(testStruct{}), "Props.Owner")
+	expectEquals(t, nil, err)
+	secret := func(path string, dst, src interface{}) bool {
+		return path == `Props["Secret"]`
+	}
+	c := &ProtectingCopier{ProtectPaths: paths, ProtectField: secret}
+
+	dst := testStruct{
+		Name: "oldname",
+		Props: datastore.PropertyList{
+			{Name: "Owner", Value: "alice"},
+			{Name: "Secret", Value: "secret"},
+			{Name: "Note", Value: "oldnote"},
+		},
+	}
+	src := testStruct{
+		Name: "newname",
+		Props: datastore.PropertyList{
+			{Name: "Note", Value: "newnote"},
+			{Name: "Owner", Value: "bob"},
+		},
+	}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(
+		t,
+		testStruct{
+			Name: "newname",
+			Props: datastore.PropertyList{
+				{Name: "Note", Value: "newnote"},
+				{Name: "Owner", Value: "alice"},
+				{Name: "Secret", Value: "secret"},
+			},
+		},
+		dst,
+	)
+
+	// nil はそのままコピーされる
+	src.Props = nil
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(t, datastore.PropertyList(nil), dst.Props)
+}
+
+func TestProtectingCopyPropertyListPaths(t *testing.T) {
+	if _, err := NewProtectingCopyPaths(reflect.TypeOf(datastore.PropertyList{}), "Owner.Name"); err == nil {
+		t.Errorf("Expect err for a path into a property, but nil")
+	}
+	if _, err := NewProtectingCopyPaths(reflect.TypeOf(datastore.PropertyList{}), "[*]"); err == nil {
+		t.Errorf("Expect err for elements of properties, but nil")
+	}
+}
+
+// plsTestModel is a goon model with custom Load and Save.
+type plsTestModel struct {
+	ID    int64 `datastore:"-" goon:"id"`
+	Name  string
+	Owner string `protectfor:"update"`
+	Tags  []string
+	// NameLength is computed in Load.
+	NameLength int `datastore:"-"`
+}
+
+func (m *plsTestModel) Load(properties []datastore.Property) error {
+	if err := datastore.LoadStruct(m, properties); err != nil {
+		return err
+	}
+	m.NameLength = len(m.Name)
+	return nil
+}
+
+func (m *plsTestModel) Save() ([]datastore.Property, error) {
+	return datastore.SaveStruct(m)
+}
+
+func TestProtectingCopyPropertyLoadSaver(t *testing.T) {
+	dst := plsTestModel{
+		ID:         1,
+		Name:       "oldname",
+		Owner:      "alice",
+		Tags:       []string{"tag1", "tag2"},
+		NameLength: 7,
+	}
+	src := plsTestModel{
+		ID:    2,
+		Name:  "new",
+		Owner: "bob",
+		Tags:  []string{"tag3"},
+	}
+	report, err := (&ProtectingCopier{ProtectFor: "update"}).CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	// 保存されないフィールド (goon のキー) は維持され、スライスは追記されない
+	expectEquals(
+		t,
+		plsTestModel{
+			ID:         1,
+			Name:       "new",
+			Owner:      "alice",
+			Tags:       []string{"tag3"},
+			NameLength: 3,
+		},
+		dst,
+	)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Name", Old: "oldname", New: "new"},
+			{Path: "Tags", Old: []interface{}{"tag1", "tag2"}, New: []interface{}{"tag3"}},
+		},
+		report.Changed,
+	)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Owner", Old: "alice", New: "bob"},
+		},
+		report.Discarded,
+	)
+
+	err = (&ProtectingCopier{ProtectFor: "update", Strict: true}).Copy(&dst, &src)
+	if e, ok := err.(*ErrCopyProtected); !ok {
+		t.Fatalf("Expect ErrCopyProtected, but: %v", err)
+	} else {
+		expectEquals(t, []string{"Owner"}, e.Paths)
+	}
+}
+
+func TestProtectingCopyPropertyLoadSaverNested(t *testing.T) {
+	type testStruct struct {
+		Models []*plsTestModel
+		Map    map[string]plsTestModel
+	}
+
+	dst := testStruct{
+		Models: []*plsTestModel{{ID: 1, Name: "name1", Owner: "alice"}},
+		Map:    map[string]plsTestModel{"key": {ID: 2, Name: "name2", Owner: "alice"}},
+	}
+	src := testStruct{
+		Models: []*plsTestModel{{Name: "newname1", Owner: "bob"}},
+		Map:    map[string]plsTestModel{"key": {Name: "newname2", Owner: "bob"}},
+	}
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, "update"))
+	expectEquals(
+		t,
+		&plsTestModel{ID: 1, Name: "newname1", Owner: "alice", NameLength: 8},
+		dst.Models[0],
+	)
+	// map の値は新しく作成される
+	expectEquals(
+		t,
+		plsTestModel{Name: "newname2", NameLength: 8},
+		dst.Map["key"],
+	)
+}
+
+type unexportedTestStruct struct {
+	Name    string
+	private string
+	secret  string `protectfor:"update"`
+}
+
+func TestProtectingCopyUnexportedSkip(t *testing.T) {
+	dst := unexportedTestStruct{Name: "name", private: "private", secret: "secret"}
+	src := unexportedTestStruct{Name: "newname", private: "newprivate", secret: "newsecret"}
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, "update"))
+	expectEquals(t, unexportedTestStruct{Name: "newname", private: "private", secret: "secret"}, dst)
+}
+
+func TestProtectingCopyUnexportedError(t *testing.T) {
+	c := &ProtectingCopier{Unexported: ProtectingCopyUnexportedError}
+	dst := unexportedTestStruct{Name: "name", private: "private"}
+	src := unexportedTestStruct{Name: "newname", private: "newprivate"}
+	if _, ok := c.Copy(&dst, &src).(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expect ErrCopyValueInvalid")
+	}
+	expectEquals(t, unexportedTestStruct{Name: "name", private: "private"}, dst)
+
+	// 保護された非公開フィールドはエラーにならない
+	type protectedStruct struct {
+		Name    string
+		private string `protectfor:"update"`
+	}
+	c.ProtectFor = "update"
+	pDst := protectedStruct{Name: "name", private: "private"}
+	pSrc := protectedStruct{Name: "newname", private: "newprivate"}
+	expectEquals(t, nil, c.Copy(&pDst, &pSrc))
+	expectEquals(t, protectedStruct{Name: "newname", private: "private"}, pDst)
+}
+
+type uncopyableTestStruct struct {
+	Name string
+	Ch   chan int
+	Func func() int
+	Any  interface{}
+}
+
+func TestProtectingCopyUncopyable(t *testing.T) {
+	dCh := make(chan int)
+	sCh := make(chan int)
+	dFunc := func() int { return 1 }
+	sFunc := func() int { return 2 }
+	newValues := func() (uncopyableTestStruct, uncopyableTestStruct) {
+		return uncopyableTestStruct{Name: "name", Ch: dCh, Func: dFunc},
+			uncopyableTestStruct{Name: "newname", Ch: sCh, Func: sFunc}
+	}
+
+	// 既定では共有される
+	dst, src := newValues()
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, ""))
+	expectEquals(t, sCh, dst.Ch)
+	expectEquals(t, 2, dst.Func())
+
+	dst, src = newValues()
+	expectEquals(t, nil, (&ProtectingCopier{Uncopyable: ProtectingCopyUncopyableSkip}).Copy(&dst, &src))
+	expectEquals(t, "newname", dst.Name)
+	expectEquals(t, dCh, dst.Ch)
+	expectEquals(t, 1, dst.Func())
+
+	dst, src = newValues()
+	err := (&ProtectingCopier{Uncopyable: ProtectingCopyUncopyableError}).Copy(&dst, &src)
+	if _, ok := err.(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expect ErrCopyValueInvalid, but: %v", err)
+	}
+
+	// nil は何も共有しないのでコピーされる
+	dst, src = newValues()
+	src.Ch = nil
+	src.Func = nil
+	expectEquals(t, nil, (&ProtectingCopier{Uncopyable: ProtectingCopyUncopyableError}).Copy(&dst, &src))
+	expectEquals(t, uncopyableTestStruct{Name: "newname"}, dst)
+
+	// interface の中も同様
+	dst, src = newValues()
+	src.Ch = nil
+	src.Func = nil
+	src.Any = sCh
+	err = (&ProtectingCopier{Uncopyable: ProtectingCopyUncopyableError}).Copy(&dst, &src)
+	if _, ok := err.(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expect ErrCopyValueInvalid, but: %v", err)
+	}
+}
+
+// memoryRange is a range of addresses [start, end).
+type memoryRange struct {
+	start uintptr
+	end   uintptr
+}
+
+// immutableTypes are types which cannot be modified through values of them.
+var immutableTypes = map[reflect.Type]bool{
+	reflect.TypeOf(time.Time{}):           true,
+	reflect.TypeOf((*datastore.Key)(nil)): true,
+	reflect.TypeOf(appengine.GeoPoint{}):  true,
+}
+
+// collectMutableMemory collects ranges of memory which can be modified through v
+// except values of immutable types and keys of maps.
+// Chans, funcs and unsafe.Pointer are collected as they are shared state.
+func collectMutableMemory(v reflect.Value, ranges *[]memoryRange, visited map[memoryRange]bool) {
+	if !v.IsValid() {
+		return
+	}
+	if immutableTypes[v.Type()] {
+		return
+	}
+	var r memoryRange
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		r = memoryRange{v.Pointer(), v.Pointer() + v.Type().Elem().Size()}
+	case reflect.Slice:
+		if v.IsNil() || v.Cap() == 0 {
+			return
+		}
+		r = memoryRange{v.Pointer(), v.Pointer() + uintptr(v.Cap())*v.Type().Elem().Size()}
+	case reflect.Map, reflect.Chan, reflect.Func:
+		if v.IsNil() {
+			return
+		}
+		r = memoryRange{v.Pointer(), v.Pointer() + 1}
+	case reflect.UnsafePointer:
+		if v.Pointer() == 0 {
+			return
+		}
+		r = memoryRange{v.Pointer(), v.Pointer() + 1}
+	case reflect.Interface:
+		collectMutableMemory(v.Elem(), ranges, visited)
+		return
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			collectMutableMemory(v.Field(idx), ranges, visited)
+		}
+		return
+	case reflect.Array:
+		for idx := 0; idx < v.Len(); idx++ {
+			collectMutableMemory(v.Index(idx), ranges, visited)
+		}
+		return
+	default:
+		return
+	}
+	if visited[r] {
+		return
+	}
+	visited[r] = true
+	*ranges = append(*ranges, r)
+	switch v.Kind() {
+	case reflect.Ptr:
+		collectMutableMemory(v.Elem(), ranges, visited)
+	case reflect.Slice:
+		for idx := 0; idx < v.Len(); idx++ {
+			collectMutableMemory(v.Index(idx), ranges, visited)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			collectMutableMemory(v.MapIndex(key), ranges, visited)
+		}
+	}
+}
+
+// findAliasing returns the range of memory of src which can be modified
+// and is referred from dst.
+func findAliasing(dst, src interface{}) (memoryRange, bool) {
+	var dRanges, sRanges []memoryRange
+	collectMutableMemory(reflect.ValueOf(dst), &dRanges, map[memoryRange]bool{})
+	collectMutableMemory(reflect.ValueOf(src), &sRanges, map[memoryRange]bool{})
+	for _, d := range dRanges {
+		for _, s := range sRanges {
+			if d.start < s.end && s.start < d.end {
+				return s, true
+			}
+		}
+	}
+	return memoryRange{}, false
+}
+
+// expectNoAliasing tests dst refers no memory of src which can be modified.
+func expectNoAliasing(t *testing.T, dst, src interface{}) {
+	if s, ok := findAliasing(dst, src); ok {
+		_, file, line, _ := runtime.Caller(1)
+		t.Errorf("Expect no aliasing, but dst refers src at %v:%v: %#x-%#x", file, line, s.start, s.end)
+	}
+}
+
+type aliasTestItem struct {
+	Name   string
+	Values []int
+	Meta   map[string]*int
+}
+
+type aliasTestStruct struct {
+	Ptr      *int
+	Items    []aliasTestItem
+	PtrItems []*aliasTestItem
+	Array    [2]*int
+	Map      map[string]aliasTestItem
+	Slices   map[string][]int
+	Any      interface{}
+	AnyPtr   interface{}
+	Bytes    []byte
+	Date     time.Time
+	Props    datastore.PropertyList
+	Nested   *aliasTestStruct
+	Private  int `protectfor:"update"`
+}
+
+func newAliasTestStruct(n int) *aliasTestStruct {
+	value := func() *int {
+		v := n
+		return &v
+	}
+	item := func() aliasTestItem {
+		return aliasTestItem{
+			Name:   fmt.Sprint("item", n),
+			Values: []int{n, n + 1},
+			Meta:   map[string]*int{"key": value()},
+		}
+	}
+	ptrItem := item()
+	return &aliasTestStruct{
+		Ptr:      value(),
+		Items:    []aliasTestItem{item(), item()},
+		PtrItems: []*aliasTestItem{&ptrItem},
+		Array:    [2]*int{value(), value()},
+		Map:      map[string]aliasTestItem{"key": item()},
+		Slices:   map[string][]int{"key": {n}},
+		Any:      []int{n},
+		AnyPtr:   value(),
+		Bytes:    []byte{byte(n)},
+		Date:     time.Date(2017, 1, 2, 3, 4, 5, n, time.UTC),
+		Props: datastore.PropertyList{
+			{Name: "Bytes", Value: []byte{byte(n)}},
+		},
+		Nested: &aliasTestStruct{
+			Ptr:   value(),
+			Items: []aliasTestItem{item()},
+		},
+		Private: n,
+	}
+}
+
+// dst は src の変更可能なメモリを参照しない
+func TestProtectingCopyNoAliasing(t *testing.T) {
+	testcases := []struct {
+		name string
+		dst  *aliasTestStruct
+	}{
+		{
+			// everything is created
+			name: "zero",
+			dst:  &aliasTestStruct{},
+		},
+		{
+			// everything is copied in place
+			name: "same shape",
+			dst:  newAliasTestStruct(1),
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			src := newAliasTestStruct(2)
+			dst := testcase.dst
+			expectEquals(t, nil, ProtectingCopy(dst, src, "update"))
+			expectNoAliasing(t, dst, src)
+
+			// modifying src does not affect dst
+			expected := newAliasTestStruct(2)
+			expected.Private = dst.Private
+			*src.Ptr = 100
+			src.Items[0].Values[0] = 100
+			*src.Items[0].Meta["key"] = 100
+			src.PtrItems[0].Name = "modified"
+			*src.Array[0] = 100
+			src.Map["key"].Values[0] = 100
+			src.Slices["key"][0] = 100
+			src.Any.([]int)[0] = 100
+			*src.AnyPtr.(*int) = 100
+			src.Bytes[0] = 100
+			src.Props[0].Value.([]byte)[0] = 100
+			*src.Nested.Ptr = 100
+			expectEquals(t, expected, dst)
+		})
+	}
+}
+
+func TestProtectingCopyNoAliasingSliceMerge(t *testing.T) {
+	dst := []mergeTestItem{{ID: 1, Name: "item1"}}
+	src := []mergeTestItem{{ID: 2, Name: "item2"}, {ID: 1, Name: "newitem1"}}
+	c := &ProtectingCopier{SliceStrategy: ProtectingCopySliceMergeByKey}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectNoAliasing(t, dst, src)
+}
+
+// ProtectingCopyUncopyableShare と登録された可変の型は src と共有される
+func TestProtectingCopyNoAliasingExceptions(t *testing.T) {
+	dst := uncopyableTestStruct{}
+	src := uncopyableTestStruct{Name: "newname", Ch: make(chan int)}
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, ""))
+	if _, ok := findAliasing(dst, src); !ok {
+		t.Errorf("Expect chans are shared with ProtectingCopyUncopyableShare")
+	}
+
+	dst = uncopyableTestStruct{}
+	src = uncopyableTestStruct{Name: "newname", Func: func() int { return 2 }}
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, ""))
+	if _, ok := findAliasing(dst, src); !ok {
+		t.Errorf("Expect funcs are shared with ProtectingCopyUncopyableShare")
+	}
+
+	dst = uncopyableTestStruct{}
+	src = uncopyableTestStruct{Name: "newname", Ch: make(chan int), Func: func() int { return 2 }}
+	expectEquals(t, nil, (&ProtectingCopier{Uncopyable: ProtectingCopyUncopyableSkip}).Copy(&dst, &src))
+	expectNoAliasing(t, dst, src)
+
+	type fileStruct struct {
+		File *multipart.FileHeader
+	}
+	fileDst := fileStruct{}
+	fileSrc := fileStruct{File: &multipart.FileHeader{Filename: "file.txt"}}
+	expectEquals(t, nil, ProtectingCopy(&fileDst, &fileSrc, ""))
+	if _, ok := findAliasing(fileDst, fileSrc); !ok {
+		t.Errorf("Expect *multipart.FileHeader is shared as an opaque type")
+	}
+}
+
+func TestProtectingCopyTransform(t *testing.T) {
+	type testStruct struct {
+		Name     string    `protecttransform:"trim"`
+		Email    *string   `protecttransform:"trim,lower"`
+		Tags     []string  `protecttransform:"upper"`
+		Time     time.Time `protecttransform:"truncate=1s"`
+		Password string    `protectfor:"update" protecttransform:"trim"`
+	}
+
+	email := " User@Example.COM "
+	dst := testStruct{
+		Password: "password",
+	}
+	src := testStruct{
+		Name:     "  name  ",
+		Email:    &email,
+		Tags:     []string{"a", "b"},
+		Time:     time.Date(2020, 1, 2, 3, 4, 5, 678, time.UTC),
+		Password: " newpassword ",
+	}
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, "update"))
+	expectedEmail := "user@example.com"
+	expectEquals(
+		t,
+		testStruct{
+			Name:     "name",
+			Email:    &expectedEmail,
+			Tags:     []string{"A", "B"},
+			Time:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			Password: "password",
+		},
+		dst,
+	)
+	// ソースは変更されない
+	expectEquals(t, " User@Example.COM ", email)
+	expectEquals(t, []string{"a", "b"}, src.Tags)
+	expectNoAliasing(t, dst, src)
+}
+
+func TestProtectingCopyTransformReport(t *testing.T) {
+	type testStruct struct {
+		Name string `protecttransform:"trim"`
+	}
+
+	dst := testStruct{Name: "name"}
+	src := testStruct{Name: " name "}
+	report, err := (&ProtectingCopier{}).CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	// 変換後に同じ値なので変更なし
+	expectEquals(t, []ProtectingCopyChange(nil), report.Changed)
+
+	src.Name = " name2 "
+	report, err = (&ProtectingCopier{}).CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	expectEquals(
+		t,
+		[]ProtectingCopyChange{
+			{Path: "Name", Old: "name", New: "name2"},
+		},
+		report.Changed,
+	)
+}
+
+func TestProtectingCopyTransformRegistered(t *testing.T) {
+	type testStruct struct {
+		Code string `normalize:"strip=-"`
+	}
+
+	transforms := NewProtectingCopyTransforms().Register(
+		"strip",
+		func(v reflect.Value, arg string) error {
+			v.SetString(strings.Replace(v.String(), arg, "", -1))
+			return nil
+		},
+	)
+	dst := testStruct{}
+	src := testStruct{Code: "12-34"}
+	expectEquals(
+		t,
+		nil,
+		(&ProtectingCopier{TransformTag: "normalize", Transforms: transforms}).Copy(&dst, &src),
+	)
+	expectEquals(t, "1234", dst.Code)
+}
+
+func TestProtectingCopyTransformRegisterAfterCopy(t *testing.T) {
+	type testStruct struct {
+		Code string `normalize:"strip=-"`
+	}
+
+	transforms := NewProtectingCopyTransforms()
+	c := &ProtectingCopier{TransformTag: "normalize", Transforms: transforms}
+	dst := testStruct{}
+	src := testStruct{Code: "12-34"}
+	if err := c.Copy(&dst, &src); err == nil {
+		t.Errorf("Expect error for unknown transform")
+	}
+
+	// 後から登録した変換も使われる
+	transforms.Register(
+		"strip",
+		func(v reflect.Value, arg string) error {
+			v.SetString(strings.Replace(v.String(), arg, "", -1))
+			return nil
+		},
+	)
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(t, "1234", dst.Code)
+}
+
+func TestProtectingCopyTransformBind(t *testing.T) {
+	type testStruct struct {
+		Name  string `json:"name" protecttransform:"trim"`
+		Email string `json:"email" protecttransform:"lower"`
+	}
+
+	dst := testStruct{Name: "name", Email: "user@example.com"}
+	req, binder := jsonRequest(`{"name": " newname "}`)
+	expectEquals(
+		t,
+		nil,
+		(&ProtectingCopier{}).BindRequest(req, binder, &dst),
+	)
+	expectEquals(t, testStruct{Name: "newname", Email: "user@example.com"}, dst)
+}
+
+func TestProtectingCopyTransformSharedPointerInDst(t *testing.T) {
+	type testStruct struct {
+		Field1 *cycleTestNode
+		Tags   []string `protecttransform:"trim"`
+		Field2 *cycleTestNode
+	}
+
+	// 変換するフィールドを挟んでも dst 側の共有は解消される
+	shared := &cycleTestNode{Secret: "dst"}
+	dst := testStruct{
+		Field1: shared,
+		Field2: shared,
+	}
+	src := testStruct{
+		Field1: &cycleTestNode{Value: 1},
+		Tags:   []string{" x "},
+		Field2: &cycleTestNode{Value: 2},
+	}
+
+	expectEquals(
+		t,
+		nil,
+		ProtectingCopy(&dst, &src, "update"),
+	)
+	expectSame(t, shared, dst.Field1)
+	expectNotSame(t, dst.Field1, dst.Field2)
+	expectEquals(t, 1, dst.Field1.Value)
+	expectEquals(t, 2, dst.Field2.Value)
+	expectEquals(t, []string{"x"}, dst.Tags)
+}
+
+func TestProtectingCopyTransformError(t *testing.T) {
+	type testItem struct {
+		Count int `protecttransform:"trim"`
+	}
+	type testStruct struct {
+		Items []testItem
+	}
+	type unknownTransform struct {
+		Name string `protecttransform:"unknown"`
+	}
+	type invalidArg struct {
+		Time time.Time `protecttransform:"truncate=second"`
+	}
+
+	err := ProtectingCopy(&testStruct{}, &testStruct{Items: []testItem{{}, {Count: 1}}}, "")
+	transformErr, ok := err.(*ErrCopyTransform)
+	if !ok {
+		t.Fatalf("Expected ErrCopyTransform, but %v", err)
+	}
+	expectEquals(t, "Items[0].Count", transformErr.Path)
+	expectEquals(t, "trim", transformErr.Transform)
+
+	if _, ok := ProtectingCopy(&unknownTransform{}, &unknownTransform{}, "").(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expected ErrCopyValueInvalid")
+	}
+	err = ProtectingCopy(&invalidArg{}, &invalidArg{}, "")
+	if transformErr, ok := err.(*ErrCopyTransform); !ok || transformErr.Path != "Time" {
+		t.Errorf("Expected ErrCopyTransform for Time, but %v", err)
+	}
+}
+
+func TestProtectingCopyErrorPath(t *testing.T) {
+	type testItem struct {
+		Ch chan int
+	}
+	type testStruct struct {
+		Items []testItem
+	}
+
+	dst := testStruct{}
+	src := testStruct{Items: []testItem{{}, {Ch: make(chan int)}}}
+	err := (&ProtectingCopier{Uncopyable: ProtectingCopyUncopyableError}).Copy(&dst, &src)
+	if _, ok := err.(*ErrCopyValueInvalid); !ok {
+		t.Fatalf("Expected ErrCopyValueInvalid, but %v", err)
+	}
+	detail, ok := ProtectingCopyErrorOf(err)
+	if !ok {
+		t.Fatalf("Expected ProtectingCopyError, but %v", err)
+	}
+	expectEquals(t, ProtectingCopyReasonUncopyable, detail.Reason)
+	expectEquals(t, "Items[1].Ch", detail.Path)
+	expectEquals(t, reflect.TypeOf(make(chan int)), detail.DstType)
+	expectEquals(t, reflect.TypeOf(make(chan int)), detail.SrcType)
+	expectSame(t, err, detail.Err)
+	expectEquals(t, "Items[1].Ch: cannot copy chan int", err.Error())
+	expectEquals(t, err.Error(), detail.Error())
+}
+
+func TestProtectingCopyErrorRoot(t *testing.T) {
+	dst := "dst"
+	src := 1
+	detail, ok := ProtectingCopyErrorOf(ProtectingCopy(&dst, &src, ""))
+	if !ok {
+		t.Fatalf("Expected ProtectingCopyError")
+	}
+	expectEquals(t, ProtectingCopyReasonTypeMismatch, detail.Reason)
+	expectEquals(t, "", detail.Path)
+	expectEquals(t, reflect.TypeOf(&dst), detail.DstType)
+	expectEquals(t, reflect.TypeOf(&src), detail.SrcType)
+
+	detail, ok = ProtectingCopyErrorOf(ProtectingCopy(nil, &src, ""))
+	if !ok {
+		t.Fatalf("Expected ProtectingCopyError")
+	}
+	expectEquals(t, ProtectingCopyReasonInvalidValue, detail.Reason)
+	expectEquals(t, nil, detail.DstType)
+	expectEquals(t, reflect.TypeOf(&src), detail.SrcType)
+}
+
+func TestProtectingCopyErrorInterface(t *testing.T) {
+	type testItem struct {
+		Ch chan int
+	}
+	type testStruct struct {
+		Any interface{}
+	}
+
+	// interface 内で新しく作られる値のエラーもパスを持つ
+	dst := testStruct{}
+	src := testStruct{Any: map[string]*testItem{"key": {Ch: make(chan int)}}}
+	err := (&ProtectingCopier{Uncopyable: ProtectingCopyUncopyableError}).Copy(&dst, &src)
+	detail, ok := ProtectingCopyErrorOf(err)
+	if !ok {
+		t.Fatalf("Expected ProtectingCopyError, but %v", err)
+	}
+	expectEquals(t, `Any["key"].Ch`, detail.Path)
+}
+
+func TestProtectingCopyErrorWrapped(t *testing.T) {
+	type cents int
+	type testStruct struct {
+		Price cents
+	}
+
+	expectErr := errors.New("Some error")
+	types := NewProtectingCopyTypes().RegisterFunc(
+		reflect.TypeOf(cents(0)),
+		func(dst, src reflect.Value) error {
+			return expectErr
+		},
+	)
+	err := (&ProtectingCopier{Types: types}).Copy(&testStruct{}, &testStruct{Price: 100})
+	detail, ok := err.(*ProtectingCopyError)
+	if !ok {
+		t.Fatalf("Expected ProtectingCopyError, but %v", err)
+	}
+	expectEquals(t, ProtectingCopyReasonFailed, detail.Reason)
+	expectEquals(t, "Price", detail.Path)
+	expectEquals(t, reflect.TypeOf(cents(0)), detail.SrcType)
+	expectSame(t, expectErr, detail.Err)
+	expectEquals(t, "Price: Some error", err.Error())
+}
+
+func TestProtectingCopyErrorCachedPlan(t *testing.T) {
+	type testItem struct {
+		Field1 map[string]int `protectmap:"unknown"`
+	}
+
+	// プランにキャッシュされたエラーも呼び出しごとのパスを持つ
+	dst := []testItem{{}, {}}
+	err1 := ProtectingCopy(&dst, &[]testItem{{}, {}}, "")
+	err2 := ProtectingCopy(&dst[1], &testItem{}, "")
+	detail1, _ := ProtectingCopyErrorOf(err1)
+	detail2, _ := ProtectingCopyErrorOf(err2)
+	expectEquals(t, "[0].Field1", detail1.Path)
+	expectEquals(t, ProtectingCopyReasonInvalidTag, detail1.Reason)
+	expectEquals(t, "Field1", detail2.Path)
+}
+
+type benchmarkItem struct {
+	ID       int64 `protectfor:"update"`
+	Name     string
+	Price    int
+	Tags     []string
+	Attrs    map[string]string
+	Internal string `protectfor:"update,create"`
+}
+
+type benchmarkPayload struct {
+	ID        int64 `protectfor:"update"`
+	Owner     string
+	Items     []benchmarkItem
+	Meta      map[string]interface{}
+	Child     *benchmarkPayload
+	CreatedAt time.Time `protectfor:"update"`
+}
+
+func newBenchmarkPayload(depth int) *benchmarkPayload {
+	payload := &benchmarkPayload{
+		ID:        1,
+		Owner:     "owner",
+		Meta:      map[string]interface{}{"key1": "value1", "key2": 2},
+		CreatedAt: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for i := 0; i < 50; i++ {
+		payload.Items = append(payload.Items, benchmarkItem{
+			ID:       int64(i),
+			Name:     fmt.Sprintf("item%d", i),
+			Price:    i * 100,
+			Tags:     []string{"tag1", "tag2"},
+			Attrs:    map[string]string{"color": "red"},
+			Internal: "internal",
+		})
+	}
+	if depth > 0 {
+		payload.Child = newBenchmarkPayload(depth - 1)
+	}
+	return payload
+}
+
+func BenchmarkProtectingCopy(b *testing.B) {
+	src := newBenchmarkPayload(3)
+	dst := newBenchmarkPayload(3)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ProtectingCopy(dst, src, "update"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkProtectingCopyStructPlanCached and BenchmarkProtectingCopyStructPlanBuild
+// compare the cost per struct value with and without cached plans.
+func BenchmarkProtectingCopyStructPlanCached(b *testing.B) {
+	c := &ProtectingCopier{ProtectFor: "update"}
+	s := &protectingCopyState{planKey: c.planKey()}
+	sType := reflect.TypeOf(benchmarkItem{})
+	c.structPlan(s, sType)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.structPlan(s, sType)
+	}
+}
+
+func BenchmarkProtectingCopyStructPlanBuild(b *testing.B) {
+	key := protectingCopyPlanKey{
+		sType:       reflect.TypeOf(benchmarkItem{}),
+		structTag:   ProtectingCopyDefaultStructTag,
+		writableTag: ProtectingCopyDefaultWritableTag,
+		purposes:    "update",
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buildStructPlan(key)
+	}
+}
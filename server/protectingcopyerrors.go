@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ProtectingCopyErrorReason is the machine-readable reason of ProtectingCopyError.
+type ProtectingCopyErrorReason string
+
+const (
+	// ProtectingCopyReasonInvalidValue is for invalid values like nil (ErrCopyValueInvalid).
+	ProtectingCopyReasonInvalidValue ProtectingCopyErrorReason = "invalid_value"
+	// ProtectingCopyReasonTypeMismatch is for types of values differ (ErrCopyTypeMismatch).
+	ProtectingCopyReasonTypeMismatch ProtectingCopyErrorReason = "type_mismatch"
+	// ProtectingCopyReasonInvalidTag is for invalid tags like MapTag and KeyTag (ErrCopyValueInvalid).
+	ProtectingCopyReasonInvalidTag ProtectingCopyErrorReason = "invalid_tag"
+	// ProtectingCopyReasonUnexported is for unexported fields
+	// which cannot be copied (ErrCopyValueInvalid).
+	ProtectingCopyReasonUnexported ProtectingCopyErrorReason = "unexported"
+	// ProtectingCopyReasonUncopyable is for chans, funcs and unsafe.Pointer
+	// with ProtectingCopyUncopyableError (ErrCopyValueInvalid).
+	ProtectingCopyReasonUncopyable ProtectingCopyErrorReason = "uncopyable"
+	// ProtectingCopyReasonProtected is for protected fields in the strict mode (ErrCopyProtected).
+	ProtectingCopyReasonProtected ProtectingCopyErrorReason = "protected"
+	// ProtectingCopyReasonTransform is for failures of transforms (ErrCopyTransform).
+	ProtectingCopyReasonTransform ProtectingCopyErrorReason = "transform"
+	// ProtectingCopyReasonFailed is for errors from outside of ProtectingCopier
+	// like functions registered in ProtectingCopyTypes and datastore.PropertyLoadSaver.
+	ProtectingCopyReasonFailed ProtectingCopyErrorReason = "failed"
+)
+
+// ProtectingCopyError describes where and why ProtectingCopier failed.
+// Errors of ProtectingCopier (e.g. ErrCopyValueInvalid) provide it with errors.As,
+// or ProtectingCopyErrorOf before Go 1.13.
+// Errors from outside of ProtectingCopier are returned wrapped with it,
+// except ones from binders of Bind.
+type ProtectingCopyError struct {
+	Reason ProtectingCopyErrorReason
+	// Path is the path where the copy failed like `Items[2].Name`,
+	// or "" for the root.
+	Path string
+	// DstType and SrcType are types of the destination and the source at Path.
+	// nil if not available (e.g. nil for dst or src).
+	DstType reflect.Type
+	SrcType reflect.Type
+	// Err is the error like *ErrCopyValueInvalid
+	// or one from outside of ProtectingCopier.
+	Err error
+	// located is true if Path and types are set.
+	located bool
+}
+
+func (e *ProtectingCopyError) Error() string {
+	if detailer, ok := e.Err.(protectingCopyErrorDetailer); ok && detailer.copyErrorDetail() == e {
+		// errors of ProtectingCopier describe the path by themselves.
+		return e.Err.Error()
+	}
+	return e.describe(e.Err.Error())
+}
+
+// Unwrap returns Err.
+func (e *ProtectingCopyError) Unwrap() error {
+	return e.Err
+}
+
+// copyErrorDetail implements protectingCopyErrorDetailer.
+func (e *ProtectingCopyError) copyErrorDetail() *ProtectingCopyError {
+	return e
+}
+
+// init sets err and reason if not yet,
+// for errors created without constructors.
+func (e *ProtectingCopyError) init(err error, reason ProtectingCopyErrorReason) *ProtectingCopyError {
+	if e.Err == nil {
+		e.Err = err
+	}
+	if e.Reason == "" {
+		e.Reason = reason
+	}
+	return e
+}
+
+// describe prepends the path to msg.
+func (e *ProtectingCopyError) describe(msg string) string {
+	if e.Path == "" {
+		return msg
+	}
+	return fmt.Sprintf("%v: %v", e.Path, msg)
+}
+
+// protectingCopyErrorDetailer is implemented by errors of ProtectingCopier.
+type protectingCopyErrorDetailer interface {
+	error
+	copyErrorDetail() *ProtectingCopyError
+}
+
+// asProtectingCopyError implements As of errors of ProtectingCopier for errors.As.
+func asProtectingCopyError(err protectingCopyErrorDetailer, target interface{}) bool {
+	p, ok := target.(**ProtectingCopyError)
+	if ok {
+		*p = err.copyErrorDetail()
+	}
+	return ok
+}
+
+// ProtectingCopyErrorOf returns ProtectingCopyError of err returned from ProtectingCopier.
+// This is for Go before 1.13, and is the same as errors.As for later versions.
+func ProtectingCopyErrorOf(err error) (*ProtectingCopyError, bool) {
+	detailer, ok := err.(protectingCopyErrorDetailer)
+	if !ok {
+		return nil, false
+	}
+	return detailer.copyErrorDetail(), true
+}
+
+// locateError sets the current path and types of dst and src to err
+// if not set yet, and returns it.
+// Errors from outside of ProtectingCopier are wrapped with ProtectingCopyError.
+// Errors are located where they happen,
+// as paths are not popped when returning errors.
+func (s *protectingCopyState) locateError(err error, dst, src reflect.Value) error {
+	detailer, ok := err.(protectingCopyErrorDetailer)
+	if !ok {
+		detailer = &ProtectingCopyError{
+			Reason: ProtectingCopyReasonFailed,
+			Err:    err,
+		}
+	}
+	detail := detailer.copyErrorDetail()
+	if detail.located {
+		return detailer
+	}
+	detail.located = true
+	detail.Path = s.pathString()
+	if dst.IsValid() {
+		detail.DstType = dst.Type()
+	}
+	if src.IsValid() {
+		detail.SrcType = src.Type()
+	}
+	return detailer
+}
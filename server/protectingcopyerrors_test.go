@@ -0,0 +1,78 @@
+//go:build go1.13
+// +build go1.13
+
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestProtectingCopyErrorAs(t *testing.T) {
+	type testStruct struct {
+		Name string `protecttransform:"unknown"`
+	}
+	type transformStruct struct {
+		Email int `protecttransform:"lower"`
+	}
+
+	for _, c := range []struct {
+		name   string
+		err    error
+		reason ProtectingCopyErrorReason
+		path   string
+	}{
+		{
+			name:   "invalid",
+			err:    ProtectingCopy(&testStruct{}, &testStruct{}, ""),
+			reason: ProtectingCopyReasonInvalidTag,
+			path:   "Name",
+		},
+		{
+			name:   "protected",
+			err:    (&ProtectingCopier{ProtectFor: "update", Strict: true}).Copy(&[]exampleUser{{}}, &[]exampleUser{{Password: "password"}}),
+			reason: ProtectingCopyReasonProtected,
+			path:   "",
+		},
+		{
+			name:   "transform",
+			err:    ProtectingCopy(&transformStruct{}, &transformStruct{}, ""),
+			reason: ProtectingCopyReasonTransform,
+			path:   "Email",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var detail *ProtectingCopyError
+			if !errors.As(c.err, &detail) {
+				t.Fatalf("Expected ProtectingCopyError, but %v", c.err)
+			}
+			expectEquals(t, c.reason, detail.Reason)
+			expectEquals(t, c.path, detail.Path)
+			expectSame(t, c.err, detail.Err)
+		})
+	}
+}
+
+func TestProtectingCopyErrorAsWrapped(t *testing.T) {
+	type testStruct struct {
+		Time int
+	}
+
+	expectErr := errors.New("Some error")
+	types := NewProtectingCopyTypes().RegisterFunc(
+		reflect.TypeOf(0),
+		func(dst, src reflect.Value) error {
+			return expectErr
+		},
+	)
+	err := (&ProtectingCopier{Types: types}).Copy(&testStruct{}, &testStruct{})
+	var detail *ProtectingCopyError
+	if !errors.As(err, &detail) {
+		t.Fatalf("Expected ProtectingCopyError, but %v", err)
+	}
+	expectEquals(t, "Time", detail.Path)
+	if !errors.Is(err, expectErr) {
+		t.Errorf("Expected to wrap %v, but %v", expectErr, err)
+	}
+}
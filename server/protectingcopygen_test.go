@@ -0,0 +1,371 @@
+package server
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+//go:generate go run ../tool/protectcopygen/main.go -type genTestRoot -output protectingcopygenerated_test.go protectingcopygen_test.go
+
+type genTestNamedInt int
+
+type genTestLeaf struct {
+	Name   string
+	Secret string `protectfor:"update"`
+	Count  int    `protectfor:"create,update"`
+	Admin  string `protectfor:"!admin"`
+	Remark string `protectfor:"update,!create"`
+}
+
+// ProtectField makes Name unchangeable from "a"
+// to test ProtectingCopyFieldProtector.
+func (l *genTestLeaf) ProtectField(field string, dst, src interface{}) bool {
+	return field == "Name" && dst == "a"
+}
+
+type genTestWritable struct {
+	Name  string      `writablefor:"create,update"`
+	Code  string      `writablefor:"create"`
+	Note  string      `writablefor:"update" protectfor:"update"`
+	Leaf  genTestLeaf `writablefor:"update"`
+	Other genTestLeaf
+}
+
+type genTestRoot struct {
+	ID        int64 `protectfor:"create"`
+	Name      string
+	Named     genTestNamedInt `protectfor:"update"`
+	Time      time.Time
+	Leaf      genTestLeaf
+	LeafPtr   *genTestLeaf
+	IntPtr    *int
+	Leaves    []genTestLeaf
+	LeafPtrs  []*genTestLeaf
+	LeafArray [2]genTestLeaf
+	Bytes     []byte `protectfor:"create"`
+	LeafMap   map[string]genTestLeaf
+	PtrMap    map[string]*genTestLeaf
+	SliceMap  map[string][]genTestLeaf
+	MapMap    map[string]map[int]*genTestLeaf
+	TimeMap   map[string]time.Time
+	Any       interface{} `protectfor:"create"`
+	AnyMap    map[string]interface{}
+	Anonymous struct {
+		Value  string
+		Hidden string `protectfor:"update"`
+	}
+	Key        *datastore.Key
+	KeyMap     map[string]*datastore.Key
+	Location   appengine.GeoPoint
+	Writable   genTestWritable
+	Writables  map[string]*genTestWritable
+	Self       *genTestRoot
+	unexported string
+}
+
+// genTestFiller fills values with random values.
+type genTestFiller struct {
+	r *rand.Rand
+	// shared are pointers, maps and slices filled so far for each type
+	// to refer from multiple places, or nil not to share.
+	shared map[reflect.Type][]reflect.Value
+}
+
+// newGenTestInterfaceValue returns a random value to set to interfaces.
+// Values in interfaces are never shared
+// as generated methods copy them with ProtectingCopier apart from the others.
+func (f *genTestFiller) newGenTestInterfaceValue(depth int) interface{} {
+	f = &genTestFiller{r: f.r}
+	switch f.r.Intn(7) {
+	case 0:
+		return nil
+	case 1:
+		return f.r.Intn(3)
+	case 2:
+		return genTestString(f.r)
+	case 3:
+		var v genTestLeaf
+		f.fill(reflect.ValueOf(&v).Elem(), depth)
+		return v
+	case 4:
+		var v *genTestLeaf
+		f.fill(reflect.ValueOf(&v).Elem(), depth)
+		return v
+	case 5:
+		var v []genTestLeaf
+		f.fill(reflect.ValueOf(&v).Elem(), depth)
+		return v
+	}
+	var v map[string]*genTestLeaf
+	f.fill(reflect.ValueOf(&v).Elem(), depth)
+	return v
+}
+
+// genTestKeys are keys shared among values.
+var genTestKeys = []*datastore.Key{{}, {}, {}}
+
+// genTestString returns one of a few strings
+// so that keys of maps often collide between dst and src.
+func genTestString(r *rand.Rand) string {
+	return []string{"a", "b", "c"}[r.Intn(3)]
+}
+
+// share sets a value filled before to v and returns true occasionally.
+func (f *genTestFiller) share(v reflect.Value) bool {
+	candidates := f.shared[v.Type()]
+	if len(candidates) == 0 || f.r.Intn(3) != 0 {
+		return false
+	}
+	v.Set(candidates[f.r.Intn(len(candidates))])
+	return true
+}
+
+// record records v filled to share.
+func (f *genTestFiller) record(v reflect.Value) {
+	if f.shared == nil || v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.Interface {
+		// maps of interfaces are copied with ProtectingCopier as a whole.
+		return
+	}
+	f.shared[v.Type()] = append(f.shared[v.Type()], v)
+}
+
+// fill fills v with random values.
+// Values in maps are not shared:
+// which entry is copied first affects the result when they are shared.
+func (f *genTestFiller) fill(v reflect.Value, depth int) {
+	f.fillValue(v, depth, false)
+}
+
+func (f *genTestFiller) fillValue(v reflect.Value, depth int, inMap bool) {
+	r := f.r
+	if !v.CanSet() {
+		// unexported field
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(r.Intn(2) == 0)
+	case reflect.Int, reflect.Int64:
+		v.SetInt(int64(r.Intn(3)))
+	case reflect.Uint8:
+		v.SetUint(uint64(r.Intn(256)))
+	case reflect.String:
+		v.SetString(genTestString(r))
+	case reflect.Float64:
+		v.SetFloat(float64(r.Intn(3)))
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Unix(int64(r.Intn(3)), 0).UTC()))
+			return
+		}
+		for idx := 0; idx < v.NumField(); idx++ {
+			f.fillValue(v.Field(idx), depth, inMap)
+		}
+	case reflect.Ptr:
+		if !inMap && f.share(v) {
+			return
+		}
+		if depth > 2 || r.Intn(4) == 0 {
+			return
+		}
+		if v.Type() == reflect.TypeOf(&datastore.Key{}) {
+			// 同じ値になるよう、共有のキーから選ぶ
+			v.Set(reflect.ValueOf(genTestKeys[r.Intn(len(genTestKeys))]))
+			return
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		f.record(v)
+		f.fillValue(v.Elem(), depth+1, inMap)
+	case reflect.Slice:
+		if !inMap && f.share(v) {
+			return
+		}
+		if depth > 2 || r.Intn(4) == 0 {
+			return
+		}
+		v.Set(reflect.MakeSlice(v.Type(), r.Intn(3), 3))
+		f.record(v)
+		for idx := 0; idx < v.Len(); idx++ {
+			f.fillValue(v.Index(idx), depth+1, inMap)
+		}
+	case reflect.Array:
+		for idx := 0; idx < v.Len(); idx++ {
+			f.fillValue(v.Index(idx), depth+1, inMap)
+		}
+	case reflect.Map:
+		if !inMap && f.share(v) {
+			return
+		}
+		if depth > 2 || r.Intn(4) == 0 {
+			return
+		}
+		v.Set(reflect.MakeMap(v.Type()))
+		f.record(v)
+		for i := r.Intn(4); i > 0; i-- {
+			key := reflect.New(v.Type().Key()).Elem()
+			f.fillValue(key, depth+1, true)
+			value := reflect.New(v.Type().Elem()).Elem()
+			f.fillValue(value, depth+1, true)
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Interface:
+		if depth > 2 {
+			return
+		}
+		if value := f.newGenTestInterfaceValue(depth + 1); value != nil {
+			v.Set(reflect.ValueOf(value))
+		}
+	default:
+		panic("unexpected kind: " + v.Kind().String())
+	}
+}
+
+// newGenTestRoot creates a random genTestRoot.
+// The same seed creates the same value.
+// Pointers, maps and slices are shared among fields
+// and Self may refer to the root itself to make cycles.
+func newGenTestRoot(seed int64) *genTestRoot {
+	v := &genTestRoot{}
+	f := &genTestFiller{
+		r:      rand.New(rand.NewSource(seed)),
+		shared: map[reflect.Type][]reflect.Value{},
+	}
+	f.record(reflect.ValueOf(v))
+	f.fill(reflect.ValueOf(v).Elem(), 0)
+	v.unexported = "unexported"
+	return v
+}
+
+// genTestSharing tests whether references are shared in the same way
+// in two values by walking them in parallel.
+type genTestSharing struct {
+	// expected maps references in the expected value to ones in the actual value.
+	expected map[protectingCopyRef]protectingCopyRef
+	// actual maps references in the actual value to ones in the expected value.
+	actual map[protectingCopyRef]protectingCopyRef
+}
+
+func newGenTestSharing() *genTestSharing {
+	return &genTestSharing{
+		expected: map[protectingCopyRef]protectingCopyRef{},
+		actual:   map[protectingCopyRef]protectingCopyRef{},
+	}
+}
+
+// same returns false if references in expected and actual
+// do not correspond one-to-one.
+func (s *genTestSharing) same(expected, actual reflect.Value) bool {
+	expectedRef, expectedOK := refOf(expected)
+	actualRef, actualOK := refOf(actual)
+	if expectedOK != actualOK {
+		return false
+	}
+	if expectedOK {
+		ref, walked := s.expected[expectedRef]
+		if walked || s.actual[actualRef] != (protectingCopyRef{}) {
+			return walked && ref == actualRef && s.actual[actualRef] == expectedRef
+		}
+		s.expected[expectedRef] = actualRef
+		s.actual[actualRef] = expectedRef
+	}
+	switch expected.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if expected.IsNil() || actual.IsNil() {
+			return expected.IsNil() == actual.IsNil()
+		}
+		return s.same(expected.Elem(), actual.Elem())
+	case reflect.Struct:
+		for idx := 0; idx < expected.NumField(); idx++ {
+			if !s.same(expected.Field(idx), actual.Field(idx)) {
+				return false
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if expected.Len() != actual.Len() {
+			return false
+		}
+		for idx := 0; idx < expected.Len(); idx++ {
+			if !s.same(expected.Index(idx), actual.Index(idx)) {
+				return false
+			}
+		}
+	case reflect.Map:
+		if expected.Len() != actual.Len() {
+			return false
+		}
+		for _, key := range expected.MapKeys() {
+			value := actual.MapIndex(key)
+			if !value.IsValid() || !s.same(expected.MapIndex(key), value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestProtectCopyGenMatchesProtectingCopier(t *testing.T) {
+	for _, tc := range []struct {
+		protectFor string
+		generated  func(dst, src *genTestRoot) error
+	}{
+		{"create", (*genTestRoot).CopyProtectingForCreate},
+		{"update", (*genTestRoot).CopyProtectingForUpdate},
+		{"admin", (*genTestRoot).CopyProtectingForAdmin},
+	} {
+		c := &ProtectingCopier{ProtectFor: tc.protectFor}
+		for seed := int64(0); seed < 500; seed++ {
+			// dst と src の各々について、同一の値を2つずつ作る
+			expected := newGenTestRoot(seed * 2)
+			actual := newGenTestRoot(seed * 2)
+			if err := c.Copy(expected, newGenTestRoot(seed*2+1)); err != nil {
+				t.Fatalf("%v: seed=%v: Unexpected error: %v", tc.protectFor, seed, err)
+			}
+			if err := tc.generated(actual, newGenTestRoot(seed*2+1)); err != nil {
+				t.Fatalf("%v: seed=%v: Unexpected error: %v", tc.protectFor, seed, err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("%v: seed=%v: Expected %+v, but %+v", tc.protectFor, seed, expected, actual)
+			}
+			// 共有や循環も同じく再現される
+			if !newGenTestSharing().same(reflect.ValueOf(expected), reflect.ValueOf(actual)) {
+				t.Errorf("%v: seed=%v: Expected references shared as %+v, but %+v", tc.protectFor, seed, expected, actual)
+			}
+		}
+	}
+}
+
+func TestProtectCopyGenNil(t *testing.T) {
+	var dst *genTestRoot
+	if _, ok := dst.CopyProtectingForUpdate(&genTestRoot{}).(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expected ErrCopyValueInvalid")
+	}
+	dst = &genTestRoot{}
+	if _, ok := dst.CopyProtectingForUpdate(nil).(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expected ErrCopyValueInvalid")
+	}
+}
+
+func TestProtectCopyGenShared(t *testing.T) {
+	leaf := &genTestLeaf{Name: "b"}
+	src := &genTestRoot{
+		LeafPtr: leaf,
+		PtrMap:  map[string]*genTestLeaf{"a": leaf},
+	}
+	src.Self = src
+
+	dst := &genTestRoot{}
+	expectEquals(t, nil, dst.CopyProtectingForUpdate(src))
+	// 循環は dst 自身を参照する
+	if dst.Self != dst {
+		t.Errorf("Expected dst.Self refers dst, but %p", dst.Self)
+	}
+	// 共有されたポインタは1つのコピーを共有する
+	if dst.LeafPtr == leaf || dst.PtrMap["a"] != dst.LeafPtr {
+		t.Errorf("Expected a shared copy, but %p and %p", dst.LeafPtr, dst.PtrMap["a"])
+	}
+}
@@ -0,0 +1,1931 @@
+// Code generated by protectcopygen. DO NOT EDIT.
+
+package server
+
+import (
+	"google.golang.org/appengine/datastore"
+	"reflect"
+	"time"
+)
+
+// genTestRootCopyRef is the reference of a pointer, map or slice.
+type genTestRootCopyRef struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+// genTestRootCopyRefOf returns the reference of v.
+// Returns false if v is not a reference or nil or an empty slice.
+func genTestRootCopyRefOf(v interface{}) (genTestRootCopyRef, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map:
+		if rv.IsNil() {
+			return genTestRootCopyRef{}, false
+		}
+		return genTestRootCopyRef{typ: rv.Type(), ptr: rv.Pointer()}, true
+	case reflect.Slice:
+		if rv.IsNil() || rv.Len() == 0 {
+			// empty slices may share the address
+			return genTestRootCopyRef{}, false
+		}
+		return genTestRootCopyRef{typ: rv.Type(), ptr: rv.Pointer(), len: rv.Len()}, true
+	}
+	return genTestRootCopyRef{}, false
+}
+
+// genTestRootCopyState tracks references copied by the generated functions
+// to share them in the destination as ProtectingCopier does.
+type genTestRootCopyState struct {
+	// visited maps references in the source to their copies.
+	visited map[genTestRootCopyRef]interface{}
+	// claimed are references in the destination which are copies.
+	claimed map[genTestRootCopyRef]bool
+}
+
+// visit records dst is the copy of src.
+func (s *genTestRootCopyState) visit(dst, src interface{}) {
+	srcRef, ok := genTestRootCopyRefOf(src)
+	if !ok {
+		return
+	}
+	dstRef, ok := genTestRootCopyRefOf(dst)
+	if !ok {
+		return
+	}
+	if s.visited == nil {
+		s.visited = map[genTestRootCopyRef]interface{}{}
+		s.claimed = map[genTestRootCopyRef]bool{}
+	}
+	s.visited[srcRef] = dst
+	s.claimed[dstRef] = true
+}
+
+// lookup returns the copy of src if already copied.
+func (s *genTestRootCopyState) lookup(src interface{}) (interface{}, bool) {
+	ref, ok := genTestRootCopyRefOf(src)
+	if !ok {
+		return nil, false
+	}
+	dst, ok := s.visited[ref]
+	return dst, ok
+}
+
+// canCopyInto tests whether src can be copied into dst in place,
+// that is, src is not copied yet and dst is not a copy of another value.
+func (s *genTestRootCopyState) canCopyInto(dst, src interface{}) bool {
+	if _, ok := s.lookup(src); ok {
+		return false
+	}
+	ref, ok := genTestRootCopyRefOf(dst)
+	return !ok || !s.claimed[ref]
+}
+
+// genTestRootCopierForAdmin copies values in interfaces, which cannot be resolved at generation time.
+var genTestRootCopierForAdmin = &ProtectingCopier{StructTag: "protectfor", WritableTag: "writablefor", ProtectFor: "admin"}
+
+// CopyProtectingForAdmin copies src to dst protecting fields for "admin".
+// This copies the same as ProtectingCopy(dst, src, "admin").
+func (dst *genTestRoot) CopyProtectingForAdmin(src *genTestRoot) error {
+	if dst == nil || src == nil {
+		return NewErrCopyValueInvalid("Cannot copy as dst or src is nil")
+	}
+	s := &genTestRootCopyState{}
+	s.visit(dst, src)
+	return genTestRootCopyForAdmin1(s, dst, src)
+}
+
+// genTestRootCopyForAdmin1 copies genTestRoot.
+func genTestRootCopyForAdmin1(s *genTestRootCopyState, dst, src *genTestRoot) error {
+	dst.ID = src.ID
+	dst.Name = src.Name
+	dst.Named = src.Named
+	dst.Time = src.Time
+	if err := genTestRootCopyForAdmin2(s, &dst.Leaf, &src.Leaf); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin3(s, &dst.LeafPtr, &src.LeafPtr); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin4(s, &dst.IntPtr, &src.IntPtr); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin5(s, &dst.Leaves, &src.Leaves); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin6(s, &dst.LeafPtrs, &src.LeafPtrs); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin7(s, &dst.LeafArray, &src.LeafArray); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin8(s, &dst.Bytes, &src.Bytes); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin9(s, &dst.LeafMap, &src.LeafMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin10(s, &dst.PtrMap, &src.PtrMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin11(s, &dst.SliceMap, &src.SliceMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin12(s, &dst.MapMap, &src.MapMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin13(s, &dst.TimeMap, &src.TimeMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin14(s, &dst.Any, &src.Any); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin15(s, &dst.AnyMap, &src.AnyMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin16(s, &dst.Anonymous, &src.Anonymous); err != nil {
+		return err
+	}
+	dst.Key = src.Key
+	if err := genTestRootCopyForAdmin17(s, &dst.KeyMap, &src.KeyMap); err != nil {
+		return err
+	}
+	dst.Location = src.Location
+	if err := genTestRootCopyForAdmin18(s, &dst.Writable, &src.Writable); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin19(s, &dst.Writables, &src.Writables); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForAdmin20(s, &dst.Self, &src.Self); err != nil {
+		return err
+	}
+	return nil
+}
+
+// genTestRootCopyForAdmin2 copies genTestLeaf.
+func genTestRootCopyForAdmin2(s *genTestRootCopyState, dst, src *genTestLeaf) error {
+	protected := [5]bool{
+		dst.ProtectField("Name", dst.Name, src.Name),
+		dst.ProtectField("Secret", dst.Secret, src.Secret),
+		dst.ProtectField("Count", dst.Count, src.Count),
+		dst.ProtectField("Admin", dst.Admin, src.Admin),
+		dst.ProtectField("Remark", dst.Remark, src.Remark),
+	}
+	if !protected[0] {
+		dst.Name = src.Name
+	}
+	if !protected[1] {
+		dst.Secret = src.Secret
+	}
+	if !protected[2] {
+		dst.Count = src.Count
+	}
+	if !protected[3] {
+		dst.Admin = src.Admin
+	}
+	if !protected[4] {
+		dst.Remark = src.Remark
+	}
+	return nil
+}
+
+// genTestRootCopyForAdmin3 copies *genTestLeaf.
+func genTestRootCopyForAdmin3(s *genTestRootCopyState, dst, src **genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = new(genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForAdmin2(s, &(*d), &(**src)); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin4 copies *int.
+func genTestRootCopyForAdmin4(s *genTestRootCopyState, dst, src **int) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(*int)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = new(int)
+	}
+	s.visit(d, *src)
+	(*d) = (**src)
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin5 copies []genTestLeaf.
+func genTestRootCopyForAdmin5(s *genTestRootCopyState, dst, src *[]genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.([]genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if len(d) != len(*src) || !s.canCopyInto(d, *src) {
+		d = make([]genTestLeaf, len(*src))
+	}
+	s.visit(d, *src)
+	for i := range *src {
+		if err := genTestRootCopyForAdmin2(s, &d[i], &(*src)[i]); err != nil {
+			return err
+		}
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin6 copies []*genTestLeaf.
+func genTestRootCopyForAdmin6(s *genTestRootCopyState, dst, src *[]*genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.([]*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if len(d) != len(*src) || !s.canCopyInto(d, *src) {
+		d = make([]*genTestLeaf, len(*src))
+	}
+	s.visit(d, *src)
+	for i := range *src {
+		if err := genTestRootCopyForAdmin3(s, &d[i], &(*src)[i]); err != nil {
+			return err
+		}
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin7 copies [2]genTestLeaf.
+func genTestRootCopyForAdmin7(s *genTestRootCopyState, dst, src *[2]genTestLeaf) error {
+	for i := range *src {
+		if err := genTestRootCopyForAdmin2(s, &(*dst)[i], &(*src)[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForAdmin8 copies []byte.
+func genTestRootCopyForAdmin8(s *genTestRootCopyState, dst, src *[]byte) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.([]byte)
+		return nil
+	}
+	d := *dst
+	if len(d) != len(*src) || !s.canCopyInto(d, *src) {
+		d = make([]byte, len(*src))
+	}
+	s.visit(d, *src)
+	for i := range *src {
+		d[i] = (*src)[i]
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin9 copies map[string]genTestLeaf.
+func genTestRootCopyForAdmin9(s *genTestRootCopyState, dst, src *map[string]genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForAdmin21(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin10 copies map[string]*genTestLeaf.
+func genTestRootCopyForAdmin10(s *genTestRootCopyState, dst, src *map[string]*genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]*genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForAdmin22(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin11 copies map[string][]genTestLeaf.
+func genTestRootCopyForAdmin11(s *genTestRootCopyState, dst, src *map[string][]genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string][]genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string][]genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForAdmin23(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin12 copies map[string]map[int]*genTestLeaf.
+func genTestRootCopyForAdmin12(s *genTestRootCopyState, dst, src *map[string]map[int]*genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]map[int]*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]map[int]*genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForAdmin24(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin13 copies map[string]time.Time.
+func genTestRootCopyForAdmin13(s *genTestRootCopyState, dst, src *map[string]time.Time) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]time.Time)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]time.Time)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForAdmin25(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin14 copies interface{}.
+func genTestRootCopyForAdmin14(s *genTestRootCopyState, dst, src *interface{}) error {
+	return genTestRootCopierForAdmin.Copy(dst, src)
+}
+
+// genTestRootCopyForAdmin15 copies map[string]interface{}.
+func genTestRootCopyForAdmin15(s *genTestRootCopyState, dst, src *map[string]interface{}) error {
+	return genTestRootCopierForAdmin.Copy(dst, src)
+}
+
+// genTestRootCopyForAdmin16 copies struct { Value string Hidden string `protectfor:"update"` }.
+func genTestRootCopyForAdmin16(s *genTestRootCopyState, dst, src *struct {
+	Value  string
+	Hidden string `protectfor:"update"`
+}) error {
+	dst.Value = src.Value
+	dst.Hidden = src.Hidden
+	return nil
+}
+
+// genTestRootCopyForAdmin17 copies map[string]*datastore.Key.
+func genTestRootCopyForAdmin17(s *genTestRootCopyState, dst, src *map[string]*datastore.Key) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]*datastore.Key)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]*datastore.Key)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForAdmin26(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin18 copies genTestWritable.
+func genTestRootCopyForAdmin18(s *genTestRootCopyState, dst, src *genTestWritable) error {
+	return nil
+}
+
+// genTestRootCopyForAdmin19 copies map[string]*genTestWritable.
+func genTestRootCopyForAdmin19(s *genTestRootCopyState, dst, src *map[string]*genTestWritable) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]*genTestWritable)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]*genTestWritable)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForAdmin27(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin20 copies *genTestRoot.
+func genTestRootCopyForAdmin20(s *genTestRootCopyState, dst, src **genTestRoot) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(*genTestRoot)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = new(genTestRoot)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForAdmin1(s, &(*d), &(**src)); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForAdmin21 copies entries of map[string]genTestLeaf.
+func genTestRootCopyForAdmin21(s *genTestRootCopyState, dst, src map[string]genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		var n genTestLeaf
+		if err := genTestRootCopyForAdmin2(s, &n, &sv); err != nil {
+			return err
+		}
+		dst[k] = n
+	}
+	return nil
+}
+
+// genTestRootCopyForAdmin22 copies entries of map[string]*genTestLeaf.
+func genTestRootCopyForAdmin22(s *genTestRootCopyState, dst, src map[string]*genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForAdmin2(s, &(*dv), &(*sv)); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = nil
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(*genTestLeaf)
+			} else {
+				n := new(genTestLeaf)
+				s.visit(n, sv)
+				if err := genTestRootCopyForAdmin2(s, &(*n), &(*sv)); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForAdmin23 copies entries of map[string][]genTestLeaf.
+func genTestRootCopyForAdmin23(s *genTestRootCopyState, dst, src map[string][]genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && len(dv) == len(sv) && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			for i := range sv {
+				if err := genTestRootCopyForAdmin2(s, &dv[i], &sv[i]); err != nil {
+					return err
+				}
+			}
+		} else {
+			if sv == nil {
+				dst[k] = sv
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.([]genTestLeaf)
+			} else {
+				n := make([]genTestLeaf, len(sv))
+				s.visit(n, sv)
+				for i := range sv {
+					if err := genTestRootCopyForAdmin2(s, &n[i], &sv[i]); err != nil {
+						return err
+					}
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForAdmin24 copies entries of map[string]map[int]*genTestLeaf.
+func genTestRootCopyForAdmin24(s *genTestRootCopyState, dst, src map[string]map[int]*genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForAdmin28(s, dv, sv); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = sv
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(map[int]*genTestLeaf)
+			} else {
+				n := make(map[int]*genTestLeaf)
+				s.visit(n, sv)
+				if err := genTestRootCopyForAdmin28(s, n, sv); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForAdmin25 copies entries of map[string]time.Time.
+func genTestRootCopyForAdmin25(s *genTestRootCopyState, dst, src map[string]time.Time) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		dst[k] = sv
+	}
+	return nil
+}
+
+// genTestRootCopyForAdmin26 copies entries of map[string]*datastore.Key.
+func genTestRootCopyForAdmin26(s *genTestRootCopyState, dst, src map[string]*datastore.Key) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		dst[k] = sv
+	}
+	return nil
+}
+
+// genTestRootCopyForAdmin27 copies entries of map[string]*genTestWritable.
+func genTestRootCopyForAdmin27(s *genTestRootCopyState, dst, src map[string]*genTestWritable) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForAdmin18(s, &(*dv), &(*sv)); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = nil
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(*genTestWritable)
+			} else {
+				n := new(genTestWritable)
+				s.visit(n, sv)
+				if err := genTestRootCopyForAdmin18(s, &(*n), &(*sv)); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForAdmin28 copies entries of map[int]*genTestLeaf.
+func genTestRootCopyForAdmin28(s *genTestRootCopyState, dst, src map[int]*genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForAdmin2(s, &(*dv), &(*sv)); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = nil
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(*genTestLeaf)
+			} else {
+				n := new(genTestLeaf)
+				s.visit(n, sv)
+				if err := genTestRootCopyForAdmin2(s, &(*n), &(*sv)); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopierForCreate copies values in interfaces, which cannot be resolved at generation time.
+var genTestRootCopierForCreate = &ProtectingCopier{StructTag: "protectfor", WritableTag: "writablefor", ProtectFor: "create"}
+
+// CopyProtectingForCreate copies src to dst protecting fields for "create".
+// This copies the same as ProtectingCopy(dst, src, "create").
+func (dst *genTestRoot) CopyProtectingForCreate(src *genTestRoot) error {
+	if dst == nil || src == nil {
+		return NewErrCopyValueInvalid("Cannot copy as dst or src is nil")
+	}
+	s := &genTestRootCopyState{}
+	s.visit(dst, src)
+	return genTestRootCopyForCreate1(s, dst, src)
+}
+
+// genTestRootCopyForCreate1 copies genTestRoot.
+func genTestRootCopyForCreate1(s *genTestRootCopyState, dst, src *genTestRoot) error {
+	dst.Name = src.Name
+	dst.Named = src.Named
+	dst.Time = src.Time
+	if err := genTestRootCopyForCreate2(s, &dst.Leaf, &src.Leaf); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate3(s, &dst.LeafPtr, &src.LeafPtr); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate4(s, &dst.IntPtr, &src.IntPtr); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate5(s, &dst.Leaves, &src.Leaves); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate6(s, &dst.LeafPtrs, &src.LeafPtrs); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate7(s, &dst.LeafArray, &src.LeafArray); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate8(s, &dst.LeafMap, &src.LeafMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate9(s, &dst.PtrMap, &src.PtrMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate10(s, &dst.SliceMap, &src.SliceMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate11(s, &dst.MapMap, &src.MapMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate12(s, &dst.TimeMap, &src.TimeMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate13(s, &dst.AnyMap, &src.AnyMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate14(s, &dst.Anonymous, &src.Anonymous); err != nil {
+		return err
+	}
+	dst.Key = src.Key
+	if err := genTestRootCopyForCreate15(s, &dst.KeyMap, &src.KeyMap); err != nil {
+		return err
+	}
+	dst.Location = src.Location
+	if err := genTestRootCopyForCreate16(s, &dst.Writable, &src.Writable); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate17(s, &dst.Writables, &src.Writables); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForCreate18(s, &dst.Self, &src.Self); err != nil {
+		return err
+	}
+	return nil
+}
+
+// genTestRootCopyForCreate2 copies genTestLeaf.
+func genTestRootCopyForCreate2(s *genTestRootCopyState, dst, src *genTestLeaf) error {
+	protected := [3]bool{
+		dst.ProtectField("Name", dst.Name, src.Name),
+		dst.ProtectField("Secret", dst.Secret, src.Secret),
+		dst.ProtectField("Remark", dst.Remark, src.Remark),
+	}
+	if !protected[0] {
+		dst.Name = src.Name
+	}
+	if !protected[1] {
+		dst.Secret = src.Secret
+	}
+	if !protected[2] {
+		dst.Remark = src.Remark
+	}
+	return nil
+}
+
+// genTestRootCopyForCreate3 copies *genTestLeaf.
+func genTestRootCopyForCreate3(s *genTestRootCopyState, dst, src **genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = new(genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForCreate2(s, &(*d), &(**src)); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate4 copies *int.
+func genTestRootCopyForCreate4(s *genTestRootCopyState, dst, src **int) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(*int)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = new(int)
+	}
+	s.visit(d, *src)
+	(*d) = (**src)
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate5 copies []genTestLeaf.
+func genTestRootCopyForCreate5(s *genTestRootCopyState, dst, src *[]genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.([]genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if len(d) != len(*src) || !s.canCopyInto(d, *src) {
+		d = make([]genTestLeaf, len(*src))
+	}
+	s.visit(d, *src)
+	for i := range *src {
+		if err := genTestRootCopyForCreate2(s, &d[i], &(*src)[i]); err != nil {
+			return err
+		}
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate6 copies []*genTestLeaf.
+func genTestRootCopyForCreate6(s *genTestRootCopyState, dst, src *[]*genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.([]*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if len(d) != len(*src) || !s.canCopyInto(d, *src) {
+		d = make([]*genTestLeaf, len(*src))
+	}
+	s.visit(d, *src)
+	for i := range *src {
+		if err := genTestRootCopyForCreate3(s, &d[i], &(*src)[i]); err != nil {
+			return err
+		}
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate7 copies [2]genTestLeaf.
+func genTestRootCopyForCreate7(s *genTestRootCopyState, dst, src *[2]genTestLeaf) error {
+	for i := range *src {
+		if err := genTestRootCopyForCreate2(s, &(*dst)[i], &(*src)[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForCreate8 copies map[string]genTestLeaf.
+func genTestRootCopyForCreate8(s *genTestRootCopyState, dst, src *map[string]genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForCreate19(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate9 copies map[string]*genTestLeaf.
+func genTestRootCopyForCreate9(s *genTestRootCopyState, dst, src *map[string]*genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]*genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForCreate20(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate10 copies map[string][]genTestLeaf.
+func genTestRootCopyForCreate10(s *genTestRootCopyState, dst, src *map[string][]genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string][]genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string][]genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForCreate21(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate11 copies map[string]map[int]*genTestLeaf.
+func genTestRootCopyForCreate11(s *genTestRootCopyState, dst, src *map[string]map[int]*genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]map[int]*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]map[int]*genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForCreate22(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate12 copies map[string]time.Time.
+func genTestRootCopyForCreate12(s *genTestRootCopyState, dst, src *map[string]time.Time) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]time.Time)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]time.Time)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForCreate23(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate13 copies map[string]interface{}.
+func genTestRootCopyForCreate13(s *genTestRootCopyState, dst, src *map[string]interface{}) error {
+	return genTestRootCopierForCreate.Copy(dst, src)
+}
+
+// genTestRootCopyForCreate14 copies struct { Value string Hidden string `protectfor:"update"` }.
+func genTestRootCopyForCreate14(s *genTestRootCopyState, dst, src *struct {
+	Value  string
+	Hidden string `protectfor:"update"`
+}) error {
+	dst.Value = src.Value
+	dst.Hidden = src.Hidden
+	return nil
+}
+
+// genTestRootCopyForCreate15 copies map[string]*datastore.Key.
+func genTestRootCopyForCreate15(s *genTestRootCopyState, dst, src *map[string]*datastore.Key) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]*datastore.Key)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]*datastore.Key)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForCreate24(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate16 copies genTestWritable.
+func genTestRootCopyForCreate16(s *genTestRootCopyState, dst, src *genTestWritable) error {
+	dst.Name = src.Name
+	dst.Code = src.Code
+	return nil
+}
+
+// genTestRootCopyForCreate17 copies map[string]*genTestWritable.
+func genTestRootCopyForCreate17(s *genTestRootCopyState, dst, src *map[string]*genTestWritable) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]*genTestWritable)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]*genTestWritable)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForCreate25(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate18 copies *genTestRoot.
+func genTestRootCopyForCreate18(s *genTestRootCopyState, dst, src **genTestRoot) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(*genTestRoot)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = new(genTestRoot)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForCreate1(s, &(*d), &(**src)); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForCreate19 copies entries of map[string]genTestLeaf.
+func genTestRootCopyForCreate19(s *genTestRootCopyState, dst, src map[string]genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		var n genTestLeaf
+		if err := genTestRootCopyForCreate2(s, &n, &sv); err != nil {
+			return err
+		}
+		dst[k] = n
+	}
+	return nil
+}
+
+// genTestRootCopyForCreate20 copies entries of map[string]*genTestLeaf.
+func genTestRootCopyForCreate20(s *genTestRootCopyState, dst, src map[string]*genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForCreate2(s, &(*dv), &(*sv)); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = nil
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(*genTestLeaf)
+			} else {
+				n := new(genTestLeaf)
+				s.visit(n, sv)
+				if err := genTestRootCopyForCreate2(s, &(*n), &(*sv)); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForCreate21 copies entries of map[string][]genTestLeaf.
+func genTestRootCopyForCreate21(s *genTestRootCopyState, dst, src map[string][]genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && len(dv) == len(sv) && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			for i := range sv {
+				if err := genTestRootCopyForCreate2(s, &dv[i], &sv[i]); err != nil {
+					return err
+				}
+			}
+		} else {
+			if sv == nil {
+				dst[k] = sv
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.([]genTestLeaf)
+			} else {
+				n := make([]genTestLeaf, len(sv))
+				s.visit(n, sv)
+				for i := range sv {
+					if err := genTestRootCopyForCreate2(s, &n[i], &sv[i]); err != nil {
+						return err
+					}
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForCreate22 copies entries of map[string]map[int]*genTestLeaf.
+func genTestRootCopyForCreate22(s *genTestRootCopyState, dst, src map[string]map[int]*genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForCreate26(s, dv, sv); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = sv
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(map[int]*genTestLeaf)
+			} else {
+				n := make(map[int]*genTestLeaf)
+				s.visit(n, sv)
+				if err := genTestRootCopyForCreate26(s, n, sv); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForCreate23 copies entries of map[string]time.Time.
+func genTestRootCopyForCreate23(s *genTestRootCopyState, dst, src map[string]time.Time) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		dst[k] = sv
+	}
+	return nil
+}
+
+// genTestRootCopyForCreate24 copies entries of map[string]*datastore.Key.
+func genTestRootCopyForCreate24(s *genTestRootCopyState, dst, src map[string]*datastore.Key) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		dst[k] = sv
+	}
+	return nil
+}
+
+// genTestRootCopyForCreate25 copies entries of map[string]*genTestWritable.
+func genTestRootCopyForCreate25(s *genTestRootCopyState, dst, src map[string]*genTestWritable) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForCreate16(s, &(*dv), &(*sv)); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = nil
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(*genTestWritable)
+			} else {
+				n := new(genTestWritable)
+				s.visit(n, sv)
+				if err := genTestRootCopyForCreate16(s, &(*n), &(*sv)); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForCreate26 copies entries of map[int]*genTestLeaf.
+func genTestRootCopyForCreate26(s *genTestRootCopyState, dst, src map[int]*genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForCreate2(s, &(*dv), &(*sv)); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = nil
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(*genTestLeaf)
+			} else {
+				n := new(genTestLeaf)
+				s.visit(n, sv)
+				if err := genTestRootCopyForCreate2(s, &(*n), &(*sv)); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopierForUpdate copies values in interfaces, which cannot be resolved at generation time.
+var genTestRootCopierForUpdate = &ProtectingCopier{StructTag: "protectfor", WritableTag: "writablefor", ProtectFor: "update"}
+
+// CopyProtectingForUpdate copies src to dst protecting fields for "update".
+// This copies the same as ProtectingCopy(dst, src, "update").
+func (dst *genTestRoot) CopyProtectingForUpdate(src *genTestRoot) error {
+	if dst == nil || src == nil {
+		return NewErrCopyValueInvalid("Cannot copy as dst or src is nil")
+	}
+	s := &genTestRootCopyState{}
+	s.visit(dst, src)
+	return genTestRootCopyForUpdate1(s, dst, src)
+}
+
+// genTestRootCopyForUpdate1 copies genTestRoot.
+func genTestRootCopyForUpdate1(s *genTestRootCopyState, dst, src *genTestRoot) error {
+	dst.ID = src.ID
+	dst.Name = src.Name
+	dst.Time = src.Time
+	if err := genTestRootCopyForUpdate2(s, &dst.Leaf, &src.Leaf); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate3(s, &dst.LeafPtr, &src.LeafPtr); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate4(s, &dst.IntPtr, &src.IntPtr); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate5(s, &dst.Leaves, &src.Leaves); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate6(s, &dst.LeafPtrs, &src.LeafPtrs); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate7(s, &dst.LeafArray, &src.LeafArray); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate8(s, &dst.Bytes, &src.Bytes); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate9(s, &dst.LeafMap, &src.LeafMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate10(s, &dst.PtrMap, &src.PtrMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate11(s, &dst.SliceMap, &src.SliceMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate12(s, &dst.MapMap, &src.MapMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate13(s, &dst.TimeMap, &src.TimeMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate14(s, &dst.Any, &src.Any); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate15(s, &dst.AnyMap, &src.AnyMap); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate16(s, &dst.Anonymous, &src.Anonymous); err != nil {
+		return err
+	}
+	dst.Key = src.Key
+	if err := genTestRootCopyForUpdate17(s, &dst.KeyMap, &src.KeyMap); err != nil {
+		return err
+	}
+	dst.Location = src.Location
+	if err := genTestRootCopyForUpdate18(s, &dst.Writable, &src.Writable); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate19(s, &dst.Writables, &src.Writables); err != nil {
+		return err
+	}
+	if err := genTestRootCopyForUpdate20(s, &dst.Self, &src.Self); err != nil {
+		return err
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate2 copies genTestLeaf.
+func genTestRootCopyForUpdate2(s *genTestRootCopyState, dst, src *genTestLeaf) error {
+	protected := [1]bool{
+		dst.ProtectField("Name", dst.Name, src.Name),
+	}
+	if !protected[0] {
+		dst.Name = src.Name
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate3 copies *genTestLeaf.
+func genTestRootCopyForUpdate3(s *genTestRootCopyState, dst, src **genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = new(genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForUpdate2(s, &(*d), &(**src)); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate4 copies *int.
+func genTestRootCopyForUpdate4(s *genTestRootCopyState, dst, src **int) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(*int)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = new(int)
+	}
+	s.visit(d, *src)
+	(*d) = (**src)
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate5 copies []genTestLeaf.
+func genTestRootCopyForUpdate5(s *genTestRootCopyState, dst, src *[]genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.([]genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if len(d) != len(*src) || !s.canCopyInto(d, *src) {
+		d = make([]genTestLeaf, len(*src))
+	}
+	s.visit(d, *src)
+	for i := range *src {
+		if err := genTestRootCopyForUpdate2(s, &d[i], &(*src)[i]); err != nil {
+			return err
+		}
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate6 copies []*genTestLeaf.
+func genTestRootCopyForUpdate6(s *genTestRootCopyState, dst, src *[]*genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.([]*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if len(d) != len(*src) || !s.canCopyInto(d, *src) {
+		d = make([]*genTestLeaf, len(*src))
+	}
+	s.visit(d, *src)
+	for i := range *src {
+		if err := genTestRootCopyForUpdate3(s, &d[i], &(*src)[i]); err != nil {
+			return err
+		}
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate7 copies [2]genTestLeaf.
+func genTestRootCopyForUpdate7(s *genTestRootCopyState, dst, src *[2]genTestLeaf) error {
+	for i := range *src {
+		if err := genTestRootCopyForUpdate2(s, &(*dst)[i], &(*src)[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate8 copies []byte.
+func genTestRootCopyForUpdate8(s *genTestRootCopyState, dst, src *[]byte) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.([]byte)
+		return nil
+	}
+	d := *dst
+	if len(d) != len(*src) || !s.canCopyInto(d, *src) {
+		d = make([]byte, len(*src))
+	}
+	s.visit(d, *src)
+	for i := range *src {
+		d[i] = (*src)[i]
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate9 copies map[string]genTestLeaf.
+func genTestRootCopyForUpdate9(s *genTestRootCopyState, dst, src *map[string]genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForUpdate21(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate10 copies map[string]*genTestLeaf.
+func genTestRootCopyForUpdate10(s *genTestRootCopyState, dst, src *map[string]*genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]*genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForUpdate22(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate11 copies map[string][]genTestLeaf.
+func genTestRootCopyForUpdate11(s *genTestRootCopyState, dst, src *map[string][]genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string][]genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string][]genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForUpdate23(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate12 copies map[string]map[int]*genTestLeaf.
+func genTestRootCopyForUpdate12(s *genTestRootCopyState, dst, src *map[string]map[int]*genTestLeaf) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]map[int]*genTestLeaf)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]map[int]*genTestLeaf)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForUpdate24(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate13 copies map[string]time.Time.
+func genTestRootCopyForUpdate13(s *genTestRootCopyState, dst, src *map[string]time.Time) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]time.Time)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]time.Time)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForUpdate25(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate14 copies interface{}.
+func genTestRootCopyForUpdate14(s *genTestRootCopyState, dst, src *interface{}) error {
+	return genTestRootCopierForUpdate.Copy(dst, src)
+}
+
+// genTestRootCopyForUpdate15 copies map[string]interface{}.
+func genTestRootCopyForUpdate15(s *genTestRootCopyState, dst, src *map[string]interface{}) error {
+	return genTestRootCopierForUpdate.Copy(dst, src)
+}
+
+// genTestRootCopyForUpdate16 copies struct { Value string Hidden string `protectfor:"update"` }.
+func genTestRootCopyForUpdate16(s *genTestRootCopyState, dst, src *struct {
+	Value  string
+	Hidden string `protectfor:"update"`
+}) error {
+	dst.Value = src.Value
+	return nil
+}
+
+// genTestRootCopyForUpdate17 copies map[string]*datastore.Key.
+func genTestRootCopyForUpdate17(s *genTestRootCopyState, dst, src *map[string]*datastore.Key) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]*datastore.Key)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]*datastore.Key)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForUpdate26(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate18 copies genTestWritable.
+func genTestRootCopyForUpdate18(s *genTestRootCopyState, dst, src *genTestWritable) error {
+	dst.Name = src.Name
+	if err := genTestRootCopyForUpdate2(s, &dst.Leaf, &src.Leaf); err != nil {
+		return err
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate19 copies map[string]*genTestWritable.
+func genTestRootCopyForUpdate19(s *genTestRootCopyState, dst, src *map[string]*genTestWritable) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(map[string]*genTestWritable)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = make(map[string]*genTestWritable)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForUpdate27(s, d, *src); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate20 copies *genTestRoot.
+func genTestRootCopyForUpdate20(s *genTestRootCopyState, dst, src **genTestRoot) error {
+	if *src == nil {
+		*dst = nil
+		return nil
+	}
+	if v, ok := s.lookup(*src); ok {
+		*dst = v.(*genTestRoot)
+		return nil
+	}
+	d := *dst
+	if d == nil || !s.canCopyInto(d, *src) {
+		d = new(genTestRoot)
+	}
+	s.visit(d, *src)
+	if err := genTestRootCopyForUpdate1(s, &(*d), &(**src)); err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// genTestRootCopyForUpdate21 copies entries of map[string]genTestLeaf.
+func genTestRootCopyForUpdate21(s *genTestRootCopyState, dst, src map[string]genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		var n genTestLeaf
+		if err := genTestRootCopyForUpdate2(s, &n, &sv); err != nil {
+			return err
+		}
+		dst[k] = n
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate22 copies entries of map[string]*genTestLeaf.
+func genTestRootCopyForUpdate22(s *genTestRootCopyState, dst, src map[string]*genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForUpdate2(s, &(*dv), &(*sv)); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = nil
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(*genTestLeaf)
+			} else {
+				n := new(genTestLeaf)
+				s.visit(n, sv)
+				if err := genTestRootCopyForUpdate2(s, &(*n), &(*sv)); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate23 copies entries of map[string][]genTestLeaf.
+func genTestRootCopyForUpdate23(s *genTestRootCopyState, dst, src map[string][]genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && len(dv) == len(sv) && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			for i := range sv {
+				if err := genTestRootCopyForUpdate2(s, &dv[i], &sv[i]); err != nil {
+					return err
+				}
+			}
+		} else {
+			if sv == nil {
+				dst[k] = sv
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.([]genTestLeaf)
+			} else {
+				n := make([]genTestLeaf, len(sv))
+				s.visit(n, sv)
+				for i := range sv {
+					if err := genTestRootCopyForUpdate2(s, &n[i], &sv[i]); err != nil {
+						return err
+					}
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate24 copies entries of map[string]map[int]*genTestLeaf.
+func genTestRootCopyForUpdate24(s *genTestRootCopyState, dst, src map[string]map[int]*genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForUpdate28(s, dv, sv); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = sv
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(map[int]*genTestLeaf)
+			} else {
+				n := make(map[int]*genTestLeaf)
+				s.visit(n, sv)
+				if err := genTestRootCopyForUpdate28(s, n, sv); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate25 copies entries of map[string]time.Time.
+func genTestRootCopyForUpdate25(s *genTestRootCopyState, dst, src map[string]time.Time) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		dst[k] = sv
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate26 copies entries of map[string]*datastore.Key.
+func genTestRootCopyForUpdate26(s *genTestRootCopyState, dst, src map[string]*datastore.Key) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		dst[k] = sv
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate27 copies entries of map[string]*genTestWritable.
+func genTestRootCopyForUpdate27(s *genTestRootCopyState, dst, src map[string]*genTestWritable) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForUpdate18(s, &(*dv), &(*sv)); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = nil
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(*genTestWritable)
+			} else {
+				n := new(genTestWritable)
+				s.visit(n, sv)
+				if err := genTestRootCopyForUpdate18(s, &(*n), &(*sv)); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
+
+// genTestRootCopyForUpdate28 copies entries of map[int]*genTestLeaf.
+func genTestRootCopyForUpdate28(s *genTestRootCopyState, dst, src map[int]*genTestLeaf) error {
+	for k := range dst {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, sv := range src {
+		if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {
+			s.visit(dv, sv)
+			if err := genTestRootCopyForUpdate2(s, &(*dv), &(*sv)); err != nil {
+				return err
+			}
+		} else {
+			if sv == nil {
+				dst[k] = nil
+			} else if v, ok := s.lookup(sv); ok {
+				dst[k] = v.(*genTestLeaf)
+			} else {
+				n := new(genTestLeaf)
+				s.visit(n, sv)
+				if err := genTestRootCopyForUpdate2(s, &(*n), &(*sv)); err != nil {
+					return err
+				}
+				dst[k] = n
+			}
+		}
+	}
+	return nil
+}
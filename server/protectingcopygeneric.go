@@ -0,0 +1,79 @@
+//go:build go1.18
+// +build go1.18
+
+package server
+
+import (
+	"net/http"
+)
+
+// ProtectingCopierOf is ProtectingCopier for values of T
+// checking types at compile time instead of ErrCopyTypeMismatch.
+// Configure with the embedded ProtectingCopier:
+//
+//	c := ProtectingCopierOf[User]{ProtectingCopier{ProtectFor: "update"}}
+type ProtectingCopierOf[T any] struct {
+	ProtectingCopier
+}
+
+// Copy is ProtectingCopier.Copy for *T.
+func (c *ProtectingCopierOf[T]) Copy(dst, src *T) error {
+	return c.ProtectingCopier.Copy(dst, src)
+}
+
+// CopyWithReport is ProtectingCopier.CopyWithReport for *T.
+func (c *ProtectingCopierOf[T]) CopyWithReport(dst, src *T) (*ProtectingCopyReport, error) {
+	return c.ProtectingCopier.CopyWithReport(dst, src)
+}
+
+// Clone returns a deep copy of src where protected fields are zero values.
+func (c *ProtectingCopierOf[T]) Clone(src T) (T, error) {
+	var dst T
+	if err := c.ProtectingCopier.Copy(&dst, &src); err != nil {
+		var zero T
+		return zero, err
+	}
+	return dst, nil
+}
+
+// Bind is ProtectingCopier.Bind for *T.
+func (c *ProtectingCopierOf[T]) Bind(binder func(dst interface{}) error, dst *T) error {
+	return c.ProtectingCopier.Bind(binder, dst)
+}
+
+// BindWithReport is ProtectingCopier.BindWithReport for *T.
+func (c *ProtectingCopierOf[T]) BindWithReport(binder func(dst interface{}) error, dst *T) (*ProtectingCopyReport, error) {
+	return c.ProtectingCopier.BindWithReport(binder, dst)
+}
+
+// BindRequest is ProtectingCopier.BindRequest for *T.
+func (c *ProtectingCopierOf[T]) BindRequest(req *http.Request, binder func(dst interface{}) error, dst *T) error {
+	return c.ProtectingCopier.BindRequest(req, binder, dst)
+}
+
+// BindRequestWithReport is ProtectingCopier.BindRequestWithReport for *T.
+func (c *ProtectingCopierOf[T]) BindRequestWithReport(req *http.Request, binder func(dst interface{}) error, dst *T) (*ProtectingCopyReport, error) {
+	return c.ProtectingCopier.BindRequestWithReport(req, binder, dst)
+}
+
+// ProtectingCopyOf is ProtectingCopy checking types at compile time.
+func ProtectingCopyOf[T any](dst, src *T, protectFor string) error {
+	return ProtectingCopy(dst, src, protectFor)
+}
+
+// ProtectingCloneOf returns a deep copy of src
+// where fields protected for protectFor are zero values.
+func ProtectingCloneOf[T any](src T, protectFor string) (T, error) {
+	c := &ProtectingCopierOf[T]{ProtectingCopier{ProtectFor: protectFor}}
+	return c.Clone(src)
+}
+
+// ProtectingBindOf is ProtectingBind checking types at compile time.
+func ProtectingBindOf[T any](binder func(dst interface{}) error, dst *T, protectFor string) error {
+	return ProtectingBind(binder, dst, protectFor)
+}
+
+// ProtectingBindRequestOf is ProtectingBindRequest checking types at compile time.
+func ProtectingBindRequestOf[T any](req *http.Request, binder func(dst interface{}) error, dst *T, protectFor string) error {
+	return ProtectingBindRequest(req, binder, dst, protectFor)
+}
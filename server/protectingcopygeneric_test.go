@@ -0,0 +1,85 @@
+//go:build go1.18
+// +build go1.18
+
+package server
+
+import (
+	"testing"
+)
+
+func TestProtectingCopyOf(t *testing.T) {
+	dst := exampleUser{Name: "oldname", Password: "secret"}
+	src := exampleUser{Name: "newname", Password: "sesame"}
+	expectEquals(t, nil, ProtectingCopyOf(&dst, &src, "update"))
+	expectEquals(t, exampleUser{Name: "newname", Password: "secret"}, dst)
+}
+
+func TestProtectingCloneOf(t *testing.T) {
+	type testStruct struct {
+		Name  string
+		Items []exampleUser
+	}
+
+	src := testStruct{
+		Name:  "name",
+		Items: []exampleUser{{Name: "user", Password: "sesame"}},
+	}
+	cloned, err := ProtectingCloneOf(src, "update")
+	expectEquals(t, nil, err)
+	// 保護されたフィールドはゼロ値になる
+	expectEquals(
+		t,
+		testStruct{
+			Name:  "name",
+			Items: []exampleUser{{Name: "user"}},
+		},
+		cloned,
+	)
+	expectNoAliasing(t, cloned, src)
+
+	// ポインタや map もコピーされる
+	ptr, err := ProtectingCloneOf(&src, "update")
+	expectEquals(t, nil, err)
+	expectEquals(t, &cloned, ptr)
+	expectNotSame(t, &src, ptr)
+	m, err := ProtectingCloneOf(map[string]exampleUser{"key": {Name: "user", Password: "sesame"}}, "update")
+	expectEquals(t, nil, err)
+	expectEquals(t, map[string]exampleUser{"key": {Name: "user"}}, m)
+}
+
+func TestProtectingCopierOf(t *testing.T) {
+	c := &ProtectingCopierOf[exampleUser]{ProtectingCopier{ProtectFor: "update", Strict: true}}
+	dst := exampleUser{Name: "oldname", Password: "secret"}
+	src := exampleUser{Name: "newname", Password: "secret"}
+	report, err := c.CopyWithReport(&dst, &src)
+	expectEquals(t, nil, err)
+	expectEquals(t, exampleUser{Name: "newname", Password: "secret"}, dst)
+	expectEquals(t, []ProtectingCopyChange{{Path: "Name", Old: "oldname", New: "newname"}}, report.Changed)
+
+	src.Password = "sesame"
+	if _, ok := c.Copy(&dst, &src).(*ErrCopyProtected); !ok {
+		t.Errorf("Expect ErrCopyProtected")
+	}
+
+	c.Strict = false
+	cloned, err := c.Clone(src)
+	expectEquals(t, nil, err)
+	expectEquals(t, exampleUser{Name: "newname"}, cloned)
+
+	expectEquals(t, nil, c.Bind(jsonBinder(`{"name": "boundname"}`), &dst))
+	expectEquals(t, exampleUser{Name: "boundname", Password: "secret"}, dst)
+	report, err = c.BindWithReport(jsonBinder(`{"password": "sesame"}`), &dst)
+	expectEquals(t, nil, err)
+	expectEquals(t, []ProtectingCopyChange{{Path: "Password", Old: "secret", New: "sesame"}}, report.Discarded)
+	expectEquals(t, nil, ProtectingBindOf(jsonBinder(`{"name": "name"}`), &dst, "update"))
+	expectEquals(t, "name", dst.Name)
+
+	// BindRequest はリクエストに存在するキーのみコピーする
+	dst = exampleUser{Name: "oldname", Password: "secret"}
+	req, binder := jsonRequest(`{"password": "sesame"}`)
+	expectEquals(t, nil, c.BindRequest(req, binder, &dst))
+	expectEquals(t, exampleUser{Name: "oldname", Password: "secret"}, dst)
+	req, binder = jsonRequest(`{"name": "newname"}`)
+	expectEquals(t, nil, ProtectingBindRequestOf(req, binder, &dst, "update"))
+	expectEquals(t, "newname", dst.Name)
+}
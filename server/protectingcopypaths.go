@@ -0,0 +1,198 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// protectingCopyAnyElem is the pattern element matching any index or key.
+const protectingCopyAnyElem = "[*]"
+
+// protectingCopyAnyField is the pattern element matching any field or key.
+const protectingCopyAnyField = "*"
+
+// ProtectingCopyPaths is a set of field paths to protect
+// for types which cannot be tagged (e.g. ones from other packages).
+// Create with NewProtectingCopyPaths.
+type ProtectingCopyPaths struct {
+	typ  reflect.Type
+	root *protectingCopyPathNode
+}
+
+// protectingCopyPathNode is a node of the tree of protected paths
+// resolved to Go field names.
+type protectingCopyPathNode struct {
+	fields    map[string]*protectingCopyPathNode
+	elem      *protectingCopyPathNode
+	protected bool
+}
+
+// NewProtectingCopyPaths creates ProtectingCopyPaths for values of typ
+// (pointers are dereferenced) to protect fields matching patterns.
+// A pattern is a path like "Owner", "Items[*].Price" or "Meta.*":
+//
+//   - Names are Go field names or names in json tags,
+//     or property names for datastore.PropertyList.
+//   - "*" matches any field of structs or any key of maps.
+//   - "[*]" matches any element of slices, arrays or maps.
+//   - Pointers are followed implicitly.
+//
+// Patterns matching nothing in typ are rejected.
+// Patterns cannot go through interfaces
+// nor into types copied as a whole with ProtectingCopyTypes.
+func NewProtectingCopyPaths(typ reflect.Type, patterns ...string) (*ProtectingCopyPaths, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	p := &ProtectingCopyPaths{
+		typ:  typ,
+		root: &protectingCopyPathNode{},
+	}
+	for _, pattern := range patterns {
+		elems, err := parseProtectingCopyPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !p.root.add(typ, elems) {
+			return nil, fmt.Errorf("pattern %q matches nothing in %v", pattern, typ)
+		}
+	}
+	return p, nil
+}
+
+// parseProtectingCopyPattern splits pattern into names and "[*]".
+func parseProtectingCopyPattern(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	elems := []string{}
+	rest := pattern
+	for rest != "" {
+		if strings.HasPrefix(rest, protectingCopyAnyElem) {
+			elems = append(elems, protectingCopyAnyElem)
+			rest = rest[len(protectingCopyAnyElem):]
+			continue
+		}
+		if len(elems) > 0 {
+			if rest[0] != '.' {
+				return nil, fmt.Errorf("invalid pattern %q: unexpected %q", pattern, rest)
+			}
+			rest = rest[1:]
+		}
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("invalid pattern %q: empty name", pattern)
+		}
+		elems = append(elems, rest[:end])
+		rest = rest[end:]
+	}
+	return elems, nil
+}
+
+// add adds the path of elems in typ to n.
+// Returns false if elems matches nothing.
+func (n *protectingCopyPathNode) add(typ reflect.Type, elems []string) bool {
+	if len(elems) == 0 {
+		n.protected = true
+		return true
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	elem := elems[0]
+	if typ == propertyListType {
+		// properties are values as a whole.
+		if len(elems) != 1 || elem == protectingCopyAnyElem {
+			return false
+		}
+		if n.fields == nil {
+			n.fields = map[string]*protectingCopyPathNode{}
+		}
+		n.fields[elem] = &protectingCopyPathNode{protected: true}
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.Struct:
+		matched := false
+		for idx := 0; idx < typ.NumField(); idx++ {
+			field := typ.Field(idx)
+			if field.PkgPath != "" && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+				// unexported fields are never copied
+				// except fields promoted from embedded structs.
+				continue
+			}
+			jsonKey, _ := jsonFieldKey(field)
+			if elem != protectingCopyAnyField && elem != field.Name && elem != jsonKey {
+				continue
+			}
+			child, ok := n.fields[field.Name]
+			if !ok {
+				child = &protectingCopyPathNode{}
+			}
+			if !child.add(field.Type, elems[1:]) {
+				continue
+			}
+			if n.fields == nil {
+				n.fields = map[string]*protectingCopyPathNode{}
+			}
+			n.fields[field.Name] = child
+			matched = true
+		}
+		return matched
+	case reflect.Map:
+		if elem != protectingCopyAnyElem && elem != protectingCopyAnyField {
+			return false
+		}
+	case reflect.Slice, reflect.Array:
+		if elem != protectingCopyAnyElem {
+			return false
+		}
+	default:
+		return false
+	}
+	child := n.elem
+	if child == nil {
+		child = &protectingCopyPathNode{}
+	}
+	if !child.add(typ.Elem(), elems[1:]) {
+		return false
+	}
+	n.elem = child
+	return true
+}
+
+// field returns the node for the field name, or nil.
+func (n *protectingCopyPathNode) field(name string) *protectingCopyPathNode {
+	if n == nil {
+		return nil
+	}
+	return n.fields[name]
+}
+
+// property returns the node for the property name of datastore.PropertyList, or nil.
+func (n *protectingCopyPathNode) property(name string) *protectingCopyPathNode {
+	if n == nil {
+		return nil
+	}
+	if child, ok := n.fields[name]; ok {
+		return child
+	}
+	return n.fields[protectingCopyAnyField]
+}
+
+// element returns the node for elements, or nil.
+func (n *protectingCopyPathNode) element() *protectingCopyPathNode {
+	if n == nil {
+		return nil
+	}
+	return n.elem
+}
+
+// isProtected tests whether the value at n is protected.
+func (n *protectingCopyPathNode) isProtected() bool {
+	return n != nil && n.protected
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"google.golang.org/appengine/datastore"
+)
+
+var (
+	propertyListType      = reflect.TypeOf(datastore.PropertyList(nil))
+	propertyLoadSaverType = reflect.TypeOf((*datastore.PropertyLoadSaver)(nil)).Elem()
+)
+
+// protectingCopyProperty is a field of a struct stored as a property.
+type protectingCopyProperty struct {
+	// name is the name of the field.
+	name      string
+	protected bool
+}
+
+// protectingCopyPropertyGroup is properties with the same name
+// in the destination and the source.
+type protectingCopyPropertyGroup struct {
+	name string
+	dst  []datastore.Property
+	src  []datastore.Property
+}
+
+// datastorePropertyName returns the name of the property for field,
+// or "" if field is not stored.
+// promoted is true if fields of the anonymous struct are stored without prefix.
+func datastorePropertyName(field reflect.StructField) (name string, promoted bool) {
+	tag := strings.Split(field.Tag.Get("datastore"), ",")[0]
+	switch {
+	case tag == "-":
+		return "", false
+	case tag != "":
+		return tag, false
+	}
+	return field.Name, field.Anonymous
+}
+
+// groupProperties groups properties in dst and src by names
+// ordered as they appear in src and then in dst.
+func groupProperties(dst, src []datastore.Property) []*protectingCopyPropertyGroup {
+	groups := []*protectingCopyPropertyGroup{}
+	byName := map[string]*protectingCopyPropertyGroup{}
+	lookup := func(name string) *protectingCopyPropertyGroup {
+		group, ok := byName[name]
+		if !ok {
+			group = &protectingCopyPropertyGroup{name: name}
+			byName[name] = group
+			groups = append(groups, group)
+		}
+		return group
+	}
+	for _, property := range src {
+		group := lookup(property.Name)
+		group.src = append(group.src, property)
+	}
+	for _, property := range dst {
+		group := lookup(property.Name)
+		group.dst = append(group.dst, property)
+	}
+	return groups
+}
+
+// sortPropertiesByName sorts properties by names
+// keeping the order of ones with the same name.
+func sortPropertiesByName(properties []datastore.Property) {
+	sort.SliceStable(properties, func(i, j int) bool {
+		return properties[i].Name < properties[j].Name
+	})
+}
+
+// cloneProperty returns a copy of property
+// not sharing bytes and nested entities with it.
+func cloneProperty(property datastore.Property) datastore.Property {
+	switch value := property.Value.(type) {
+	case []byte:
+		if value != nil {
+			property.Value = append(make([]byte, 0, len(value)), value...)
+		}
+	case datastore.ByteString:
+		if value != nil {
+			property.Value = append(make(datastore.ByteString, 0, len(value)), value...)
+		}
+	case *datastore.Entity:
+		if value != nil {
+			entity := &datastore.Entity{
+				Key:        value.Key,
+				Properties: make([]datastore.Property, 0, len(value.Properties)),
+			}
+			for _, nested := range value.Properties {
+				entity.Properties = append(entity.Properties, cloneProperty(nested))
+			}
+			property.Value = entity
+		}
+	}
+	return property
+}
+
+// propertyValues returns values of properties to report:
+// nil for no properties, the value for a single property,
+// and []interface{} for multiple properties.
+func propertyValues(properties []datastore.Property) interface{} {
+	switch {
+	case len(properties) == 0:
+		return nil
+	case len(properties) == 1 && !properties[0].Multiple:
+		return properties[0].Value
+	}
+	values := make([]interface{}, 0, len(properties))
+	for _, property := range properties {
+		values = append(values, property.Value)
+	}
+	return values
+}
+
+// mergeProperties merges properties of src into dst by names.
+// Properties whose names are protected are kept as dst,
+// and others are replaced with ones of src.
+// push pushes the path of the property name,
+// and protected tests whether the property is protected at the path.
+func (c *ProtectingCopier) mergeProperties(
+	s *protectingCopyState,
+	dst, src []datastore.Property,
+	push func(name string),
+	protected func(dValue, sValue interface{}) bool,
+) datastore.PropertyList {
+	merged := datastore.PropertyList{}
+	for _, group := range groupProperties(dst, src) {
+		dValue := propertyValues(group.dst)
+		sValue := propertyValues(group.src)
+		push(group.name)
+		if s.pathNode().isProtected() || protected(dValue, sValue) {
+			merged = append(merged, group.dst...)
+			if s.report != nil || s.strict {
+				s.reportDiscardedValue(reflect.ValueOf(&dValue).Elem(), reflect.ValueOf(&sValue).Elem(), false)
+			}
+		} else {
+			for _, property := range group.src {
+				merged = append(merged, cloneProperty(property))
+			}
+			s.reportChange(dValue, sValue)
+		}
+		s.pop()
+	}
+	return merged
+}
+
+// copyPropertyList copies datastore.PropertyList by property names.
+// Names are protected with ProtectPaths (e.g. "Owner" for the list)
+// and ProtectingCopier.ProtectField.
+// This assumes values are:
+// * datastore.PropertyList
+// * CanSet()
+func (c *ProtectingCopier) copyPropertyList(s *protectingCopyState, dst, src reflect.Value) error {
+	if src.IsNil() {
+		s.reportSet(dst, src)
+		dst.Set(src)
+		return nil
+	}
+	merged := c.mergeProperties(
+		s,
+		dst.Interface().(datastore.PropertyList),
+		src.Interface().(datastore.PropertyList),
+		func(name string) {
+			s.path = append(s.path, protectingCopyPathElem{
+				key:  reflect.ValueOf(name),
+				node: s.pathNode().property(name),
+			})
+		},
+		func(dValue, sValue interface{}) bool {
+			return c.ProtectField != nil && c.ProtectField(s.pathString(), dValue, sValue)
+		},
+	)
+	dst.Set(reflect.ValueOf(merged))
+	return nil
+}
+
+// copyPropertyLoadSaver copies structs implementing datastore.PropertyLoadSaver
+// by properties saved with Save.
+// Properties are protected if fields with the same names are protected,
+// and loaded to dst with Load.
+// This assumes values are:
+// * reflect.Struct
+// * CanSet()
+// * types are same
+func (c *ProtectingCopier) copyPropertyLoadSaver(s *protectingCopyState, plan *protectingCopyPlan, dst, src reflect.Value) error {
+	if !src.CanAddr() {
+		addressable := reflect.New(src.Type()).Elem()
+		addressable.Set(src)
+		src = addressable
+	}
+	sProperties, err := src.Addr().Interface().(datastore.PropertyLoadSaver).Save()
+	if err != nil {
+		return err
+	}
+	dProperties, err := dst.Addr().Interface().(datastore.PropertyLoadSaver).Save()
+	if err != nil {
+		return err
+	}
+	// the order of saved properties is not stable.
+	sortPropertiesByName(sProperties)
+	sortPropertiesByName(dProperties)
+	var property protectingCopyProperty
+	merged := c.mergeProperties(
+		s,
+		dProperties,
+		sProperties,
+		func(name string) {
+			// nested structs are stored as "Field.Nested".
+			prefix := strings.Split(name, ".")[0]
+			var ok bool
+			if property, ok = plan.properties[prefix]; !ok {
+				property = protectingCopyProperty{name: prefix}
+			}
+			s.pushField(property.name + name[len(prefix):])
+		},
+		func(dValue, sValue interface{}) bool {
+			return property.protected ||
+				c.isProtectedByHook(s, plan, property.name, dst, reflect.ValueOf(&dValue).Elem(), reflect.ValueOf(&sValue).Elem())
+		},
+	)
+
+	// fields not stored (e.g. keys of goon) are kept.
+	loaded := reflect.New(dst.Type())
+	loaded.Elem().Set(dst)
+	for idx := 0; idx < dst.NumField(); idx++ {
+		field := dst.Type().Field(idx)
+		if name, _ := datastorePropertyName(field); name != "" && loaded.Elem().Field(idx).CanSet() {
+			loaded.Elem().Field(idx).Set(reflect.Zero(field.Type))
+		}
+	}
+	if err := loaded.Interface().(datastore.PropertyLoadSaver).Load(merged); err != nil {
+		return err
+	}
+	dst.Set(loaded.Elem())
+	return nil
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ProtectingCopyTransformFunc transforms v in place.
+// v is settable, and arg is the argument in the tag
+// (e.g. "1s" for `protecttransform:"truncate=1s"`).
+type ProtectingCopyTransformFunc func(v reflect.Value, arg string) error
+
+// ProtectingCopyTransforms is a registry of transforms
+// ProtectingCopier applies to fields with TransformTag.
+// Register transforms before using it in copies, as it is not safe to modify concurrently.
+// Transforms are looked up on each copy, so registering affects following copies.
+type ProtectingCopyTransforms struct {
+	funcs map[string]ProtectingCopyTransformFunc
+}
+
+// defaultProtectingCopyTransforms is used for ProtectingCopier without Transforms.
+var defaultProtectingCopyTransforms = NewProtectingCopyTransforms()
+
+// NewProtectingCopyTransforms creates a new ProtectingCopyTransforms
+// with following transforms registered:
+//
+//   - "trim" trims spaces of strings.
+//   - "lower" and "upper" convert cases of strings.
+//   - "truncate=<duration>" truncates time.Time (e.g. "truncate=1s").
+//
+// They are applied also to pointers to, slices of and arrays of the types.
+func NewProtectingCopyTransforms() *ProtectingCopyTransforms {
+	t := &ProtectingCopyTransforms{
+		funcs: map[string]ProtectingCopyTransformFunc{},
+	}
+	t.Register("trim", stringTransform("trim", strings.TrimSpace))
+	t.Register("lower", stringTransform("lower", strings.ToLower))
+	t.Register("upper", stringTransform("upper", strings.ToUpper))
+	t.Register("truncate", truncateTransform)
+	return t
+}
+
+// Register registers f as the transform name.
+func (t *ProtectingCopyTransforms) Register(name string, f ProtectingCopyTransformFunc) *ProtectingCopyTransforms {
+	t.funcs[name] = f
+	return t
+}
+
+// Unregister removes the transform name, including defaults.
+func (t *ProtectingCopyTransforms) Unregister(name string) *ProtectingCopyTransforms {
+	delete(t.funcs, name)
+	return t
+}
+
+// lookup returns the transform name.
+func (t *ProtectingCopyTransforms) lookup(name string) (ProtectingCopyTransformFunc, bool) {
+	f, ok := t.funcs[name]
+	return f, ok
+}
+
+// protectingCopyTransform is a transform specified in TransformTag.
+type protectingCopyTransform struct {
+	name string
+	arg  string
+	// tag and field are for the error of unknown transforms.
+	tag   string
+	field string
+}
+
+// parseProtectingCopyTransforms parses the value of TransformTag on field.
+// Transforms are looked up on copy.
+func parseProtectingCopyTransforms(tag, value string, field reflect.StructField) []protectingCopyTransform {
+	parsed := []protectingCopyTransform{}
+	for _, option := range strings.Split(value, ",") {
+		name := option
+		arg := ""
+		if idx := strings.Index(option, "="); idx >= 0 {
+			name = option[:idx]
+			arg = option[idx+1:]
+		}
+		parsed = append(parsed, protectingCopyTransform{
+			name:  name,
+			arg:   arg,
+			tag:   tag,
+			field: field.Name,
+		})
+	}
+	return parsed
+}
+
+// lookupTransforms returns functions of transforms in the same order.
+func lookupTransforms(registry *ProtectingCopyTransforms, transforms []protectingCopyTransform) ([]ProtectingCopyTransformFunc, error) {
+	funcs := make([]ProtectingCopyTransformFunc, 0, len(transforms))
+	for _, transform := range transforms {
+		f, ok := registry.lookup(transform.name)
+		if !ok {
+			return nil, newErrCopyValueInvalid(ProtectingCopyReasonInvalidTag, fmt.Sprintf("unknown transform in %v tag of %v: %q", transform.tag, transform.field, transform.name))
+		}
+		funcs = append(funcs, f)
+	}
+	return funcs, nil
+}
+
+// transformEach applies f to v, or elements of v if v is a pointer, a slice or an array.
+// f returns false if it cannot transform the value.
+func transformEach(name string, v reflect.Value, f func(v reflect.Value) bool) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return transformEach(name, v.Elem(), f)
+	case reflect.Slice, reflect.Array:
+		for idx := 0; idx < v.Len(); idx++ {
+			if err := transformEach(name, v.Index(idx), f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !f(v) {
+		return fmt.Errorf("%v cannot be applied to %v", name, v.Type())
+	}
+	return nil
+}
+
+// stringTransform creates the transform applying f to strings.
+func stringTransform(name string, f func(string) string) ProtectingCopyTransformFunc {
+	return func(v reflect.Value, arg string) error {
+		return transformEach(name, v, func(v reflect.Value) bool {
+			if v.Kind() != reflect.String {
+				return false
+			}
+			v.SetString(f(v.String()))
+			return true
+		})
+	}
+}
+
+// truncateTransform truncates time.Time to multiples of the duration arg.
+func truncateTransform(v reflect.Value, arg string) error {
+	d, err := time.ParseDuration(arg)
+	if err != nil {
+		return err
+	}
+	timeType := reflect.TypeOf(time.Time{})
+	return transformEach("truncate", v, func(v reflect.Value) bool {
+		if v.Type() != timeType {
+			return false
+		}
+		v.Set(reflect.ValueOf(v.Interface().(time.Time).Truncate(d)))
+		return true
+	})
+}
+
+// copyTransformed copies a field with TransformTag.
+// The source is copied to a new value, transformed,
+// and then copied to the destination so that reports have transformed values.
+// This assumes values are:
+// * CanSet()
+// * types are same
+func (c *ProtectingCopier) copyTransformed(s *protectingCopyState, field protectingCopyField, dst, src reflect.Value) error {
+	funcs, err := lookupTransforms(s.transforms, field.transforms)
+	if err != nil {
+		return err
+	}
+	// transformed values must not be shared with other copied values.
+	// claimed is also kept as visit resets it with visited.
+	visited, claimed := s.visited, s.claimed
+	s.visited, s.claimed = nil, nil
+	created, err := c.createCopiedDest(s, src)
+	s.visited, s.claimed = visited, claimed
+	if err != nil {
+		return err
+	}
+	transformed := reflect.New(src.Type()).Elem()
+	transformed.Set(created)
+	for idx, transform := range field.transforms {
+		if err := funcs[idx](transformed, transform.arg); err != nil {
+			return &ErrCopyTransform{
+				Path:      s.pathString(),
+				Transform: transform.name,
+				Err:       err,
+			}
+		}
+	}
+	if field.mapPolicy != nil {
+		return c.copyMapWithPolicy(s, field.mapPolicy, dst, transformed)
+	}
+	return c.copyImpl(s, dst, transformed)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"mime/multipart"
+	"reflect"
+	"sync"
+	"time"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+// ProtectingCopyFunc copies src to dst.
+// dst is settable and has the same type as src.
+type ProtectingCopyFunc func(dst, src reflect.Value) error
+
+// protectingCopyTypeHandler is how to copy a type.
+type protectingCopyTypeHandler struct {
+	// copyFunc is nil for opaque types.
+	copyFunc ProtectingCopyFunc
+}
+
+// ProtectingCopyTypes is a registry of how ProtectingCopier copies specific types.
+// It is safe to register types concurrently with copies,
+// though copies in progress may not see the change.
+// Plans of copies are cached in each registry, so reuse registries.
+// Registering or unregistering types discards cached plans.
+type ProtectingCopyTypes struct {
+	mu       sync.RWMutex
+	handlers map[reflect.Type]protectingCopyTypeHandler
+	// plans caches protectingCopyPlan for protectingCopyPlanKey.
+	plans *sync.Map
+}
+
+// defaultProtectingCopyTypes is used for ProtectingCopier without Types.
+var defaultProtectingCopyTypes = NewProtectingCopyTypes()
+
+// NewProtectingCopyTypes creates a new ProtectingCopyTypes
+// with time.Time, *datastore.Key, appengine.GeoPoint and *multipart.FileHeader
+// registered as opaque types.
+func NewProtectingCopyTypes() *ProtectingCopyTypes {
+	t := &ProtectingCopyTypes{
+		handlers: map[reflect.Type]protectingCopyTypeHandler{},
+		plans:    &sync.Map{},
+	}
+	t.RegisterOpaque(reflect.TypeOf(time.Time{}))
+	t.RegisterOpaque(reflect.TypeOf((*datastore.Key)(nil)))
+	t.RegisterOpaque(reflect.TypeOf(appengine.GeoPoint{}))
+	t.RegisterOpaque(reflect.TypeOf((*multipart.FileHeader)(nil)))
+	return t
+}
+
+// RegisterOpaque registers typ to be copied just by assignment
+// like non-structured types, even if it is a struct or a pointer.
+func (t *ProtectingCopyTypes) RegisterOpaque(typ reflect.Type) *ProtectingCopyTypes {
+	return t.register(typ, protectingCopyTypeHandler{})
+}
+
+// RegisterFunc registers f to copy values of typ.
+// f is responsible for deep copy and protection of the whole value.
+func (t *ProtectingCopyTypes) RegisterFunc(typ reflect.Type, f ProtectingCopyFunc) *ProtectingCopyTypes {
+	return t.register(typ, protectingCopyTypeHandler{
+		copyFunc: f,
+	})
+}
+
+// register sets handler for typ and discards cached plans.
+func (t *ProtectingCopyTypes) register(typ reflect.Type, handler protectingCopyTypeHandler) *ProtectingCopyTypes {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[typ] = handler
+	t.plans = &sync.Map{}
+	return t
+}
+
+// Unregister removes the rule for typ, including defaults.
+func (t *ProtectingCopyTypes) Unregister(typ reflect.Type) *ProtectingCopyTypes {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.handlers, typ)
+	t.plans = &sync.Map{}
+	return t
+}
+
+// lookup returns the handler for typ.
+func (t *ProtectingCopyTypes) lookup(typ reflect.Type) (protectingCopyTypeHandler, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	handler, ok := t.handlers[typ]
+	return handler, ok
+}
+
+// planCache returns the cache of plans for the current registration.
+// Plans built while registering are stored to the discarded cache.
+func (t *ProtectingCopyTypes) planCache() *sync.Map {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.plans
+}
+
+// IsNonStruct tests whether v is copied just by assignment
+// in ProtectingCopier without Types, like time.Time.
+//
+// Deprecated: Use ProtectingCopyTypes and ProtectingCopier.Types.
+func IsNonStruct(v interface{}) bool {
+	handler, ok := defaultProtectingCopyTypes.lookup(reflect.TypeOf(v))
+	return ok && handler.copyFunc == nil
+}
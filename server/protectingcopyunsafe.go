@@ -0,0 +1,14 @@
+// +build !appengine
+
+package server
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// exposeUnexported returns the settable and interfaceable value
+// of the unexported field v, which must be addressable.
+func exposeUnexported(v reflect.Value) (reflect.Value, error) {
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem(), nil
+}
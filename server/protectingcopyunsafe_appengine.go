@@ -0,0 +1,12 @@
+// +build appengine
+
+package server
+
+import (
+	"reflect"
+)
+
+// exposeUnexported fails as App Engine does not allow unsafe.
+func exposeUnexported(v reflect.Value) (reflect.Value, error) {
+	return reflect.Value{}, newErrCopyValueInvalid(ProtectingCopyReasonUnexported, "copying unexported fields is not supported on App Engine")
+}
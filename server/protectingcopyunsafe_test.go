@@ -0,0 +1,62 @@
+// +build !appengine
+
+package server
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestProtectingCopyUnexportedCopy(t *testing.T) {
+	type nested struct {
+		Name  string
+		value *int
+	}
+	type testStruct struct {
+		Name    string
+		private string
+		secret  string `protectfor:"update"`
+		nested  *nested
+		values  []int
+	}
+
+	v1 := 1
+	v2 := 2
+	dst := testStruct{Name: "name", private: "private", secret: "secret", nested: &nested{value: &v1}}
+	src := testStruct{Name: "newname", private: "newprivate", secret: "newsecret", nested: &nested{Name: "nested", value: &v2}, values: []int{1}}
+	c := &ProtectingCopier{ProtectFor: "update", Unexported: ProtectingCopyUnexportedCopy}
+	expectEquals(t, nil, c.Copy(&dst, &src))
+	expectEquals(
+		t,
+		testStruct{Name: "newname", private: "newprivate", secret: "secret", nested: &nested{Name: "nested", value: &v2}, values: []int{1}},
+		dst,
+	)
+	// 非公開フィールドも deep copy される
+	expectNotSame(t, src.nested.value, dst.nested.value)
+	expectNoAliasing(t, &dst, &src)
+
+	// コピー先を作成する場合や map の値の場合も同様
+	mDst := map[string]testStruct{}
+	mSrc := map[string]testStruct{"key": src}
+	expectEquals(t, nil, c.Copy(mDst, mSrc))
+	expectEquals(t, "newprivate", mDst["key"].private)
+	expectNoAliasing(t, mDst, mSrc)
+}
+
+func TestProtectingCopyUncopyableUnsafePointer(t *testing.T) {
+	type testStruct struct {
+		Ptr unsafe.Pointer
+	}
+
+	v1 := 1
+	v2 := 2
+	dst := testStruct{Ptr: unsafe.Pointer(&v1)}
+	src := testStruct{Ptr: unsafe.Pointer(&v2)}
+	expectEquals(t, nil, (&ProtectingCopier{Uncopyable: ProtectingCopyUncopyableSkip}).Copy(&dst, &src))
+	expectEquals(t, unsafe.Pointer(&v1), dst.Ptr)
+	if _, ok := (&ProtectingCopier{Uncopyable: ProtectingCopyUncopyableError}).Copy(&dst, &src).(*ErrCopyValueInvalid); !ok {
+		t.Errorf("Expect ErrCopyValueInvalid")
+	}
+	expectEquals(t, nil, ProtectingCopy(&dst, &src, ""))
+	expectEquals(t, unsafe.Pointer(&v2), dst.Ptr)
+}
@@ -0,0 +1,910 @@
+// protectcopygen generates reflection-free protecting copy methods.
+//
+// For each struct type with fields tagged with "protectfor" or "writablefor"
+// and for each purpose found in those tags, it generates:
+//
+//	func (dst *T) CopyProtectingFor<Purpose>(src *T) error
+//
+// which copies the same as ProtectingCopier{ProtectFor: purpose}.Copy(dst, src)
+// within the limitations below.
+// Negations in tags (e.g. "update,!admin") are supported,
+// but combinations of purposes are not.
+// The method expression (*T).CopyProtectingFor<Purpose> is a function of
+// (dst, src *T).
+//
+// Struct types without tags are copied in ProtectingCopyDenyList mode.
+// Values in interface types cannot be resolved at generation time,
+// and are copied with ProtectingCopier.
+// Types from other packages are not supported except ones specified with -opaque,
+// which are copied just by assignment like time.Time in ProtectingCopier.
+// Specify types registered to ProtectingCopyTypes with RegisterOpaque also with -opaque.
+// Types registered with RegisterFunc, embedded structs,
+// policies of map fields ("protectmap" tag), transforms ("protecttransform" tag)
+// and datastore.PropertyLoadSaver are not supported.
+// ProtectField methods (ProtectingCopyFieldProtector) declared in the package
+// are called, but ProtectingCopier.ProtectField, ProtectPaths and SliceStrategy
+// are not supported.
+// Unexported fields are kept and chans and funcs are shared
+// as the default of ProtectingCopier.Unexported and Uncopyable.
+// Values referred from multiple places in the source are shared
+// in the destination in the same way and cycles are reproduced
+// as ProtectingCopier does, except that values copied with ProtectingCopier
+// (e.g. ones in interfaces) are tracked apart from the others.
+//
+// Usage:
+//
+//	//go:generate go run ../tool/protectcopygen/main.go -output model_protectingcopy.go model.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type typeKind int
+
+const (
+	// kindSimple is copied by assignment.
+	kindSimple typeKind = iota
+	kindStruct
+	kindPtr
+	kindSlice
+	kindArray
+	kindMap
+	// kindInterface is copied with ProtectingCopier.
+	kindInterface
+)
+
+// typeInfo describes a type to copy.
+type typeInfo struct {
+	kind typeKind
+	// expr is the Go expression of the type.
+	expr   string
+	elem   *typeInfo
+	fields []*fieldInfo
+	// delegated is true if the type is copied with ProtectingCopier as a whole.
+	delegated bool
+	// pkgs are names of packages referred in expr.
+	pkgs []string
+	// allowList is true if the struct type has fields with the writable tag.
+	allowList bool
+	// protector is true if the named type has ProtectField method
+	// (ProtectingCopyFieldProtector).
+	protector bool
+}
+
+// isCopiedFor tests whether the field f of the struct type t is copied for purpose.
+func (t *typeInfo) isCopiedFor(f *fieldInfo, purpose string) bool {
+	if matchTagValues(f.protectValues, purpose) {
+		return false
+	}
+	return !t.allowList || matchTagValues(f.writableValues, purpose)
+}
+
+// matchTagValues tests whether tag values match purpose
+// like ProtectingCopier with ProtectingCopyMatchAny.
+func matchTagValues(values []string, purpose string) bool {
+	if len(values) == 0 {
+		return false
+	}
+	matched := false
+	positives := 0
+	for _, v := range values {
+		if strings.HasPrefix(v, "!") {
+			if v[1:] == purpose {
+				return false
+			}
+			continue
+		}
+		positives++
+		if v == purpose {
+			matched = true
+		}
+	}
+	// a tag only with negations matches any purposes except negated ones.
+	return matched || positives == 0
+}
+
+type fieldInfo struct {
+	name           string
+	typ            *typeInfo
+	protectValues  []string
+	writableValues []string
+}
+
+var basicTypes = map[string]bool{
+	"bool": true, "string": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"byte": true, "rune": true,
+	"float32": true, "float64": true, "complex64": true, "complex128": true,
+}
+
+// resolver builds typeInfo from the AST.
+type resolver struct {
+	fset        *token.FileSet
+	tagName     string
+	writableTag string
+	mapTag      string
+	opaque      map[string]bool
+	decls       map[string]ast.Expr
+	resolved    map[string]*typeInfo
+	// protectors are names of types with ProtectField method.
+	protectors map[string]bool
+	// loadSavers are names of types with Load and Save methods
+	// (datastore.PropertyLoadSaver).
+	loadSavers map[string]bool
+	// transformTag is the tag name of transforms, which are not supported.
+	transformTag string
+}
+
+func (r *resolver) exprString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, r.fset, expr); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+func (r *resolver) resolveNamed(name string) (*typeInfo, error) {
+	if t, ok := r.resolved[name]; ok {
+		return t, nil
+	}
+	decl, ok := r.decls[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown type: %v", name)
+	}
+	// register before resolving the underlying type
+	// for recursive types.
+	t := &typeInfo{expr: name}
+	r.resolved[name] = t
+	underlying, err := r.resolve(decl)
+	if err != nil {
+		return nil, err
+	}
+	expr := t.expr
+	*t = *underlying
+	t.expr = expr
+	t.pkgs = nil
+	t.protector = r.protectors[name]
+	if r.loadSavers[name] {
+		return nil, fmt.Errorf("unsupported datastore.PropertyLoadSaver: %v", name)
+	}
+	return t, nil
+}
+
+func (r *resolver) resolve(expr ast.Expr) (*typeInfo, error) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return r.resolve(e.X)
+	case *ast.Ident:
+		if basicTypes[e.Name] {
+			return &typeInfo{kind: kindSimple, expr: e.Name}, nil
+		}
+		if e.Name == "error" {
+			return &typeInfo{kind: kindInterface, expr: e.Name}, nil
+		}
+		return r.resolveNamed(e.Name)
+	case *ast.SelectorExpr:
+		name := r.exprString(e)
+		if r.opaque[name] {
+			return &typeInfo{kind: kindSimple, expr: name, pkgs: []string{r.exprString(e.X)}}, nil
+		}
+		return nil, fmt.Errorf("unsupported type from another package: %v (specify with -opaque to copy by assignment)", name)
+	case *ast.StarExpr:
+		if name := r.exprString(e); r.opaque[name] {
+			ret := &typeInfo{kind: kindSimple, expr: name}
+			if sel, ok := e.X.(*ast.SelectorExpr); ok {
+				ret.pkgs = []string{r.exprString(sel.X)}
+			}
+			return ret, nil
+		}
+		elem, err := r.resolve(e.X)
+		if err != nil {
+			return nil, err
+		}
+		return &typeInfo{kind: kindPtr, expr: r.exprString(e), elem: elem, pkgs: elem.pkgs}, nil
+	case *ast.ArrayType:
+		elem, err := r.resolve(e.Elt)
+		if err != nil {
+			return nil, err
+		}
+		kind := kindArray
+		if e.Len == nil {
+			kind = kindSlice
+		}
+		return &typeInfo{kind: kind, expr: r.exprString(e), elem: elem, pkgs: elem.pkgs}, nil
+	case *ast.MapType:
+		key, err := r.resolve(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := r.resolve(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &typeInfo{
+			kind: kindMap,
+			expr: r.exprString(e),
+			elem: elem,
+			// canSetForMap in ProtectingCopier depends on dynamic types.
+			delegated: elem.kind == kindInterface,
+			pkgs:      append(append([]string{}, key.pkgs...), elem.pkgs...),
+		}, nil
+	case *ast.InterfaceType:
+		return &typeInfo{kind: kindInterface, expr: r.exprString(e)}, nil
+	case *ast.ChanType, *ast.FuncType:
+		return &typeInfo{kind: kindSimple, expr: r.exprString(e)}, nil
+	case *ast.StructType:
+		t := &typeInfo{kind: kindStruct, expr: r.exprString(e)}
+		for _, field := range e.Fields.List {
+			var protectValues, writableValues []string
+			hasWritable := false
+			if field.Tag != nil {
+				tag, err := strconv.Unquote(field.Tag.Value)
+				if err != nil {
+					return nil, err
+				}
+				if v := reflect.StructTag(tag).Get(r.tagName); v != "" {
+					protectValues = strings.Split(v, ",")
+				}
+				if _, ok := reflect.StructTag(tag).Lookup(r.mapTag); ok {
+					return nil, fmt.Errorf("unsupported %v tag: %v", r.mapTag, tag)
+				}
+				if _, ok := reflect.StructTag(tag).Lookup(r.transformTag); ok {
+					return nil, fmt.Errorf("unsupported %v tag: %v", r.transformTag, tag)
+				}
+				if v, ok := reflect.StructTag(tag).Lookup(r.writableTag); ok {
+					hasWritable = true
+					if v != "" {
+						writableValues = strings.Split(v, ",")
+					}
+				}
+			}
+			names := []string{}
+			for _, name := range field.Names {
+				names = append(names, name.Name)
+			}
+			if len(names) == 0 {
+				// embedded field is named after the type.
+				typeExpr := field.Type
+				if star, ok := typeExpr.(*ast.StarExpr); ok {
+					typeExpr = star.X
+				}
+				switch te := typeExpr.(type) {
+				case *ast.Ident:
+					names = append(names, te.Name)
+				case *ast.SelectorExpr:
+					names = append(names, te.Sel.Name)
+				default:
+					return nil, fmt.Errorf("unsupported embedded field: %v", r.exprString(field.Type))
+				}
+				ft, err := r.resolve(field.Type)
+				if err != nil {
+					return nil, fmt.Errorf("%v: %v", names[0], err)
+				}
+				if ft.kind == kindStruct || (ft.kind == kindPtr && ft.elem.kind == kindStruct) {
+					// ProtectingCopier promotes fields of embedded structs.
+					return nil, fmt.Errorf("unsupported embedded struct: %v", r.exprString(field.Type))
+				}
+			}
+			for _, name := range names {
+				if !ast.IsExported(name) {
+					// unexported fields are not copied.
+					continue
+				}
+				ft, err := r.resolve(field.Type)
+				if err != nil {
+					return nil, fmt.Errorf("%v: %v", name, err)
+				}
+				t.pkgs = append(t.pkgs, ft.pkgs...)
+				if hasWritable {
+					// ProtectingCopyAllowList
+					t.allowList = true
+				}
+				t.fields = append(t.fields, &fieldInfo{
+					name:           name,
+					typ:            ft,
+					protectValues:  protectValues,
+					writableValues: writableValues,
+				})
+			}
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("unsupported type: %v", r.exprString(expr))
+}
+
+// collectMethods lists types with ProtectField method
+// and ones with Load and Save methods
+// in the package in dir except the output file.
+func (r *resolver) collectMethods(dir string, output string) error {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return info.Name() != path.Base(output)
+	}, 0)
+	if err != nil {
+		return err
+	}
+	// methods are names of methods for each type.
+	methods := map[string]map[string]bool{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				funcDecl, ok := decl.(*ast.FuncDecl)
+				if !ok || funcDecl.Recv == nil {
+					continue
+				}
+				recv := funcDecl.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				if ident, ok := recv.(*ast.Ident); ok {
+					if methods[ident.Name] == nil {
+						methods[ident.Name] = map[string]bool{}
+					}
+					methods[ident.Name][funcDecl.Name.Name] = true
+				}
+			}
+		}
+	}
+	for name, m := range methods {
+		if m["ProtectField"] {
+			r.protectors[name] = true
+		}
+		if m["Load"] && m["Save"] {
+			r.loadSavers[name] = true
+		}
+	}
+	return nil
+}
+
+// collectPurposes lists tag values in t and nested types.
+func collectPurposes(t *typeInfo, purposes map[string]bool, visited map[*typeInfo]bool) {
+	if t == nil || visited[t] {
+		return
+	}
+	visited[t] = true
+	for _, f := range t.fields {
+		for _, v := range append(append([]string{}, f.protectValues...), f.writableValues...) {
+			if v = strings.TrimPrefix(v, "!"); v != "" {
+				purposes[v] = true
+			}
+		}
+		collectPurposes(f.typ, purposes, visited)
+	}
+	collectPurposes(t.elem, purposes, visited)
+}
+
+// generator emits the code for a purpose.
+type generator struct {
+	prefix  string
+	purpose string
+	suffix  string
+	buf     bytes.Buffer
+	helpers map[string]string
+	queue   []*typeInfo
+	// pkgs are names of packages to import.
+	pkgs map[string]bool
+	// usesCopier is true if the generated code uses ProtectingCopier.
+	usesCopier bool
+}
+
+func newGenerator(prefix, purpose string) *generator {
+	return &generator{
+		prefix:  prefix,
+		purpose: purpose,
+		suffix:  purposeSuffix(purpose),
+		helpers: map[string]string{},
+		pkgs:    map[string]bool{},
+	}
+}
+
+// typeExpr returns the expression of t to emit.
+func (g *generator) typeExpr(t *typeInfo) string {
+	for _, pkg := range t.pkgs {
+		g.pkgs[pkg] = true
+	}
+	return t.expr
+}
+
+// copier returns the name of the variable holding ProtectingCopier.
+func (g *generator) copier() string {
+	return fmt.Sprintf("%sCopierFor%s", g.prefix, g.suffix)
+}
+
+// state returns the name of the type tracking copied references.
+func (g *generator) state() string {
+	return copyStateName(g.prefix)
+}
+
+func (g *generator) nextHelperName() string {
+	return fmt.Sprintf("%sCopyFor%s%d", g.prefix, g.suffix, len(g.helpers)+1)
+}
+
+// purposeSuffix converts a purpose to a part of identifiers.
+// e.g. "update" -> "Update", "bulk-import" -> "BulkImport"
+func purposeSuffix(purpose string) string {
+	var buf bytes.Buffer
+	upper := true
+	for _, r := range purpose {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// helper returns the name of the function copying *src to *dst for t.
+func (g *generator) helper(t *typeInfo) string {
+	if name, ok := g.helpers[t.expr]; ok {
+		return name
+	}
+	name := g.nextHelperName()
+	g.helpers[t.expr] = name
+	g.queue = append(g.queue, t)
+	return name
+}
+
+// mapImplHelper returns the name of the function copying entries
+// of a non-nil map to another non-nil map.
+func (g *generator) mapImplHelper(t *typeInfo) string {
+	key := "impl:" + t.expr
+	if name, ok := g.helpers[key]; ok {
+		return name
+	}
+	name := g.nextHelperName()
+	g.helpers[key] = name
+	g.queue = append(g.queue, &typeInfo{kind: kindMap, expr: key, elem: t})
+	return name
+}
+
+// copyStmt emits statements to copy the variable s to the variable d of t.
+func (g *generator) copyStmt(t *typeInfo, d, s string) string {
+	if t.kind == kindSimple {
+		return fmt.Sprintf("%s = %s\n", d, s)
+	}
+	return fmt.Sprintf("if err := %s(s, &%s, &%s); err != nil {\nreturn err\n}\n", g.helper(t), d, s)
+}
+
+// createCopiedStmt emits statements to set the copy of s
+// created from the zero value to d[k] like ProtectingCopier.createCopiedDest.
+// References already copied are shared instead.
+func (g *generator) createCopiedStmt(t *typeInfo, d, k, s string) string {
+	switch t.kind {
+	case kindSimple:
+		return fmt.Sprintf("%s[%s] = %s\n", d, k, s)
+	case kindPtr:
+		return fmt.Sprintf(
+			"if %[3]s == nil {\n%[1]s[%[2]s] = nil\n} else if v, ok := s.lookup(%[3]s); ok {\n%[1]s[%[2]s] = v.(%[4]s)\n} else {\nn := new(%[5]s)\ns.visit(n, %[3]s)\n%[6]s%[1]s[%[2]s] = n\n}\n",
+			d, k, s, g.typeExpr(t), g.typeExpr(t.elem), g.copyStmt(t.elem, "(*n)", "(*"+s+")"),
+		)
+	case kindMap:
+		return fmt.Sprintf(
+			"if %[3]s == nil {\n%[1]s[%[2]s] = %[3]s\n} else if v, ok := s.lookup(%[3]s); ok {\n%[1]s[%[2]s] = v.(%[4]s)\n} else {\nn := make(%[4]s)\ns.visit(n, %[3]s)\nif err := %[5]s(s, n, %[3]s); err != nil {\nreturn err\n}\n%[1]s[%[2]s] = n\n}\n",
+			d, k, s, g.typeExpr(t), g.mapImplHelper(t),
+		)
+	case kindSlice:
+		return fmt.Sprintf(
+			"if %[3]s == nil {\n%[1]s[%[2]s] = %[3]s\n} else if v, ok := s.lookup(%[3]s); ok {\n%[1]s[%[2]s] = v.(%[4]s)\n} else {\nn := make(%[4]s, len(%[3]s))\ns.visit(n, %[3]s)\nfor i := range %[3]s {\n%[5]s}\n%[1]s[%[2]s] = n\n}\n",
+			d, k, s, g.typeExpr(t), g.copyStmt(t.elem, "n[i]", s+"[i]"),
+		)
+	}
+	return fmt.Sprintf("var n %s\n%s%s[%s] = n\n", g.typeExpr(t), g.copyStmt(t, "n", s), d, k)
+}
+
+func (g *generator) emitHelper(t *typeInfo, name string) {
+	if strings.HasPrefix(t.expr, "impl:") {
+		g.emitMapImpl(t.elem, name)
+		return
+	}
+	g.printf("\n// %s copies %s.\n", name, oneLine(t.expr))
+	g.printf("func %s(s *%s, dst, src *%s) error {\n", name, g.state(), g.typeExpr(t))
+	if t.delegated || t.kind == kindInterface {
+		g.usesCopier = true
+		g.printf("return %s.Copy(dst, src)\n}\n", g.copier())
+		return
+	}
+	switch t.kind {
+	case kindStruct:
+		fields := []*fieldInfo{}
+		for _, f := range t.fields {
+			if t.isCopiedFor(f, g.purpose) {
+				fields = append(fields, f)
+			}
+		}
+		if t.protector && len(fields) > 0 {
+			// decide before copying like ProtectingCopier.
+			g.printf("protected := [%d]bool{\n", len(fields))
+			for _, f := range fields {
+				g.printf("dst.ProtectField(%q, dst.%s, src.%s),\n", f.name, f.name, f.name)
+			}
+			g.printf("}\n")
+		}
+		for idx, f := range fields {
+			if t.protector {
+				g.printf("if !protected[%d] {\n%s}\n", idx, g.copyStmt(f.typ, "dst."+f.name, "src."+f.name))
+				continue
+			}
+			g.printf("%s", g.copyStmt(f.typ, "dst."+f.name, "src."+f.name))
+		}
+	case kindPtr:
+		g.printf("if *src == nil {\n*dst = nil\nreturn nil\n}\n")
+		g.printf("if v, ok := s.lookup(*src); ok {\n*dst = v.(%s)\nreturn nil\n}\n", g.typeExpr(t))
+		g.printf("d := *dst\n")
+		g.printf("if d == nil || !s.canCopyInto(d, *src) {\nd = new(%s)\n}\n", g.typeExpr(t.elem))
+		g.printf("s.visit(d, *src)\n")
+		g.printf("%s", g.copyStmt(t.elem, "(*d)", "(**src)"))
+		g.printf("*dst = d\n")
+	case kindSlice:
+		g.printf("if *src == nil {\n*dst = nil\nreturn nil\n}\n")
+		g.printf("if v, ok := s.lookup(*src); ok {\n*dst = v.(%s)\nreturn nil\n}\n", g.typeExpr(t))
+		g.printf("d := *dst\n")
+		g.printf("if len(d) != len(*src) || !s.canCopyInto(d, *src) {\nd = make(%s, len(*src))\n}\n", g.typeExpr(t))
+		g.printf("s.visit(d, *src)\n")
+		g.printf("for i := range *src {\n%s}\n", g.copyStmt(t.elem, "d[i]", "(*src)[i]"))
+		g.printf("*dst = d\n")
+	case kindArray:
+		g.printf("for i := range *src {\n%s}\n", g.copyStmt(t.elem, "(*dst)[i]", "(*src)[i]"))
+	case kindMap:
+		g.printf("if *src == nil {\n*dst = nil\nreturn nil\n}\n")
+		g.printf("if v, ok := s.lookup(*src); ok {\n*dst = v.(%s)\nreturn nil\n}\n", g.typeExpr(t))
+		g.printf("d := *dst\n")
+		g.printf("if d == nil || !s.canCopyInto(d, *src) {\nd = make(%s)\n}\n", g.typeExpr(t))
+		g.printf("s.visit(d, *src)\n")
+		g.printf("if err := %s(s, d, *src); err != nil {\nreturn err\n}\n", g.mapImplHelper(t))
+		g.printf("*dst = d\n")
+	}
+	g.printf("return nil\n}\n")
+}
+
+// emitMapImpl emits the function like ProtectingCopier.copyMapImpl.
+func (g *generator) emitMapImpl(t *typeInfo, name string) {
+	g.printf("\n// %s copies entries of %s.\n", name, oneLine(t.expr))
+	g.printf("func %s(s *%s, dst, src %s) error {\n", name, g.state(), g.typeExpr(t))
+	g.printf("for k := range dst {\nif _, ok := src[k]; !ok {\ndelete(dst, k)\n}\n}\n")
+	g.printf("for k, sv := range src {\n")
+	elem := t.elem
+	switch elem.kind {
+	case kindPtr:
+		g.printf("if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {\ns.visit(dv, sv)\n%s} else {\n%s}\n",
+			g.copyStmt(elem.elem, "(*dv)", "(*sv)"),
+			g.createCopiedStmt(elem, "dst", "k", "sv"),
+		)
+	case kindMap:
+		g.printf("if dv, ok := dst[k]; ok && dv != nil && sv != nil && s.canCopyInto(dv, sv) {\ns.visit(dv, sv)\nif err := %s(s, dv, sv); err != nil {\nreturn err\n}\n} else {\n%s}\n",
+			g.mapImplHelper(elem),
+			g.createCopiedStmt(elem, "dst", "k", "sv"),
+		)
+	case kindSlice:
+		g.printf("if dv, ok := dst[k]; ok && dv != nil && sv != nil && len(dv) == len(sv) && s.canCopyInto(dv, sv) {\ns.visit(dv, sv)\nfor i := range sv {\n%s}\n} else {\n%s}\n",
+			g.copyStmt(elem.elem, "dv[i]", "sv[i]"),
+			g.createCopiedStmt(elem, "dst", "k", "sv"),
+		)
+	default:
+		g.printf("%s", g.createCopiedStmt(elem, "dst", "k", "sv"))
+	}
+	g.printf("}\nreturn nil\n}\n")
+}
+
+// emitRoot emits the method for the named struct type.
+func (g *generator) emitRoot(t *typeInfo, errQualifier string) {
+	method := "CopyProtectingFor" + g.suffix
+	g.printf("\n// %s copies src to dst protecting fields for %q.\n", method, g.purpose)
+	g.printf("// This copies the same as ProtectingCopy(dst, src, %q).\n", g.purpose)
+	g.printf("func (dst *%s) %s(src *%s) error {\n", t.expr, method, t.expr)
+	g.printf("if dst == nil || src == nil {\nreturn %sNewErrCopyValueInvalid(\"Cannot copy as dst or src is nil\")\n}\n", errQualifier)
+	g.printf("s := &%s{}\ns.visit(dst, src)\n", g.state())
+	g.printf("return %s(s, dst, src)\n}\n", g.helper(t))
+}
+
+// copyStateName returns the name of the type tracking copied references.
+func copyStateName(prefix string) string {
+	return prefix + "CopyState"
+}
+
+// copyStateTemplate is the code of the type tracking copied references
+// like protectingCopyState in ProtectingCopier.
+// %[1]s is the name of the type and %[2]s is the prefix.
+const copyStateTemplate = `
+// %[2]sCopyRef is the reference of a pointer, map or slice.
+type %[2]sCopyRef struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+// %[2]sCopyRefOf returns the reference of v.
+// Returns false if v is not a reference or nil or an empty slice.
+func %[2]sCopyRefOf(v interface{}) (%[2]sCopyRef, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map:
+		if rv.IsNil() {
+			return %[2]sCopyRef{}, false
+		}
+		return %[2]sCopyRef{typ: rv.Type(), ptr: rv.Pointer()}, true
+	case reflect.Slice:
+		if rv.IsNil() || rv.Len() == 0 {
+			// empty slices may share the address
+			return %[2]sCopyRef{}, false
+		}
+		return %[2]sCopyRef{typ: rv.Type(), ptr: rv.Pointer(), len: rv.Len()}, true
+	}
+	return %[2]sCopyRef{}, false
+}
+
+// %[1]s tracks references copied by the generated functions
+// to share them in the destination as ProtectingCopier does.
+type %[1]s struct {
+	// visited maps references in the source to their copies.
+	visited map[%[2]sCopyRef]interface{}
+	// claimed are references in the destination which are copies.
+	claimed map[%[2]sCopyRef]bool
+}
+
+// visit records dst is the copy of src.
+func (s *%[1]s) visit(dst, src interface{}) {
+	srcRef, ok := %[2]sCopyRefOf(src)
+	if !ok {
+		return
+	}
+	dstRef, ok := %[2]sCopyRefOf(dst)
+	if !ok {
+		return
+	}
+	if s.visited == nil {
+		s.visited = map[%[2]sCopyRef]interface{}{}
+		s.claimed = map[%[2]sCopyRef]bool{}
+	}
+	s.visited[srcRef] = dst
+	s.claimed[dstRef] = true
+}
+
+// lookup returns the copy of src if already copied.
+func (s *%[1]s) lookup(src interface{}) (interface{}, bool) {
+	ref, ok := %[2]sCopyRefOf(src)
+	if !ok {
+		return nil, false
+	}
+	dst, ok := s.visited[ref]
+	return dst, ok
+}
+
+// canCopyInto tests whether src can be copied into dst in place,
+// that is, src is not copied yet and dst is not a copy of another value.
+func (s *%[1]s) canCopyInto(dst, src interface{}) bool {
+	if _, ok := s.lookup(src); ok {
+		return false
+	}
+	ref, ok := %[2]sCopyRefOf(dst)
+	return !ok || !s.claimed[ref]
+}
+`
+
+func (g *generator) emitQueued() {
+	for len(g.queue) > 0 {
+		t := g.queue[0]
+		g.queue = g.queue[1:]
+		key := t.expr
+		g.emitHelper(t, g.helpers[key])
+	}
+}
+
+// oneLine joins a multi-line expression like an anonymous struct
+// to put in comments.
+func oneLine(expr string) string {
+	return strings.Join(strings.Fields(expr), " ")
+}
+
+func splitList(v string) []string {
+	ret := []string{}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func main() {
+	output := flag.String("output", "", "output file (required)")
+	tagName := flag.String("tag", "protectfor", "struct tag name")
+	writableTag := flag.String("writabletag", "writablefor", "struct tag name for the allow-list mode")
+	mapTag := flag.String("maptag", "protectmap", "struct tag name of policies of map fields, which are not supported")
+	transformTag := flag.String("transformtag", "protecttransform", "struct tag name of transforms of fields, which are not supported")
+	typeList := flag.String("type", "", "comma-separated struct types to generate (default: types with the tag)")
+	purposeList := flag.String("purpose", "", "comma-separated purposes to generate (default: all values of the tag)")
+	runtimePkg := flag.String("runtime", "", "import path of the package providing ProtectingCopier (default: the same package)")
+	opaqueList := flag.String("opaque", "time.Time,*datastore.Key,appengine.GeoPoint,*multipart.FileHeader", "comma-separated types to copy by assignment, registered as opaque in ProtectingCopyTypes")
+	prefix := flag.String("prefix", "", "prefix of generated unexported identifiers to avoid conflicts among generated files (default: the first type)")
+	flag.Parse()
+	if *output == "" || flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s -output file [options] input.go...\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	fset := token.NewFileSet()
+	r := &resolver{
+		fset:         fset,
+		tagName:      *tagName,
+		writableTag:  *writableTag,
+		mapTag:       *mapTag,
+		transformTag: *transformTag,
+		opaque:       map[string]bool{},
+		decls:        map[string]ast.Expr{},
+		resolved:     map[string]*typeInfo{},
+		protectors:   map[string]bool{},
+		loadSavers:   map[string]bool{},
+	}
+	for _, name := range splitList(*opaqueList) {
+		r.opaque[name] = true
+	}
+
+	if err := r.collectMethods(path.Dir(flag.Arg(0)), *output); err != nil {
+		log.Fatal(err)
+	}
+
+	pkgName := ""
+	typeNames := []string{}
+	// importPaths maps package names to import paths in the input files.
+	importPaths := map[string]string{}
+	for _, filename := range flag.Args() {
+		file, err := parser.ParseFile(fset, filename, nil, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pkgName = file.Name.Name
+		for _, spec := range file.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				log.Fatal(err)
+			}
+			name := path.Base(importPath)
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			importPaths[name] = importPath
+		}
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				r.decls[typeSpec.Name.Name] = typeSpec.Type
+				typeNames = append(typeNames, typeSpec.Name.Name)
+			}
+		}
+	}
+
+	roots := []*typeInfo{}
+	purposes := map[string]bool{}
+	targets := splitList(*typeList)
+	if len(targets) == 0 {
+		targets = typeNames
+	}
+	for _, name := range targets {
+		t, err := r.resolveNamed(name)
+		if err != nil {
+			log.Fatalf("%v: %v", name, err)
+		}
+		if t.kind != kindStruct {
+			if *typeList != "" {
+				log.Fatalf("%v: not a struct", name)
+			}
+			continue
+		}
+		found := map[string]bool{}
+		collectPurposes(t, found, map[*typeInfo]bool{})
+		if len(found) == 0 && *typeList == "" {
+			continue
+		}
+		roots = append(roots, t)
+		for purpose := range found {
+			purposes[purpose] = true
+		}
+	}
+	purposeNames := splitList(*purposeList)
+	if len(purposeNames) == 0 {
+		for purpose := range purposes {
+			purposeNames = append(purposeNames, purpose)
+		}
+		sort.Strings(purposeNames)
+	}
+
+	if len(roots) == 0 {
+		log.Fatalf("No struct types with the tag %q or %q", *tagName, *writableTag)
+	}
+	if *prefix == "" {
+		name := roots[0].expr
+		*prefix = strings.ToLower(name[:1]) + name[1:]
+	}
+
+	qualifier := ""
+	imports := map[string]string{}
+	if *runtimePkg != "" {
+		qualifier = path.Base(*runtimePkg) + "."
+		imports[path.Base(*runtimePkg)] = *runtimePkg
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, copyStateTemplate, copyStateName(*prefix), *prefix)
+	imports["reflect"] = "reflect"
+	for _, purpose := range purposeNames {
+		g := newGenerator(*prefix, purpose)
+		for _, root := range roots {
+			g.emitRoot(root, qualifier)
+		}
+		g.emitQueued()
+		if g.usesCopier {
+			fmt.Fprintf(
+				&body,
+				"\n// %s copies values in interfaces, which cannot be resolved at generation time.\nvar %s = &%sProtectingCopier{StructTag: %q, WritableTag: %q, ProtectFor: %q}\n",
+				g.copier(), g.copier(), qualifier, *tagName, *writableTag, purpose,
+			)
+		}
+		body.Write(g.buf.Bytes())
+		for pkg := range g.pkgs {
+			importPath, ok := importPaths[pkg]
+			if !ok {
+				log.Fatalf("Cannot resolve the import path of %v", pkg)
+			}
+			imports[pkg] = importPath
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by protectcopygen. DO NOT EDIT.\n\npackage %s\n", pkgName)
+	if len(imports) > 0 {
+		names := []string{}
+		for name := range imports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&out, "\nimport (\n")
+		for _, name := range names {
+			if path.Base(imports[name]) == name {
+				fmt.Fprintf(&out, "%q\n", imports[name])
+			} else {
+				fmt.Fprintf(&out, "%s %q\n", name, imports[name])
+			}
+		}
+		fmt.Fprintf(&out, ")\n")
+	}
+	out.Write(body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		log.Fatalf("Failed to format the generated code: %v\n%s", err, out.String())
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}